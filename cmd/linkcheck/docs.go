@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"linkChecker/internal/extract"
+	"linkChecker/internal/storage"
+)
+
+// docLinks are the links -docs found in documentation files.
+type docLinks struct {
+	urls    []string
+	sources map[string][]storage.LinkSource
+	// local are the relative links, already checked against the files.
+	local []storage.LinkResult
+}
+
+// scanDocs extracts the links of the documents in a directory or a zip,
+// tar or tar.gz archive.
+func scanDocs(name string) (*docLinks, error) {
+	if name == "" {
+		return &docLinks{}, nil
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	var tree *extract.Tree
+	if info.IsDir() {
+		tree, err = extract.ReadDir(name)
+	} else {
+		var f *os.File
+		if f, err = os.Open(name); err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		tree, err = extract.ReadArchive(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report := tree.Scan()
+	found := &docLinks{}
+	found.urls, found.sources = report.ExternalURLs()
+	found.local = report.LocalResults(time.Now())
+	return found, nil
+}
@@ -0,0 +1,312 @@
+// Command linkcheck checks links from the terminal or CI, either with the
+// checker engine in-process or through a running Link Checker server.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"linkChecker/internal/checker"
+	"linkChecker/internal/pdf"
+	"linkChecker/internal/storage"
+)
+
+// Exit codes.
+const (
+	exitOK = 0
+	// exitFailures means the check ran but too many links are unavailable.
+	exitFailures = 1
+	// exitError means the check could not run at all.
+	exitError = 2
+)
+
+const (
+	serverEnv = "LINKCHECKER_SERVER"
+	apiKeyEnv = "LINKCHECKER_API_KEY"
+)
+
+// options are the command-line flags.
+type options struct {
+	files  stringList
+	docs   string
+	format string
+	pdf    string
+	name   string
+	tags   string
+
+	maxFailures     int
+	maxFailureRatio float64
+
+	checker checker.Options
+
+	server       string
+	apiKey       string
+	noWait       bool
+	pollInterval time.Duration
+	waitTimeout  time.Duration
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts, urls, err := parseFlags(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "linkcheck: %v\n", err)
+		return exitError
+	}
+
+	fromFiles, err := readURLs(opts.files, stdin, len(urls) == 0 && opts.docs == "")
+	if err != nil {
+		fmt.Fprintf(stderr, "linkcheck: %v\n", err)
+		return exitError
+	}
+	urls = append(urls, fromFiles...)
+
+	docs, err := scanDocs(opts.docs)
+	if err != nil {
+		fmt.Fprintf(stderr, "linkcheck: failed to read -docs: %v\n", err)
+		return exitError
+	}
+	urls = append(urls, docs.urls...)
+	if len(urls) == 0 && len(docs.local) == 0 {
+		fmt.Fprintln(stderr, "linkcheck: no URLs to check")
+		return exitError
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var report *storage.LinkBatch
+	if opts.server != "" && len(urls) > 0 {
+		client := newClient(opts.server, opts.apiKey)
+		report, err = checkRemote(ctx, client, opts, urls, docs, stdout, stderr)
+	} else {
+		report, err = checkLocal(ctx, opts, urls, docs)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "linkcheck: %v\n", err)
+		return exitError
+	}
+	if report == nil {
+		// Submitted with -no-wait; the batch ID was printed. Only the
+		// local links of -docs have results yet, so they alone are held
+		// against the threshold, and stdout keeps just the ID.
+		if failed, total := countFailures(docs.local); opts.exceeded(failed, total) {
+			for _, result := range docs.local {
+				if !result.Available {
+					fmt.Fprintf(stderr, "linkcheck: %s %s: %s\n", joinSources(result.Sources), result.URL, result.Error)
+				}
+			}
+			fmt.Fprintf(stderr, "linkcheck: %d of %d local links unavailable\n", failed, total)
+			return exitFailures
+		}
+		return exitOK
+	}
+
+	if err := writeResults(stdout, opts.format, report); err != nil {
+		fmt.Fprintf(stderr, "linkcheck: %v\n", err)
+		return exitError
+	}
+
+	if report.Status != "completed" {
+		fmt.Fprintf(stderr, "linkcheck: batch %s\n", report.Status)
+		return exitError
+	}
+	if failed, total := countFailures(report.Results); opts.exceeded(failed, total) {
+		fmt.Fprintf(stderr, "linkcheck: %d of %d links unavailable\n", failed, total)
+		return exitFailures
+	}
+	return exitOK
+}
+
+func parseFlags(args []string, stderr io.Writer) (*options, []string, error) {
+	opts := &options{checker: checker.DefaultOptions()}
+
+	fs := flag.NewFlagSet("linkcheck", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: linkcheck [flags] [URL...]")
+		fmt.Fprintln(fs.Output(), "URLs are read from the arguments, -f files and -docs, or from stdin when none is given.")
+		fs.PrintDefaults()
+	}
+
+	fs.Var(&opts.files, "f", "file with one URL per line, - for stdin; repeatable")
+	fs.StringVar(&opts.docs, "docs", "", "check the links of Markdown, HTML, RST and AsciiDoc files in this directory or zip, tar or tar.gz archive")
+	fs.StringVar(&opts.format, "format", formatTable, "output format: table, json or csv")
+	fs.StringVar(&opts.pdf, "pdf", "", "also write a PDF report to this file")
+	fs.StringVar(&opts.name, "name", "", "name of the batch, shown in reports")
+	fs.StringVar(&opts.tags, "tags", "", "comma-separated tags of the batch")
+
+	fs.IntVar(&opts.maxFailures, "max-failures", 0, "unavailable links allowed before exiting with 1, -1 for no limit")
+	fs.Float64Var(&opts.maxFailureRatio, "max-failure-ratio", 0, "share of unavailable links allowed, 0 to 1; replaces -max-failures when set")
+
+	fs.DurationVar(&opts.checker.Timeout, "timeout", opts.checker.Timeout, "timeout of one URL check")
+	fs.DurationVar(&opts.checker.DialTimeout, "dial-timeout", opts.checker.DialTimeout, "timeout for connecting to a host")
+	fs.IntVar(&opts.checker.MaxRedirects, "max-redirects", opts.checker.MaxRedirects, "redirect a check fails on (N-1 are followed)")
+	fs.IntVar(&opts.checker.Concurrency, "concurrency", opts.checker.Concurrency, "URLs checked at once")
+	fs.StringVar(&opts.checker.UserAgent, "user-agent", opts.checker.UserAgent, "User-Agent sent to checked hosts")
+
+	fs.StringVar(&opts.server, "server", os.Getenv(serverEnv), "check through this Link Checker server instead of locally (env "+serverEnv+")")
+	fs.StringVar(&opts.apiKey, "api-key", os.Getenv(apiKeyEnv), "API key for -server (env "+apiKeyEnv+")")
+	fs.BoolVar(&opts.noWait, "no-wait", false, "with -server, print the batch ID and exit without waiting")
+	fs.DurationVar(&opts.pollInterval, "poll-interval", 2*time.Second, "with -server, how often to poll the batch status")
+	fs.DurationVar(&opts.waitTimeout, "wait-timeout", 0, "with -server, give up waiting after this long, 0 to wait forever")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	switch opts.format {
+	case formatTable, formatJSON, formatCSV:
+	default:
+		return nil, nil, fmt.Errorf("invalid -format %q: use table, json or csv", opts.format)
+	}
+	if opts.maxFailureRatio < 0 || opts.maxFailureRatio > 1 {
+		return nil, nil, fmt.Errorf("-max-failure-ratio must be between 0 and 1, got %v", opts.maxFailureRatio)
+	}
+	if opts.server == "" {
+		if err := opts.checker.Validate(); err != nil {
+			return nil, nil, err
+		}
+	} else if opts.pollInterval <= 0 {
+		return nil, nil, fmt.Errorf("-poll-interval must be positive, got %v", opts.pollInterval)
+	}
+
+	return opts, fs.Args(), nil
+}
+
+// exceeded reports whether failed of total unavailable links break the
+// failure threshold.
+func (o *options) exceeded(failed, total int) bool {
+	if o.maxFailureRatio > 0 {
+		return total > 0 && float64(failed)/float64(total) > o.maxFailureRatio
+	}
+	return o.maxFailures >= 0 && failed > o.maxFailures
+}
+
+func (o *options) metadata() storage.BatchMetadata {
+	meta := storage.BatchMetadata{Name: o.name}
+	for _, tag := range strings.Split(o.tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			meta.Tags = append(meta.Tags, tag)
+		}
+	}
+	return meta
+}
+
+// checkLocal checks urls in-process and reports them as a batch, which is
+// what the output and PDF functions take. The relative links of docs are
+// reported after them.
+func checkLocal(ctx context.Context, opts *options, urls []string, docs *docLinks) (*storage.LinkBatch, error) {
+	lc, err := checker.NewLinkCheckerWithOptions(opts.checker)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &storage.LinkBatch{
+		PublicID:      "local",
+		URLs:          urls,
+		CreatedAt:     time.Now().Format(time.RFC3339),
+		BatchMetadata: opts.metadata(),
+	}
+
+	for _, result := range lc.CheckLinks(ctx, urls) {
+		report.Results = append(report.Results, storage.LinkResult{
+			URL:            result.URL,
+			Status:         result.Status,
+			Available:      result.Available,
+			CheckedAt:      result.CheckedAt,
+			Error:          result.Error,
+			ResponseTimeMs: result.ResponseTimeMs,
+			Sources:        docs.sources[result.URL],
+		})
+	}
+	report.Results = append(report.Results, docs.local...)
+	report.FinishedAt = time.Now().Format(time.RFC3339)
+
+	report.Status = "completed"
+	if ctx.Err() != nil {
+		report.Status = "cancelled"
+	}
+
+	if opts.pdf != "" {
+		data, err := pdf.NewGenerator().GenerateReport(ctx, []*storage.LinkBatch{report})
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(opts.pdf, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write PDF: %w", err)
+		}
+	}
+
+	return report, nil
+}
+
+// readURLs reads one URL per line from files, skipping blank lines and
+// # comments. With no files and useStdin set, stdin is read instead.
+func readURLs(files []string, stdin io.Reader, useStdin bool) ([]string, error) {
+	if len(files) == 0 && useStdin {
+		files = []string{"-"}
+	}
+
+	var urls []string
+	for _, name := range files {
+		var r io.Reader = stdin
+		if name != "-" {
+			f, err := os.Open(name)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			urls = append(urls, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+	return urls, nil
+}
+
+func countFailures(results []storage.LinkResult) (failed, total int) {
+	for _, result := range results {
+		if !result.Available {
+			failed++
+		}
+	}
+	return failed, len(results)
+}
+
+// stringList is a flag that may be given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
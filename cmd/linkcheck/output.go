@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"linkChecker/internal/storage"
+)
+
+// Output formats accepted by -format.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+// jsonReport is the -format json output.
+type jsonReport struct {
+	BatchID     string               `json:"batch_id"`
+	Status      string               `json:"status"`
+	Total       int                  `json:"total"`
+	Unavailable int                  `json:"unavailable"`
+	Results     []storage.LinkResult `json:"results"`
+}
+
+func writeResults(w io.Writer, format string, report *storage.LinkBatch) error {
+	switch format {
+	case formatJSON:
+		failed, total := countFailures(report.Results)
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(jsonReport{
+			BatchID:     report.PublicID,
+			Status:      report.Status,
+			Total:       total,
+			Unavailable: failed,
+			Results:     report.Results,
+		})
+	case formatCSV:
+		return writeCSV(w, report.Results)
+	default:
+		return writeTable(w, report.Results)
+	}
+}
+
+func writeTable(w io.Writer, results []storage.LinkResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESULT\tSTATUS\tTIME\tURL\tSOURCE\tERROR")
+	for _, result := range results {
+		outcome := "ok"
+		if !result.Available {
+			outcome = "FAIL"
+		}
+		status := "-"
+		if result.Status != 0 {
+			status = strconv.Itoa(result.Status)
+		}
+		elapsed := "-"
+		if result.ResponseTimeMs > 0 {
+			elapsed = fmt.Sprintf("%dms", result.ResponseTimeMs)
+		}
+		source := "-"
+		if len(result.Sources) > 0 {
+			first := result.Sources[0]
+			source = fmt.Sprintf("%s:%d", first.File, first.Line)
+			if more := len(result.Sources) - 1; more > 0 {
+				source += fmt.Sprintf(" (+%d)", more)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", outcome, status, elapsed, result.URL, source, result.Error)
+	}
+
+	failed, total := countFailures(results)
+	fmt.Fprintf(tw, "\n%d checked, %d available, %d unavailable\n", total, total-failed, failed)
+	return tw.Flush()
+}
+
+func writeCSV(w io.Writer, results []storage.LinkResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"url", "available", "status", "response_time_ms", "error", "checked_at", "sources"})
+	for _, result := range results {
+		cw.Write([]string{
+			result.URL,
+			strconv.FormatBool(result.Available),
+			strconv.Itoa(result.Status),
+			strconv.FormatInt(result.ResponseTimeMs, 10),
+			result.Error,
+			result.CheckedAt,
+			joinSources(result.Sources),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// joinSources formats sources as "file:line" separated by spaces.
+func joinSources(sources []storage.LinkSource) string {
+	parts := make([]string, len(sources))
+	for i, source := range sources {
+		parts[i] = fmt.Sprintf("%s:%d", source.File, source.Line)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"linkChecker/internal/api"
+	"linkChecker/internal/storage"
+)
+
+// client talks to the API of a Link Checker server.
+type client struct {
+	base   string
+	apiKey string
+	http   *http.Client
+}
+
+func newClient(base, apiKey string) *client {
+	return &client{
+		base:   strings.TrimRight(base, "/"),
+		apiKey: apiKey,
+		http:   &http.Client{Timeout: time.Minute},
+	}
+}
+
+// remoteStatus is the part of GET /status the client needs.
+type remoteStatus struct {
+	BatchID  string               `json:"batch_id"`
+	Status   string               `json:"status"`
+	URLs     []string             `json:"urls"`
+	Progress *storage.Progress    `json:"progress"`
+	Results  []storage.LinkResult `json:"results"`
+	storage.BatchMetadata
+}
+
+func (c *client) submit(ctx context.Context, urls []string, meta storage.BatchMetadata, sources map[string][]storage.LinkSource) (string, error) {
+	body, err := json.Marshal(api.CheckLinksRequest{Links: urls, Name: meta.Name, Tags: meta.Tags, Sources: sources})
+	if err != nil {
+		return "", err
+	}
+
+	var response api.CheckLinksResponse
+	if err := c.do(ctx, http.MethodPost, "/check", bytes.NewReader(body), &response); err != nil {
+		return "", err
+	}
+	return response.BatchID, nil
+}
+
+func (c *client) status(ctx context.Context, batchID string) (*remoteStatus, error) {
+	var status remoteStatus
+	if err := c.do(ctx, http.MethodGet, "/status?batch_id="+url.QueryEscape(batchID), nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (c *client) report(ctx context.Context, batchID string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.do(ctx, http.MethodGet, "/report?batch_ids="+url.QueryEscape(batchID), nil, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// do sends a request and decodes a JSON response into out, or copies the
+// body if out is a *bytes.Buffer.
+func (c *client) do(ctx context.Context, method, path string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	if buf, ok := out.(*bytes.Buffer); ok {
+		_, err = buf.ReadFrom(resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// checkRemote submits urls as a batch, waits for it to finish and fetches
+// its results. The relative links of docs are checked locally and reported
+// after them, but are not part of the batch or its PDF report. With
+// -no-wait it prints the batch ID and returns nil, leaving the local
+// results of docs to the caller.
+func checkRemote(ctx context.Context, c *client, opts *options, urls []string, docs *docLinks, stdout, stderr io.Writer) (*storage.LinkBatch, error) {
+	batchID, err := c.submit(ctx, urls, opts.metadata(), docs.sources)
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit batch: %w", err)
+	}
+	if opts.noWait {
+		fmt.Fprintln(stdout, batchID)
+		return nil, nil
+	}
+	fmt.Fprintf(stderr, "Submitted batch %s\n", batchID)
+
+	status, err := c.wait(ctx, batchID, opts, stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.pdf != "" && len(status.Results) > 0 {
+		data, err := c.report(ctx, batchID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch PDF report: %w", err)
+		}
+		if err := os.WriteFile(opts.pdf, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write PDF: %w", err)
+		}
+	}
+
+	return &storage.LinkBatch{
+		PublicID:      status.BatchID,
+		URLs:          status.URLs,
+		Results:       append(status.Results, docs.local...),
+		Status:        status.Status,
+		BatchMetadata: status.BatchMetadata,
+	}, nil
+}
+
+// wait polls the status of a batch until it is no longer pending or
+// processing. Stopping the wait does not cancel the batch on the server.
+func (c *client) wait(ctx context.Context, batchID string, opts *options, stderr io.Writer) (*remoteStatus, error) {
+	if opts.waitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.waitTimeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(opts.pollInterval)
+	defer ticker.Stop()
+
+	lastDone := -1
+	for {
+		status, err := c.status(ctx, batchID)
+		if err != nil && ctx.Err() == nil {
+			return nil, fmt.Errorf("failed to get batch status: %w", err)
+		}
+		if err == nil {
+			if status.Status != "pending" && status.Status != "processing" {
+				return status, nil
+			}
+			if status.Progress != nil && status.Progress.Done != lastDone {
+				lastDone = status.Progress.Done
+				fmt.Fprintf(stderr, "Batch %s %s: %d/%d\n", batchID, status.Status, status.Progress.Done, status.Progress.Total)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("stopped waiting for batch %s, it keeps running on the server: %w", batchID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
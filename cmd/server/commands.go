@@ -0,0 +1,244 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"linkChecker/internal/storage"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// runCommand executes a server subcommand. It reports false when args do not
+// name a subcommand and the server should start as usual.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+
+	var err error
+	switch args[0] {
+	case "export":
+		err = runExport(args[1:])
+	case "import":
+		err = runImport(args[1:])
+	case "migrate":
+		err = runMigrate(args[1:])
+	case "rotate-key":
+		err = runRotateKey(args[1:])
+	case "create-key":
+		err = runCreateKey(args[1:])
+	case "config":
+		err = runConfig(args[1:])
+	default:
+		return false
+	}
+
+	if err != nil {
+		fatal("Command failed", "command", args[0], "error", err)
+	}
+	return true
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("o", "-", "output archive path (- for stdout)")
+	batchIDs := fs.String("batch-ids", "", "comma-separated public batch IDs to export")
+	from := fs.String("from", "", "export batches created at or after this time (RFC3339 or YYYY-MM-DD)")
+	to := fs.String("to", "", "export batches created at or before this time (RFC3339 or YYYY-MM-DD)")
+	cfg, err := configure(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var filter storage.ExportFilter
+	if filter.From, err = storage.ParseTimeBound(*from, false); err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	if filter.To, err = storage.ParseTimeBound(*to, true); err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+
+	store, err := openStorage(cfg, false)
+	if err != nil {
+		return err
+	}
+
+	if *batchIDs != "" {
+		for _, publicID := range strings.Split(*batchIDs, ",") {
+			id, err := store.LookupBatchID(strings.TrimSpace(publicID))
+			if err != nil {
+				return err
+			}
+			filter.BatchIDs = append(filter.BatchIDs, id)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	manifest, err := store.Export(w, filter)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Exported batches", "batches", manifest.BatchCount)
+	return nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	cfg, err := configure(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: import <archive.tar.gz>")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	store, err := openStorage(cfg, false)
+	if err != nil {
+		return err
+	}
+
+	result, err := store.Import(f)
+	if err != nil {
+		return err
+	}
+
+	for oldID, newID := range result.IDMap {
+		slog.Info("Imported batch", "from", oldID, "to", newID)
+	}
+	slog.Info("Imported batches", "batches", result.Imported)
+	return nil
+}
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	cfg, err := configure(fs, args)
+	if err != nil {
+		return err
+	}
+
+	store, err := openStorage(cfg, true)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("All batches are at the current schema version", "batches", len(store.ListAllBatches()), "schema_version", storage.CurrentSchemaVersion)
+	return nil
+}
+
+func runRotateKey(args []string) error {
+	fs := flag.NewFlagSet("rotate-key", flag.ExitOnError)
+	newKeyFile := fs.String("new-key-file", "", "file with the new 32-byte key (raw, base64 or hex)")
+	decrypt := fs.Bool("decrypt", false, "store batches in plaintext instead of re-encrypting them")
+	cfg, err := configure(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if (*newKeyFile == "") == !*decrypt {
+		return fmt.Errorf("exactly one of -new-key-file or -decrypt is required")
+	}
+
+	var newKey []byte
+	if *newKeyFile != "" {
+		var err error
+		if newKey, err = storage.ReadKeyFile(*newKeyFile); err != nil {
+			return err
+		}
+	}
+
+	store, err := openStorage(cfg, false)
+	if err != nil {
+		return err
+	}
+
+	rewritten, err := store.RotateKey(newKey)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Re-encrypted files", "files", rewritten)
+	return nil
+}
+
+// runCreateKey creates an API key, which is how the first admin key is
+// made before the key endpoints can be used.
+func runCreateKey(args []string) error {
+	fs := flag.NewFlagSet("create-key", flag.ExitOnError)
+	name := fs.String("name", "", "name describing who uses the key")
+	role := fs.String("role", storage.RoleReader, "role of the key: reader, submitter, admin or superadmin")
+	tenant := fs.String("tenant", storage.DefaultTenant, "tenant whose batches the key can see")
+	cfg, err := configure(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *name == "" {
+		return fmt.Errorf("-name is required")
+	}
+
+	store, err := openStorage(cfg, false)
+	if err != nil {
+		return err
+	}
+
+	key, secret, err := store.CreateAPIKey(*name, *role, *tenant)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Created API key; store it now, it cannot be shown again", "key", key.ID, "name", key.Name, "role", key.Role, "tenant", key.Tenant)
+	fmt.Println(secret)
+	return nil
+}
+
+// runConfig handles the config subcommands. "config print" writes the
+// effective configuration, after the file, environment and flags are
+// applied, with secrets redacted.
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return fmt.Errorf("usage: config print [-format yaml|toml] [flags]")
+	}
+
+	fs := flag.NewFlagSet("config print", flag.ExitOnError)
+	format := fs.String("format", "yaml", "output format: yaml or toml")
+	cfg, err := loadConfig(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "yaml":
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(cfg.redacted()); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case "toml":
+		return toml.NewEncoder(os.Stdout).Encode(cfg.redacted())
+	default:
+		return fmt.Errorf("invalid -format %q: use yaml or toml", *format)
+	}
+}
@@ -0,0 +1,668 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"linkChecker/internal/api"
+	"linkChecker/internal/checker"
+	"linkChecker/internal/jobs"
+	"linkChecker/internal/logging"
+	"linkChecker/internal/netguard"
+	"linkChecker/internal/storage"
+	"linkChecker/internal/tracing"
+	"linkChecker/internal/webhook"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configEnv names the config file when -config is not given.
+const configEnv = "LINKCHECKER_CONFIG"
+
+// Config is the whole configuration of the server. It starts from
+// defaultConfig and is overridden, in order, by a YAML or TOML file, by
+// LINKCHECKER_* environment variables and by command-line flags.
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Checker   CheckerConfig   `yaml:"checker" toml:"checker"`
+	Jobs      JobsConfig      `yaml:"jobs" toml:"jobs"`
+	Limits    LimitsConfig    `yaml:"limits" toml:"limits"`
+	Quota     QuotaConfig     `yaml:"quota" toml:"quota"`
+	Retention RetentionConfig `yaml:"retention" toml:"retention"`
+	Webhooks  WebhooksConfig  `yaml:"webhooks" toml:"webhooks"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+}
+
+type ServerConfig struct {
+	Addr    string `yaml:"addr" toml:"addr"`
+	DataDir string `yaml:"data_dir" toml:"data_dir"`
+	// RewriteMigrated stores batches migrated from an older schema right
+	// away instead of on their next update.
+	RewriteMigrated bool     `yaml:"rewrite_migrated" toml:"rewrite_migrated"`
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+type CheckerConfig struct {
+	Timeout      Duration `yaml:"timeout" toml:"timeout"`
+	DialTimeout  Duration `yaml:"dial_timeout" toml:"dial_timeout"`
+	MaxRedirects int      `yaml:"max_redirects" toml:"max_redirects"`
+	UserAgent    string   `yaml:"user_agent" toml:"user_agent"`
+	// Headers are "Name: value" entries sent with every check.
+	Headers headerList `yaml:"headers" toml:"headers"`
+	// BlockPrivate, AllowNetworks and DenyNetworks restrict the addresses
+	// checks and webhooks connect to, see netguard.Policy.
+	BlockPrivate  bool     `yaml:"block_private" toml:"block_private"`
+	AllowNetworks []string `yaml:"allow_networks" toml:"allow_networks"`
+	DenyNetworks  []string `yaml:"deny_networks" toml:"deny_networks"`
+}
+
+type JobsConfig struct {
+	Batches          int `yaml:"batches" toml:"batches"`
+	Requests         int `yaml:"requests" toml:"requests"`
+	RequestsPerBatch int `yaml:"requests_per_batch" toml:"requests_per_batch"`
+}
+
+type LimitsConfig struct {
+	MaxBodyBytes int64   `yaml:"max_body_bytes" toml:"max_body_bytes"`
+	MaxLinks     int     `yaml:"max_links" toml:"max_links"`
+	MaxURLLength int     `yaml:"max_url_length" toml:"max_url_length"`
+	IPRate       float64 `yaml:"ip_rate" toml:"ip_rate"`
+	IPBurst      int     `yaml:"ip_burst" toml:"ip_burst"`
+	KeyRate      float64 `yaml:"key_rate" toml:"key_rate"`
+	KeyBurst     int     `yaml:"key_burst" toml:"key_burst"`
+}
+
+// QuotaConfig applies to every tenant without a quota set via PUT /tenants.
+type QuotaConfig struct {
+	MaxURLsPerBatch  int `yaml:"max_urls_per_batch" toml:"max_urls_per_batch"`
+	MaxBatchesPerDay int `yaml:"max_batches_per_day" toml:"max_batches_per_day"`
+}
+
+type RetentionConfig struct {
+	MaxAge          Duration `yaml:"max_age" toml:"max_age"`
+	MaxBatches      int      `yaml:"max_batches" toml:"max_batches"`
+	MaxDiskBytes    int64    `yaml:"max_disk_bytes" toml:"max_disk_bytes"`
+	KeepLastPerTag  int      `yaml:"keep_last_per_tag" toml:"keep_last_per_tag"`
+	Downsample      bool     `yaml:"downsample" toml:"downsample"`
+	JanitorInterval Duration `yaml:"janitor_interval" toml:"janitor_interval"`
+}
+
+type WebhooksConfig struct {
+	URLs             []string `yaml:"urls" toml:"urls"`
+	Secret           string   `yaml:"secret" toml:"secret"`
+	FailureThreshold float64  `yaml:"failure_threshold" toml:"failure_threshold"`
+	MaxAttempts      int      `yaml:"max_attempts" toml:"max_attempts"`
+	InitialBackoff   Duration `yaml:"initial_backoff" toml:"initial_backoff"`
+	Timeout          Duration `yaml:"timeout" toml:"timeout"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level"`
+	Format string `yaml:"format" toml:"format"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter"`
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint"`
+	File        string  `yaml:"file" toml:"file"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+func defaultConfig() *Config {
+	checks := checker.DefaultOptions()
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":8080",
+			DataDir:         "data",
+			RewriteMigrated: true,
+			ShutdownTimeout: Duration(30 * time.Second),
+		},
+		Checker: CheckerConfig{
+			Timeout:      Duration(checks.Timeout),
+			DialTimeout:  Duration(checks.DialTimeout),
+			MaxRedirects: checks.MaxRedirects,
+			UserAgent:    checks.UserAgent,
+		},
+		Jobs: JobsConfig{
+			Batches:          16,
+			Requests:         100,
+			RequestsPerBatch: 25,
+		},
+		Limits: LimitsConfig{
+			MaxBodyBytes: 4 << 20,
+			MaxLinks:     10000,
+			MaxURLLength: 2048,
+			IPRate:       20,
+			IPBurst:      40,
+			KeyRate:      10,
+			KeyBurst:     20,
+		},
+		Quota: QuotaConfig{
+			MaxURLsPerBatch:  5000,
+			MaxBatchesPerDay: 1000,
+		},
+		Retention: RetentionConfig{
+			// Nothing is purged unless a limit is configured.
+			KeepLastPerTag:  5,
+			Downsample:      true,
+			JanitorInterval: Duration(time.Hour),
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts:    5,
+			InitialBackoff: Duration(2 * time.Second),
+			Timeout:        Duration(10 * time.Second),
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: logging.FormatText,
+		},
+		Tracing: TracingConfig{
+			Exporter:    tracing.ExporterNone,
+			SampleRatio: 1,
+		},
+	}
+}
+
+// setting ties a field of Config to its flag and environment variable.
+type setting struct {
+	// name is the flag, section.key as in the config file.
+	name string
+	// env overrides the LINKCHECKER_SECTION_KEY name derived from name,
+	// for variables that predate the config file.
+	env   string
+	usage string
+	value any
+}
+
+func (s setting) envName() string {
+	if s.env != "" {
+		return s.env
+	}
+	return "LINKCHECKER_" + strings.ToUpper(strings.ReplaceAll(s.name, ".", "_"))
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"server.addr", "", "address to listen on", &c.Server.Addr},
+		{"server.data_dir", "", "directory holding batches, keys and other state", &c.Server.DataDir},
+		{"server.rewrite_migrated", "", "store batches migrated from an older schema on startup", &c.Server.RewriteMigrated},
+		{"server.shutdown_timeout", "", "how long to wait for running batches on shutdown", &c.Server.ShutdownTimeout},
+
+		{"checker.timeout", "", "timeout of one URL check, redirects included", &c.Checker.Timeout},
+		{"checker.dial_timeout", "", "timeout for connecting to a host", &c.Checker.DialTimeout},
+		{"checker.max_redirects", "", "redirect a check fails on (N-1 are followed)", &c.Checker.MaxRedirects},
+		{"checker.user_agent", "", "User-Agent sent to checked hosts", &c.Checker.UserAgent},
+		{"checker.headers", "", `"Name: value" header sent to checked hosts, repeat for more (newline-separated in env)`, &c.Checker.Headers},
+		{"checker.block_private", "", "refuse checks of private, loopback and link-local addresses", &c.Checker.BlockPrivate},
+		{"checker.allow_networks", "", "comma-separated CIDRs checks and webhooks may always reach", &c.Checker.AllowNetworks},
+		{"checker.deny_networks", "", "comma-separated CIDRs checks and webhooks may not reach", &c.Checker.DenyNetworks},
+
+		{"jobs.batches", "", "batches checked at once", &c.Jobs.Batches},
+		{"jobs.requests", "", "URLs checked at once across all batches", &c.Jobs.Requests},
+		{"jobs.requests_per_batch", "", "most of jobs.requests one batch may use, 0 for no cap", &c.Jobs.RequestsPerBatch},
+
+		{"limits.max_body_bytes", "", "largest JSON request body, 0 for no limit", &c.Limits.MaxBodyBytes},
+		{"limits.max_links", "", "most links in one batch or monitor, 0 for no limit", &c.Limits.MaxLinks},
+		{"limits.max_url_length", "", "longest URL accepted, 0 for no limit", &c.Limits.MaxURLLength},
+		{"limits.ip_rate", "", "requests per second per client IP, 0 for no limit", &c.Limits.IPRate},
+		{"limits.ip_burst", "", "burst of requests per client IP", &c.Limits.IPBurst},
+		{"limits.key_rate", "", "requests per second per API key, 0 for no limit", &c.Limits.KeyRate},
+		{"limits.key_burst", "", "burst of requests per API key", &c.Limits.KeyBurst},
+
+		{"quota.max_urls_per_batch", "", "default tenant quota of URLs per batch, 0 for no limit", &c.Quota.MaxURLsPerBatch},
+		{"quota.max_batches_per_day", "", "default tenant quota of batches per 24 hours, 0 for no limit", &c.Quota.MaxBatchesPerDay},
+
+		{"retention.max_age", "", "purge finished batches older than this, 0 to keep them", &c.Retention.MaxAge},
+		{"retention.max_batches", "", "most finished batches kept, 0 for no limit", &c.Retention.MaxBatches},
+		{"retention.max_disk_bytes", "", "most bytes of batch files kept, 0 for no limit", &c.Retention.MaxDiskBytes},
+		{"retention.keep_last_per_tag", "", "newest batches of every tag that are never purged", &c.Retention.KeepLastPerTag},
+		{"retention.downsample", "", "fold purged batches into daily summaries", &c.Retention.Downsample},
+		{"retention.janitor_interval", "", "how often the retention policy is enforced", &c.Retention.JanitorInterval},
+
+		{"webhooks.urls", "LINKCHECKER_WEBHOOK_URLS", "comma-separated URLs notified about every batch", &c.Webhooks.URLs},
+		{"webhooks.secret", "LINKCHECKER_WEBHOOK_SECRET", "HMAC-SHA256 key for signing webhook payloads", &c.Webhooks.Secret},
+		{"webhooks.failure_threshold", "LINKCHECKER_WEBHOOK_FAILURE_THRESHOLD", "share of broken links that triggers a webhook, 0 to disable", &c.Webhooks.FailureThreshold},
+		{"webhooks.max_attempts", "", "attempts per webhook delivery", &c.Webhooks.MaxAttempts},
+		{"webhooks.initial_backoff", "", "wait before the first retry of a delivery, doubled for each further one", &c.Webhooks.InitialBackoff},
+		{"webhooks.timeout", "", "timeout of one webhook request", &c.Webhooks.Timeout},
+
+		{"log.level", "", "debug, info, warn or error", &c.Log.Level},
+		{"log.format", "", "text or json", &c.Log.Format},
+
+		{"tracing.exporter", "LINKCHECKER_TRACE_EXPORTER", "none, otlp, stdout or file", &c.Tracing.Exporter},
+		{"tracing.endpoint", "LINKCHECKER_TRACE_ENDPOINT", "OTLP/HTTP collector URL or host:port", &c.Tracing.Endpoint},
+		{"tracing.file", "LINKCHECKER_TRACE_FILE", "file for the file trace exporter", &c.Tracing.File},
+		{"tracing.sample_ratio", "LINKCHECKER_TRACE_SAMPLE_RATIO", "share of new traces recorded", &c.Tracing.SampleRatio},
+	}
+}
+
+// reloadable lists the settings a running server applies when the
+// configuration is reloaded. The rest are read once at startup.
+var reloadable = map[string]bool{
+	"checker.timeout":            true,
+	"checker.dial_timeout":       true,
+	"checker.max_redirects":      true,
+	"checker.user_agent":         true,
+	"checker.headers":            true,
+	"checker.block_private":      true,
+	"checker.allow_networks":     true,
+	"checker.deny_networks":      true,
+	"limits.max_body_bytes":      true,
+	"limits.max_links":           true,
+	"limits.max_url_length":      true,
+	"limits.ip_rate":             true,
+	"limits.ip_burst":            true,
+	"limits.key_rate":            true,
+	"limits.key_burst":           true,
+	"webhooks.urls":              true,
+	"webhooks.secret":            true,
+	"webhooks.failure_threshold": true,
+	"webhooks.max_attempts":      true,
+	"webhooks.initial_backoff":   true,
+	"webhooks.timeout":           true,
+	"log.level":                  true,
+}
+
+// bind registers a flag for every setting, with the current values of c
+// as defaults.
+func (c *Config) bind(fs *flag.FlagSet) {
+	for _, s := range c.settings() {
+		usage := fmt.Sprintf("%s (env %s)", s.usage, s.envName())
+		if reloadable[s.name] {
+			usage = fmt.Sprintf("%s (env %s, reloadable)", s.usage, s.envName())
+		}
+		switch v := s.value.(type) {
+		case *string:
+			fs.StringVar(v, s.name, *v, usage)
+		case *bool:
+			fs.BoolVar(v, s.name, *v, usage)
+		case *int:
+			fs.IntVar(v, s.name, *v, usage)
+		case *int64:
+			fs.Int64Var(v, s.name, *v, usage)
+		case *float64:
+			fs.Float64Var(v, s.name, *v, usage)
+		case *Duration:
+			fs.Var(v, s.name, usage)
+		case *[]string:
+			fs.Var((*listValue)(v), s.name, usage)
+		case *headerList:
+			fs.Var(&headerFlag{list: v}, s.name, usage)
+		default:
+			panic(fmt.Sprintf("config: unsupported type %T of %s", v, s.name))
+		}
+	}
+}
+
+// loadConfig builds the configuration from the file named by -config or
+// LINKCHECKER_CONFIG, the environment and the flags in args. fs may
+// already hold flags of a subcommand; they are parsed along the way.
+func loadConfig(fs *flag.FlagSet, args []string) (*Config, error) {
+	path := fs.String("config", os.Getenv(configEnv), fmt.Sprintf("YAML or TOML config file (env %s)", configEnv))
+	// The first pass only finds the file and which flags were given; the
+	// flags are applied again once the file and environment are loaded.
+	defaultConfig().bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := defaultConfig()
+	if *path != "" {
+		if err := cfg.readFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	// The environment and the flags are set through flag sets of their
+	// own, so a repeated flag replaces the values of the previous source
+	// instead of adding to them.
+	env := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	env.SetOutput(io.Discard)
+	cfg.bind(env)
+
+	for _, s := range cfg.settings() {
+		if value, ok := os.LookupEnv(s.envName()); ok {
+			if err := env.Set(s.name, value); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.envName(), err)
+			}
+		}
+	}
+
+	final := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+	final.SetOutput(io.Discard)
+	cfg.bind(final)
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		if final.Lookup(f.Name) == nil || flagErr != nil {
+			return
+		}
+		if err := final.Set(f.Name, f.Value.String()); err != nil {
+			flagErr = fmt.Errorf("-%s: %w", f.Name, err)
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readFile loads a config file over c. The format follows the extension:
+// .yaml, .yml or .toml. Unknown keys are errors, so typos do not go
+// unnoticed.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("invalid config %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("invalid config %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("config %s must end in .yaml, .yml or .toml", path)
+	}
+
+	return nil
+}
+
+// validate reports every setting that is out of range.
+func (c *Config) validate() error {
+	var errs []error
+	check := func(ok bool, name, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s %s", name, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr", "must not be empty")
+	check(c.Server.DataDir != "", "server.data_dir", "must not be empty")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive, got %v", c.Server.ShutdownTimeout)
+
+	check(c.Checker.Timeout > 0 && c.Checker.Timeout <= Duration(5*time.Minute), "checker.timeout", "must be above 0 and at most 5m, got %v", c.Checker.Timeout)
+	check(c.Checker.DialTimeout > 0, "checker.dial_timeout", "must be positive, got %v", c.Checker.DialTimeout)
+	check(c.Checker.MaxRedirects >= 0, "checker.max_redirects", "must not be negative, got %d", c.Checker.MaxRedirects)
+	check(strings.TrimSpace(c.Checker.UserAgent) != "", "checker.user_agent", "must not be empty")
+	if headers, err := parseHeaders(c.Checker.Headers); err != nil {
+		errs = append(errs, fmt.Errorf("checker.headers: %w", err))
+	} else if err := checker.ValidateHeaders(headers); err != nil {
+		errs = append(errs, fmt.Errorf("checker.headers: %w", err))
+	}
+	if _, err := netguard.ParsePrefixes(c.Checker.AllowNetworks); err != nil {
+		errs = append(errs, fmt.Errorf("checker.allow_networks: %w", err))
+	}
+	if _, err := netguard.ParsePrefixes(c.Checker.DenyNetworks); err != nil {
+		errs = append(errs, fmt.Errorf("checker.deny_networks: %w", err))
+	}
+
+	check(c.Jobs.Batches > 0, "jobs.batches", "must be positive, got %d", c.Jobs.Batches)
+	check(c.Jobs.Requests > 0, "jobs.requests", "must be positive, got %d", c.Jobs.Requests)
+	check(c.Jobs.RequestsPerBatch >= 0, "jobs.requests_per_batch", "must not be negative, got %d", c.Jobs.RequestsPerBatch)
+
+	check(c.Limits.MaxBodyBytes >= 0, "limits.max_body_bytes", "must not be negative, got %d", c.Limits.MaxBodyBytes)
+	check(c.Limits.MaxLinks >= 0, "limits.max_links", "must not be negative, got %d", c.Limits.MaxLinks)
+	check(c.Limits.MaxURLLength >= 0, "limits.max_url_length", "must not be negative, got %d", c.Limits.MaxURLLength)
+	check(c.Limits.IPRate >= 0, "limits.ip_rate", "must not be negative, got %v", c.Limits.IPRate)
+	check(c.Limits.IPRate == 0 || c.Limits.IPBurst > 0, "limits.ip_burst", "must be positive when limits.ip_rate is set, got %d", c.Limits.IPBurst)
+	check(c.Limits.KeyRate >= 0, "limits.key_rate", "must not be negative, got %v", c.Limits.KeyRate)
+	check(c.Limits.KeyRate == 0 || c.Limits.KeyBurst > 0, "limits.key_burst", "must be positive when limits.key_rate is set, got %d", c.Limits.KeyBurst)
+
+	check(c.Quota.MaxURLsPerBatch >= 0, "quota.max_urls_per_batch", "must not be negative, got %d", c.Quota.MaxURLsPerBatch)
+	check(c.Quota.MaxBatchesPerDay >= 0, "quota.max_batches_per_day", "must not be negative, got %d", c.Quota.MaxBatchesPerDay)
+
+	check(c.Retention.MaxAge >= 0, "retention.max_age", "must not be negative, got %v", c.Retention.MaxAge)
+	check(c.Retention.MaxBatches >= 0, "retention.max_batches", "must not be negative, got %d", c.Retention.MaxBatches)
+	check(c.Retention.MaxDiskBytes >= 0, "retention.max_disk_bytes", "must not be negative, got %d", c.Retention.MaxDiskBytes)
+	check(c.Retention.KeepLastPerTag >= 0, "retention.keep_last_per_tag", "must not be negative, got %d", c.Retention.KeepLastPerTag)
+	check(c.Retention.JanitorInterval > 0, "retention.janitor_interval", "must be positive, got %v", c.Retention.JanitorInterval)
+
+	for _, u := range c.Webhooks.URLs {
+		check(strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://"), "webhooks.urls", "must be http or https URLs, got %q", u)
+	}
+	check(c.Webhooks.FailureThreshold >= 0 && c.Webhooks.FailureThreshold <= 1, "webhooks.failure_threshold", "must be between 0 and 1, got %v", c.Webhooks.FailureThreshold)
+	check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts", "must be positive, got %d", c.Webhooks.MaxAttempts)
+	check(c.Webhooks.InitialBackoff > 0, "webhooks.initial_backoff", "must be positive, got %v", c.Webhooks.InitialBackoff)
+	check(c.Webhooks.Timeout > 0, "webhooks.timeout", "must be positive, got %v", c.Webhooks.Timeout)
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %w", err))
+	}
+	check(c.Log.Format == logging.FormatText || c.Log.Format == logging.FormatJSON, "log.format", "must be text or json, got %q", c.Log.Format)
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	case tracing.ExporterFile:
+		check(c.Tracing.File != "", "tracing.file", "is required by the file exporter")
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter must be none, otlp, stdout or file, got %q", c.Tracing.Exporter))
+	}
+	check(c.Tracing.SampleRatio > 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio", "must be above 0 and at most 1, got %v", c.Tracing.SampleRatio)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func (c *Config) checkerOptions() checker.Options {
+	// validate has already refused headers and networks that do not parse.
+	headers, _ := parseHeaders(c.Checker.Headers)
+	return checker.Options{
+		Timeout:      time.Duration(c.Checker.Timeout),
+		DialTimeout:  time.Duration(c.Checker.DialTimeout),
+		MaxRedirects: c.Checker.MaxRedirects,
+		// The server checks every URL through the job queue, so
+		// jobs.requests is what bounds requests at once.
+		Concurrency: c.Jobs.Requests,
+		UserAgent:   c.Checker.UserAgent,
+		Headers:     headers,
+		Network:     c.networkPolicy(),
+	}
+}
+
+// networkPolicy restricts the addresses checks connect to.
+func (c *Config) networkPolicy() netguard.Policy {
+	allow, _ := netguard.ParsePrefixes(c.Checker.AllowNetworks)
+	deny, _ := netguard.ParsePrefixes(c.Checker.DenyNetworks)
+	return netguard.Policy{BlockPrivate: c.Checker.BlockPrivate, Allow: allow, Deny: deny}
+}
+
+// parseHeaders turns "Name: value" entries into a header.
+func parseHeaders(entries []string) (http.Header, error) {
+	headers := make(http.Header, len(entries))
+	for _, entry := range entries {
+		name, value, found := strings.Cut(entry, ":")
+		if !found {
+			return nil, fmt.Errorf("%q must look like \"Name: value\"", entry)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return headers, nil
+}
+
+func (c *Config) jobLimits() jobs.Limits {
+	return jobs.Limits{
+		Batches:          c.Jobs.Batches,
+		Requests:         c.Jobs.Requests,
+		RequestsPerBatch: c.Jobs.RequestsPerBatch,
+	}
+}
+
+func (c *Config) apiLimits() api.Limits {
+	return api.Limits{
+		MaxBodyBytes: c.Limits.MaxBodyBytes,
+		MaxLinks:     c.Limits.MaxLinks,
+		MaxURLLength: c.Limits.MaxURLLength,
+		IPRate:       c.Limits.IPRate,
+		IPBurst:      c.Limits.IPBurst,
+		KeyRate:      c.Limits.KeyRate,
+		KeyBurst:     c.Limits.KeyBurst,
+	}
+}
+
+func (c *Config) tenantQuota() storage.TenantQuota {
+	return storage.TenantQuota{
+		MaxURLsPerBatch:  c.Quota.MaxURLsPerBatch,
+		MaxBatchesPerDay: c.Quota.MaxBatchesPerDay,
+	}
+}
+
+func (c *Config) retentionPolicy() storage.RetentionPolicy {
+	return storage.RetentionPolicy{
+		MaxAge:         time.Duration(c.Retention.MaxAge),
+		MaxBatches:     c.Retention.MaxBatches,
+		MaxDiskBytes:   c.Retention.MaxDiskBytes,
+		KeepLastPerTag: c.Retention.KeepLastPerTag,
+		Downsample:     c.Retention.Downsample,
+	}
+}
+
+func (c *Config) webhookConfig() webhook.Config {
+	return webhook.Config{
+		URLs:             c.Webhooks.URLs,
+		Secret:           c.Webhooks.Secret,
+		FailureThreshold: c.Webhooks.FailureThreshold,
+		MaxAttempts:      c.Webhooks.MaxAttempts,
+		InitialBackoff:   time.Duration(c.Webhooks.InitialBackoff),
+		Timeout:          time.Duration(c.Webhooks.Timeout),
+		Network:          c.webhookNetwork(),
+	}
+}
+
+// webhookNetwork applies the allow and deny lists of checks to webhooks.
+// checker.block_private is left out: configured webhook URLs are trusted,
+// and targets registered by batches are always kept off private addresses.
+func (c *Config) webhookNetwork() netguard.Policy {
+	network := c.networkPolicy()
+	network.BlockPrivate = false
+	return network
+}
+
+func (c *Config) traceOptions() tracing.Options {
+	return tracing.Options{
+		Exporter:    c.Tracing.Exporter,
+		Endpoint:    c.Tracing.Endpoint,
+		File:        c.Tracing.File,
+		SampleRatio: c.Tracing.SampleRatio,
+	}
+}
+
+func (c *Config) logOptions() logging.Options {
+	return logging.Options{Level: c.Log.Level, Format: c.Log.Format}
+}
+
+// redacted returns a copy of c that is safe to print.
+func (c *Config) redacted() *Config {
+	copied := *c
+	if copied.Webhooks.Secret != "" {
+		copied.Webhooks.Secret = "<redacted>"
+	}
+	// Header values often carry tokens.
+	copied.Checker.Headers = nil
+	for _, entry := range c.Checker.Headers {
+		name, _, _ := strings.Cut(entry, ":")
+		copied.Checker.Headers = append(copied.Checker.Headers, name+": <redacted>")
+	}
+	return &copied
+}
+
+// Duration is a time.Duration written as "90s" or "1h30m" in config files
+// and flags.
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	return d.Set(string(text))
+}
+
+// listValue is a comma-separated flag or environment variable.
+type listValue []string
+
+func (l *listValue) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// headerList holds "Name: value" headers. Header values may contain
+// commas, so unlike listValue it is never split on them.
+type headerList []string
+
+// headerFlag sets a headerList from a flag that may be repeated, one
+// header per occurrence, or from newline-separated headers as the
+// environment gives them. The first value replaces the list, later ones
+// add to it.
+type headerFlag struct {
+	list *headerList
+	set  bool
+}
+
+func (h *headerFlag) String() string {
+	if h.list == nil {
+		return ""
+	}
+	return strings.Join(*h.list, "\n")
+}
+
+func (h *headerFlag) Set(value string) error {
+	if !h.set {
+		*h.list = nil
+		h.set = true
+	}
+	for _, header := range strings.Split(value, "\n") {
+		if header = strings.TrimSpace(header); header != "" {
+			*h.list = append(*h.list, header)
+		}
+	}
+	return nil
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"errors"
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,47 +14,156 @@ import (
 
 	"linkChecker/internal/api"
 	"linkChecker/internal/checker"
+	"linkChecker/internal/events"
+	"linkChecker/internal/jobs"
+	"linkChecker/internal/logging"
+	"linkChecker/internal/metrics"
 	"linkChecker/internal/pdf"
+	"linkChecker/internal/scheduler"
 	"linkChecker/internal/storage"
+	"linkChecker/internal/tracing"
+	"linkChecker/internal/webhook"
 )
 
 const (
-	port    = ":8080"
-	dataDir = "data"
-	timeout = 10 * time.Second
+	encryptionKeyEnv     = "LINKCHECKER_ENCRYPTION_KEY"
+	encryptionKeyFileEnv = "LINKCHECKER_ENCRYPTION_KEY_FILE"
 )
 
 func main() {
-	log.Println("Starting Link Checker Server...")
+	if runCommand(os.Args[1:]) {
+		return
+	}
 
-	store, err := storage.NewStorage(dataDir)
+	cfg, err := configure(flag.CommandLine, os.Args[1:])
 	if err != nil {
-		log.Fatalf("Failed to initialize storage: %v", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected argument %q\n", flag.Arg(0))
+		os.Exit(2)
 	}
-	log.Println("Storage initialized successfully")
 
-	pendingBatches := store.ListPendingBatches()
-	if len(pendingBatches) > 0 {
-		log.Printf("Found %d pending batches to resume\n", len(pendingBatches))
-		resumeProcessing(store, pendingBatches)
+	slog.Info("Starting Link Checker Server")
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.traceOptions())
+	if err != nil {
+		fatal("Failed to initialize tracing", "error", err)
 	}
 
-	linkChecker, err := checker.NewLinkChecker(timeout)
+	store, err := openStorage(cfg, cfg.Server.RewriteMigrated)
+	if errors.Is(err, storage.ErrUnknownSchemaVersion) {
+		fatal("Refusing to start: data was written by a newer server", "data_dir", cfg.Server.DataDir, "error", err)
+	}
+	if errors.Is(err, storage.ErrEncryptionKeyMissing) {
+		fatal("Refusing to start: data is encrypted, set "+encryptionKeyEnv+" or "+encryptionKeyFileEnv, "data_dir", cfg.Server.DataDir, "error", err)
+	}
+	if errors.Is(err, storage.ErrNotEncrypted) {
+		fatal("Refusing to start: data is not encrypted, encrypt it with rotate-key first", "data_dir", cfg.Server.DataDir, "error", err)
+	}
+	if errors.Is(err, storage.ErrWrongEncryptionKey) {
+		fatal("Refusing to start: the configured encryption key cannot decrypt the data", "data_dir", cfg.Server.DataDir, "error", err)
+	}
 	if err != nil {
-		log.Fatalf("Failed to initialize link checker: %v", err)
+		fatal("Failed to initialize storage", "error", err)
+	}
+	slog.Info("Storage initialized", "data_dir", cfg.Server.DataDir)
+
+	linkChecker, err := checker.NewLinkCheckerWithOptions(cfg.checkerOptions())
+	if err != nil {
+		fatal("Failed to initialize link checker", "error", err)
 	}
 	pdfGen := pdf.NewGenerator()
+	dispatcher := webhook.NewDispatcher(cfg.webhookConfig(), store)
+	if resumed := dispatcher.ResumePending(); resumed > 0 {
+		slog.Info("Resumed pending webhook deliveries", "deliveries", resumed)
+	}
 
-	handler := api.NewHandler(linkChecker, store, pdfGen)
+	broker := events.NewBroker(events.DefaultHistorySize)
+	jobManager := jobs.NewManager(linkChecker, store, broker, dispatcher, cfg.jobLimits())
+
+	pendingBatches := store.ListPendingBatches()
+	if len(pendingBatches) > 0 {
+		slog.Info("Found pending batches to resume", "batches", len(pendingBatches))
+		resumeProcessing(jobManager, pendingBatches)
+	}
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	jobManager.Run(workersCtx)
+
+	monitorScheduler := scheduler.New(store, jobManager)
+
+	handler := api.NewHandler(jobManager, store, pdfGen, broker, dispatcher, monitorScheduler, cfg.apiLimits())
+
+	reloads := &reloader{
+		args:     os.Args[1:],
+		current:  cfg,
+		checker:  linkChecker,
+		handler:  handler,
+		webhooks: dispatcher,
+	}
+	handler.SetReloader(reloads.Reload)
+
+	reader := func(next http.HandlerFunc) http.HandlerFunc { return handler.Require(storage.RoleReader, next) }
+	submitter := func(next http.HandlerFunc) http.HandlerFunc { return handler.Require(storage.RoleSubmitter, next) }
+	admin := func(next http.HandlerFunc) http.HandlerFunc { return handler.Require(storage.RoleAdmin, next) }
+	superadmin := func(next http.HandlerFunc) http.HandlerFunc { return handler.Require(storage.RoleSuperadmin, next) }
 
 	http.HandleFunc("/health", handler.HandleHealth)
-	http.HandleFunc("/check", handler.HandleCheckLinks)
-	http.HandleFunc("/report", handler.HandleGetReport)
-	http.HandleFunc("/status", handler.HandleGetStatus)
+	http.HandleFunc("/check", submitter(handler.HandleCheckLinks))
+	http.HandleFunc("POST /extract", submitter(handler.HandleExtract))
+	http.HandleFunc("/report", reader(handler.HandleGetReport))
+	http.HandleFunc("/status", reader(handler.HandleGetStatus))
+	http.HandleFunc("/diff", reader(handler.HandleDiff))
+	http.HandleFunc("/batches", reader(handler.HandleListBatches))
+	http.HandleFunc("POST /batches/{id}/cancel", submitter(handler.HandleCancelBatch))
+	http.HandleFunc("DELETE /batches/{id}", admin(handler.HandleDeleteBatch))
+	http.HandleFunc("GET /batches/{id}/events", reader(handler.HandleBatchEvents))
+	http.HandleFunc("GET /webhooks/deliveries", reader(handler.HandleListDeliveries))
+	http.HandleFunc("GET /webhooks/deliveries/{id}", reader(handler.HandleGetDelivery))
+	http.HandleFunc("POST /webhooks/deliveries/{id}/replay", admin(handler.HandleReplayDelivery))
+	http.HandleFunc("GET /monitors", reader(handler.HandleListMonitors))
+	http.HandleFunc("POST /monitors", admin(handler.HandleCreateMonitor))
+	http.HandleFunc("GET /monitors/{id}", reader(handler.HandleGetMonitor))
+	http.HandleFunc("PUT /monitors/{id}", admin(handler.HandleUpdateMonitor))
+	http.HandleFunc("DELETE /monitors/{id}", admin(handler.HandleDeleteMonitor))
+	http.HandleFunc("POST /monitors/{id}/pause", admin(handler.HandlePauseMonitor))
+	http.HandleFunc("POST /monitors/{id}/resume", admin(handler.HandleResumeMonitor))
+	http.HandleFunc("POST /monitors/{id}/run", submitter(handler.HandleRunMonitor))
+	http.HandleFunc("/retention", superadmin(handler.HandleGetRetention))
+	http.HandleFunc("/export", admin(handler.HandleExport))
+	http.HandleFunc("/import", superadmin(handler.HandleImport))
+	http.HandleFunc("GET /keys", admin(handler.HandleListAPIKeys))
+	http.HandleFunc("POST /keys", admin(handler.HandleCreateAPIKey))
+	http.HandleFunc("POST /keys/{id}/revoke", admin(handler.HandleRevokeAPIKey))
+	http.HandleFunc("GET /tenants", admin(handler.HandleListTenants))
+	http.HandleFunc("PUT /tenants/{name}", superadmin(handler.HandleSetTenantQuota))
+	http.HandleFunc("GET /limits", superadmin(handler.HandleGetLimits))
+	http.HandleFunc("POST /config/reload", superadmin(handler.HandleReloadConfig))
+	http.HandleFunc("GET /metrics", reader(metrics.Default.Handler()))
+
+	registerMetrics(store, jobManager, handler)
+
+	if !store.HasAPIKeys() {
+		slog.Warn("No API keys configured, every endpoint except /health will refuse requests; create one with: server create-key -name admin -role superadmin")
+	}
+
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	defer stopJanitor()
+	store.StartJanitor(janitorCtx, cfg.retentionPolicy(), time.Duration(cfg.Retention.JanitorInterval))
+
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	monitorScheduler.Start(schedulerCtx)
+	if monitors := store.ListMonitors(); len(monitors) > 0 {
+		slog.Info("Scheduled monitors", "monitors", len(monitors))
+	}
 
 	server := &http.Server{
-		Addr:         port,
-		Handler:      http.DefaultServeMux,
+		Addr:         cfg.Server.Addr,
+		Handler:      api.LogRequests(api.Trace(api.Instrument(handler.LimitClients(http.DefaultServeMux)))),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -61,59 +172,123 @@ func main() {
 	shutdownChan := make(chan os.Signal, 1)
 	signal.Notify(shutdownChan, syscall.SIGINT, syscall.SIGTERM)
 
+	reloadChan := make(chan os.Signal, 1)
+	signal.Notify(reloadChan, syscall.SIGHUP)
 	go func() {
-		log.Printf("Server started on http://localhost:%s", port)
+		for range reloadChan {
+			reloads.Reload()
+		}
+	}()
+
+	go func() {
+		slog.Info("Server started", "addr", cfg.Server.Addr)
 		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("Server error: %v", err)
+			fatal("Server error", "error", err)
 		}
 	}()
 
 	sig := <-shutdownChan
-	log.Printf("\nReceived signal: %v", sig)
+	slog.Info("Received signal", "signal", sig.String())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
 	defer cancel()
 
-	log.Println("Shutting down server gracefully...")
+	slog.Info("Shutting down server gracefully")
+
+	stopJanitor()
+	stopScheduler()
+	stopWorkers()
 
 	store.WaitForCompletion(ctx)
 
+	if err := dispatcher.Shutdown(ctx); err != nil {
+		slog.Error("Webhook deliveries did not stop in time", "error", err)
+	}
+
 	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("Server shutdown error: %v", err)
+		slog.Error("Server shutdown error", "error", err)
+	}
+
+	// Traces are flushed last so spans of the final requests are exported.
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
 	}
 
-	log.Println("Server stopped")
+	slog.Info("Server stopped")
+}
+
+// configure loads the configuration from args and the environment and sets
+// up logging accordingly.
+func configure(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := logging.Setup(os.Stderr, cfg.logOptions()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-func resumeProcessing(store *storage.Storage, pendingBatches []*storage.LinkBatch) {
-	linkChecker, err := checker.NewLinkChecker(timeout)
+// openStorage opens the configured data directory with the encryption key
+// taken from the environment, if one is configured. The key is deliberately
+// not part of Config, so it never ends up in a config file or its output.
+func openStorage(cfg *Config, rewrite bool) (*storage.Storage, error) {
+	key, err := loadEncryptionKey()
 	if err != nil {
-		log.Fatalf("Failed to initialize link checker: %v", err)
+		return nil, err
 	}
 
+	return storage.NewStorageWithOptions(cfg.Server.DataDir, storage.Options{
+		RewriteMigrated: rewrite,
+		EncryptionKey:   key,
+		DefaultQuota:    cfg.tenantQuota(),
+	})
+}
+
+func loadEncryptionKey() ([]byte, error) {
+	if value := os.Getenv(encryptionKeyEnv); value != "" {
+		return storage.ParseKey([]byte(value))
+	}
+	if path := os.Getenv(encryptionKeyFileEnv); path != "" {
+		return storage.ReadKeyFile(path)
+	}
+	return nil, nil
+}
+
+// registerMetrics exposes state kept by other components, read on every
+// scrape of /metrics.
+func registerMetrics(store *storage.Storage, jobManager *jobs.Manager, handler *api.Handler) {
+	metrics.Default.NewGaugeFunc("linkchecker_queue_depth", "Batches waiting for a worker.", "", func() map[string]float64 {
+		return map[string]float64{"": float64(jobManager.QueueLength())}
+	})
+	metrics.Default.NewGaugeFunc("linkchecker_batches", "Stored batches by status.", "status", func() map[string]float64 {
+		counts := make(map[string]float64)
+		for status, count := range store.CountBatchesByStatus() {
+			counts[status] = float64(count)
+		}
+		return counts
+	})
+	metrics.Default.NewCounterFunc("linkchecker_requests_rejected_total", "Requests refused by size and rate limits, by reason.", "reason", func() map[string]float64 {
+		counts := make(map[string]float64)
+		for reason, count := range handler.Rejections() {
+			counts[reason] = float64(count)
+		}
+		return counts
+	})
+}
+
+// fatal logs msg with args at error level and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func resumeProcessing(jobManager *jobs.Manager, pendingBatches []*storage.LinkBatch) {
 	for _, batch := range pendingBatches {
-		go func(b *storage.LinkBatch) {
-			log.Printf("Resuming batch %d with %d links\n", b.BatchID, len(b.URLs))
-
-			store.UpdateBatch(b.BatchID, []storage.LinkResult{}, "processing")
-
-			results := linkChecker.CheckLinks(b.URLs)
-
-			// Convert checker results to storage LinkResult format
-			var linkResults []storage.LinkResult
-			for _, result := range results {
-				linkResult := storage.LinkResult{
-					URL:       result.URL,
-					Status:    result.Status,
-					Available: result.Available,
-					CheckedAt: result.CheckedAt,
-					Error:     result.Error,
-				}
-				linkResults = append(linkResults, linkResult)
-			}
-
-			store.UpdateBatch(b.BatchID, linkResults, "completed")
-			log.Printf("Batch %d completed\n", b.BatchID)
-		}(batch)
+		slog.Info("Resuming batch", "batch_id", batch.PublicID, "checked", len(batch.Results), "urls", len(batch.URLs))
+		if err := jobManager.Enqueue(context.Background(), batch.BatchID); err != nil {
+			slog.Error("Failed to resume batch", "batch_id", batch.PublicID, "error", err)
+		}
 	}
 }
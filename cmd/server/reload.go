@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log/slog"
+	"reflect"
+	"sync"
+
+	"linkChecker/internal/api"
+	"linkChecker/internal/checker"
+	"linkChecker/internal/logging"
+	"linkChecker/internal/webhook"
+)
+
+// reloader re-reads the configuration of a running server from the same
+// file, environment and flags it started with, and applies the reloadable
+// settings to the components that use them.
+type reloader struct {
+	mu       sync.Mutex
+	args     []string
+	current  *Config
+	checker  *checker.LinkChecker
+	handler  *api.Handler
+	webhooks *webhook.Dispatcher
+}
+
+func (r *reloader) Reload() (api.ConfigReload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	next, err := loadConfig(fs, r.args)
+	if err != nil {
+		slog.Error("Configuration reload failed", "error", err)
+		return api.ConfigReload{}, err
+	}
+
+	result := api.ConfigReload{Applied: []string{}, RestartRequired: []string{}}
+	current, updated := r.current.settings(), next.settings()
+	for i, s := range updated {
+		running := reflect.ValueOf(current[i].value).Elem()
+		value := reflect.ValueOf(s.value).Elem()
+		if reflect.DeepEqual(running.Interface(), value.Interface()) {
+			continue
+		}
+		if reloadable[s.name] {
+			result.Applied = append(result.Applied, s.name)
+		} else {
+			// Keep the startup value, so next describes what is running.
+			value.Set(running)
+			result.RestartRequired = append(result.RestartRequired, s.name)
+		}
+	}
+
+	// The checker goes first as the only component that can refuse its
+	// settings; after it nothing fails halfway.
+	if err := r.checker.Reconfigure(next.checkerOptions()); err != nil {
+		slog.Error("Configuration reload failed", "error", err)
+		return api.ConfigReload{}, err
+	}
+	r.handler.SetLimits(next.apiLimits())
+	r.webhooks.Reconfigure(next.webhookConfig())
+	if level, err := logging.ParseLevel(next.Log.Level); err == nil {
+		logging.SetLevel(level)
+	}
+	r.current = next
+
+	slog.Info("Configuration reloaded", "applied", result.Applied)
+	if len(result.RestartRequired) > 0 {
+		slog.Warn("Changed settings take effect after a restart", "settings", result.RestartRequired)
+	}
+	return result, nil
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"linkChecker/internal/storage"
+)
+
+const maxImportBytes = 256 << 20
+
+func (h *Handler) HandleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := h.parseExportFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var buf bytes.Buffer
+	manifest, err := h.storage.Export(&buf, filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to export batches: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if manifest.BatchCount == 0 {
+		http.Error(w, "No batches found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"batches_%d.tar.gz\"", time.Now().Unix()))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+
+	w.Write(buf.Bytes())
+}
+
+func (h *Handler) HandleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	result, err := h.storage.Import(r.Body)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, storage.ErrInvalidArchive) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, fmt.Sprintf("Failed to import archive: %v", err), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *Handler) parseExportFilter(r *http.Request) (storage.ExportFilter, error) {
+	// A superadmin exports batches of every tenant, other admins only those
+	// of their own.
+	filter := storage.ExportFilter{Tenant: adminTenant(r)}
+	query := r.URL.Query()
+
+	for _, publicID := range parseBatchIDs(query.Get("batch_ids")) {
+		batchID, err := h.lookupExportBatch(filter.Tenant, publicID)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid batch_id: %s", publicID)
+		}
+		filter.BatchIDs = append(filter.BatchIDs, batchID)
+	}
+
+	var err error
+	if filter.From, err = storage.ParseTimeBound(query.Get("from"), false); err != nil {
+		return filter, fmt.Errorf("Invalid from: %v", err)
+	}
+	if filter.To, err = storage.ParseTimeBound(query.Get("to"), true); err != nil {
+		return filter, fmt.Errorf("Invalid to: %v", err)
+	}
+
+	return filter, nil
+}
+
+func (h *Handler) lookupExportBatch(tenant, publicID string) (int64, error) {
+	if tenant == "" {
+		return h.storage.LookupBatchID(publicID)
+	}
+	batch, err := h.storage.GetTenantBatch(tenant, publicID)
+	if err != nil {
+		return 0, err
+	}
+	return batch.BatchID, nil
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"linkChecker/internal/storage"
+)
+
+type apiKeyContextKey struct{}
+
+// Require wraps next so that it only runs for requests carrying an active
+// API key with at least the given role. The key is read from
+// "Authorization: Bearer <key>" or the X-API-Key header. Each key is also
+// rate limited by Limits.KeyRate.
+func (h *Handler) Require(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret := requestAPIKey(r)
+		if secret == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="linkchecker"`)
+			http.Error(w, "API key required", http.StatusUnauthorized)
+			return
+		}
+
+		key, err := h.storage.AuthenticateAPIKey(secret)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="linkchecker", error="invalid_token"`)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		if !storage.RoleAllows(key.Role, role) {
+			http.Error(w, fmt.Sprintf("This endpoint requires the %s role", role), http.StatusForbidden)
+			return
+		}
+
+		if ok, wait := h.limits.Load().key.Allow(strconv.FormatInt(key.ID, 10)); !ok {
+			h.rejected.add(RejectKeyRateLimited)
+			writeRateLimited(w, wait, "Too many requests for this API key")
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	}
+}
+
+// APIKeyFromContext returns the key that authenticated the request, if any.
+func APIKeyFromContext(ctx context.Context) (*storage.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(*storage.APIKey)
+	return key, ok
+}
+
+// requestKeyID is the ID of the key that authenticated r, or 0.
+func requestKeyID(r *http.Request) int64 {
+	if key, ok := APIKeyFromContext(r.Context()); ok {
+		return key.ID
+	}
+	return 0
+}
+
+// requestTenant is the tenant of the key that authenticated r. Every batch
+// the request creates or reads belongs to it.
+func requestTenant(r *http.Request) string {
+	if key, ok := APIKeyFromContext(r.Context()); ok {
+		return key.Tenant
+	}
+	return storage.DefaultTenant
+}
+
+// adminTenant is the tenant whose keys, quotas and batches an admin request
+// may manage, or "" for a superadmin, who manages every tenant.
+func adminTenant(r *http.Request) string {
+	if key, ok := APIKeyFromContext(r.Context()); ok && key.Role == storage.RoleSuperadmin {
+		return ""
+	}
+	return requestTenant(r)
+}
+
+func requestAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token, found := strings.Cut(auth, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	// Tenant defaults to the tenant of the key making the request. Only a
+	// superadmin may name another tenant.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// APIKeyResponse describes a key without its hash. Key holds the secret and
+// is only returned once, when the key is created.
+type APIKeyResponse struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	Tenant    string `json:"tenant"`
+	Hint      string `json:"hint"`
+	CreatedAt string `json:"created_at"`
+	RevokedAt string `json:"revoked_at,omitempty"`
+	Key       string `json:"key,omitempty"`
+}
+
+func newAPIKeyResponse(key *storage.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Role:      key.Role,
+		Tenant:    key.Tenant,
+		Hint:      key.Hint,
+		CreatedAt: key.CreatedAt,
+		RevokedAt: key.RevokedAt,
+	}
+}
+
+func (h *Handler) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys := h.storage.ListAPIKeys(adminTenant(r))
+	response := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, newAPIKeyResponse(key))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"keys": response})
+}
+
+func (h *Handler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if !h.decodeBody(w, r, &req) {
+		return
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "Invalid request: name is required", http.StatusBadRequest)
+		return
+	}
+
+	// Superadmin keys are made with the create-key command only, so no key
+	// can raise itself above its tenant.
+	if req.Role == storage.RoleSuperadmin {
+		http.Error(w, "Superadmin keys can only be created with the create-key command", http.StatusForbidden)
+		return
+	}
+	if req.Tenant == "" {
+		req.Tenant = requestTenant(r)
+	}
+	if tenant := adminTenant(r); tenant != "" && req.Tenant != tenant {
+		http.Error(w, "Keys can only be created for your own tenant", http.StatusForbidden)
+		return
+	}
+
+	key, secret, err := h.storage.CreateAPIKey(req.Name, req.Role, req.Tenant)
+	if errors.Is(err, storage.ErrInvalidRole) || errors.Is(err, storage.ErrInvalidTenant) {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create API key: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := newAPIKeyResponse(key)
+	response.Key = secret
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func (h *Handler) HandleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid key id", http.StatusBadRequest)
+		return
+	}
+
+	// Keys of other tenants look like they do not exist.
+	tenant := adminTenant(r)
+	key, err := h.storage.GetAPIKey(tenant, keyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if caller, ok := APIKeyFromContext(r.Context()); ok && !storage.RoleAllows(caller.Role, key.Role) {
+		http.Error(w, fmt.Sprintf("Revoking a %s key requires the %s role", key.Role, key.Role), http.StatusForbidden)
+		return
+	}
+
+	key, err = h.storage.RevokeAPIKey(tenant, keyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newAPIKeyResponse(key))
+}
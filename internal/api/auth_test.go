@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"linkChecker/internal/storage"
+)
+
+func TestRequire(t *testing.T) {
+	store, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(nil, store, nil, nil, nil, nil, Limits{})
+
+	secrets := make(map[string]string)
+	for _, role := range []string{storage.RoleReader, storage.RoleSubmitter, storage.RoleAdmin, storage.RoleSuperadmin} {
+		_, secret, err := store.CreateAPIKey(role, role, "acme")
+		if err != nil {
+			t.Fatal(err)
+		}
+		secrets[role] = secret
+	}
+	revoked, revokedSecret, err := store.CreateAPIKey("old", storage.RoleSuperadmin, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.RevokeAPIKey("", revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		required string
+		header   string
+		value    string
+		want     int
+	}{
+		{name: "no key", required: storage.RoleReader, want: http.StatusUnauthorized},
+		{name: "unknown key", required: storage.RoleReader, header: "X-API-Key", value: "lc_unknown", want: http.StatusUnauthorized},
+		{name: "revoked key", required: storage.RoleReader, header: "X-API-Key", value: revokedSecret, want: http.StatusUnauthorized},
+		{name: "other scheme", required: storage.RoleReader, header: "Authorization", value: "Basic " + secrets[storage.RoleSuperadmin], want: http.StatusUnauthorized},
+		{name: "reader reads", required: storage.RoleReader, header: "Authorization", value: "Bearer " + secrets[storage.RoleReader], want: http.StatusOK},
+		{name: "reader submits", required: storage.RoleSubmitter, header: "Authorization", value: "Bearer " + secrets[storage.RoleReader], want: http.StatusForbidden},
+		{name: "submitter submits", required: storage.RoleSubmitter, header: "X-API-Key", value: secrets[storage.RoleSubmitter], want: http.StatusOK},
+		{name: "submitter administers", required: storage.RoleAdmin, header: "X-API-Key", value: secrets[storage.RoleSubmitter], want: http.StatusForbidden},
+		{name: "admin reads", required: storage.RoleReader, header: "X-API-Key", value: secrets[storage.RoleAdmin], want: http.StatusOK},
+		{name: "admin needs superadmin", required: storage.RoleSuperadmin, header: "X-API-Key", value: secrets[storage.RoleAdmin], want: http.StatusForbidden},
+		{name: "superadmin administers", required: storage.RoleAdmin, header: "X-API-Key", value: secrets[storage.RoleSuperadmin], want: http.StatusOK},
+		{name: "superadmin", required: storage.RoleSuperadmin, header: "Authorization", value: "bearer " + secrets[storage.RoleSuperadmin], want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var key *storage.APIKey
+			handler := h.Require(tt.required, func(w http.ResponseWriter, r *http.Request) {
+				key, _ = APIKeyFromContext(r.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/batches", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+			if tt.want == http.StatusOK && (key == nil || key.Tenant != "acme") {
+				t.Errorf("key in context = %+v, want an acme key", key)
+			}
+		})
+	}
+}
+
+func TestAdminTenant(t *testing.T) {
+	tests := []struct {
+		name string
+		key  *storage.APIKey
+		want string
+	}{
+		{name: "no key", want: storage.DefaultTenant},
+		{name: "admin", key: &storage.APIKey{Role: storage.RoleAdmin, Tenant: "acme"}, want: "acme"},
+		{name: "superadmin", key: &storage.APIKey{Role: storage.RoleSuperadmin, Tenant: "acme"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/keys", nil)
+		if tt.key != nil {
+			req = req.WithContext(context.WithValue(req.Context(), apiKeyContextKey{}, tt.key))
+		}
+		if got := adminTenant(req); got != tt.want {
+			t.Errorf("%s: adminTenant = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
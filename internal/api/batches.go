@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"linkChecker/internal/jobs"
+	"linkChecker/internal/storage"
+)
+
+const cancelWaitTimeout = 30 * time.Second
+
+func (h *Handler) HandleListBatches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseBatchFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Tenant = requestTenant(r)
+
+	query := r.URL.Query()
+	opts := storage.ListOptions{
+		Filter: filter,
+		SortBy: query.Get("sort"),
+		Cursor: query.Get("cursor"),
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		http.Error(w, fmt.Sprintf("Invalid order: %s", order), http.StatusBadRequest)
+		return
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid limit: %s", limitStr), http.StatusBadRequest)
+			return
+		}
+		opts.Limit = limit
+	}
+
+	page, err := h.storage.ListBatchSummaries(opts)
+	if errors.Is(err, storage.ErrInvalidCursor) || errors.Is(err, storage.ErrInvalidSort) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list batches: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (h *Handler) HandleCancelBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := h.storage.GetTenantBatch(requestTenant(r), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Batch not found: %v", err), http.StatusNotFound)
+		return
+	}
+	batchID := batch.BatchID
+
+	ctx, cancel := context.WithTimeout(r.Context(), cancelWaitTimeout)
+	defer cancel()
+
+	if err := h.jobs.Cancel(ctx, batchID); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, jobs.ErrFinished) || errors.Is(err, jobs.ErrNotRunning) {
+			status = http.StatusConflict
+		}
+		http.Error(w, fmt.Sprintf("Failed to cancel batch: %v", err), status)
+		return
+	}
+
+	batch, err = h.storage.GetBatch(batchID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Batch not found: %v", err), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(StatusResponse{
+		BatchID:       batch.PublicID,
+		Status:        batch.Status,
+		URLs:          batch.URLs,
+		Results:       batch.Results,
+		BatchMetadata: batch.BatchMetadata,
+	})
+}
+
+func (h *Handler) HandleDeleteBatch(w http.ResponseWriter, r *http.Request) {
+	batch, err := h.storage.GetTenantBatch(requestTenant(r), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Batch not found: %v", err), http.StatusNotFound)
+		return
+	}
+	batchID := batch.BatchID
+
+	ctx, cancel := context.WithTimeout(r.Context(), cancelWaitTimeout)
+	defer cancel()
+
+	if err := h.jobs.Delete(ctx, batchID); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete batch: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
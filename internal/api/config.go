@@ -0,0 +1,40 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ConfigReload reports which changed settings a reload applied and which
+// keep their old value until the server restarts.
+type ConfigReload struct {
+	Applied         []string `json:"applied"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// Reloader re-reads the configuration and applies what it can to the
+// running server. Nothing is applied if the configuration is invalid.
+type Reloader func() (ConfigReload, error)
+
+// SetReloader enables POST /config/reload.
+func (h *Handler) SetReloader(reload Reloader) {
+	h.reload = reload
+}
+
+// HandleReloadConfig reloads the configuration, as SIGHUP does.
+func (h *Handler) HandleReloadConfig(w http.ResponseWriter, r *http.Request) {
+	if h.reload == nil {
+		http.Error(w, "Configuration reload is not available", http.StatusNotImplemented)
+		return
+	}
+
+	result, err := h.reload()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reload configuration: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"linkChecker/internal/storage"
+)
+
+// HandleDiff compares two batches: GET /diff?from=A&to=B. format=pdf returns
+// the comparison as a PDF report instead of JSON.
+func (h *Handler) HandleDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+
+	var batches [2]*storage.LinkBatch
+	for i, param := range []string{"from", "to"} {
+		batchID := query.Get(param)
+		if batchID == "" {
+			http.Error(w, fmt.Sprintf("Invalid %s: a batch_id is required", param), http.StatusBadRequest)
+			return
+		}
+
+		batch, err := h.storage.GetTenantBatch(requestTenant(r), batchID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Batch not found: %v", err), http.StatusNotFound)
+			return
+		}
+		batches[i] = batch
+	}
+
+	opts := storage.DefaultDiffOptions
+	if value := query.Get("latency_factor"); value != "" {
+		factor, err := strconv.ParseFloat(value, 64)
+		if err != nil || factor <= 1 {
+			http.Error(w, fmt.Sprintf("Invalid latency_factor: %s", value), http.StatusBadRequest)
+			return
+		}
+		opts.LatencyFactor = factor
+	}
+	if value := query.Get("latency_min_ms"); value != "" {
+		delta, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || delta < 0 {
+			http.Error(w, fmt.Sprintf("Invalid latency_min_ms: %s", value), http.StatusBadRequest)
+			return
+		}
+		opts.MinLatencyDeltaMs = delta
+	}
+
+	diff := storage.DiffBatches(batches[0], batches[1], opts)
+
+	switch format := query.Get("format"); format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(diff)
+	case "pdf":
+		pdfData, err := h.pdf.GenerateDiffReport(r.Context(), diff)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to generate PDF: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"diff_%s_%s.pdf\"", diff.From.PublicID, diff.To.PublicID))
+		w.Header().Set("Content-Length", strconv.Itoa(len(pdfData)))
+		w.Write(pdfData)
+	default:
+		http.Error(w, fmt.Sprintf("Invalid format: %s", format), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"linkChecker/internal/events"
+	"linkChecker/internal/jobs"
+)
+
+const sseHeartbeatInterval = 15 * time.Second
+
+// HandleBatchEvents streams the progress of a batch as Server-Sent Events.
+// Reconnecting clients resume after the ID in the Last-Event-ID header
+// (or the last_event_id query parameter).
+func (h *Handler) HandleBatchEvents(w http.ResponseWriter, r *http.Request) {
+	var lastEventID int64
+	lastEventIDStr := r.Header.Get("Last-Event-ID")
+	if lastEventIDStr == "" {
+		lastEventIDStr = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventIDStr != "" {
+		var err error
+		if lastEventID, err = strconv.ParseInt(lastEventIDStr, 10, 64); err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	batch, err := h.storage.GetTenantBatch(requestTenant(r), r.PathValue("id"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Batch not found: %v", err), http.StatusNotFound)
+		return
+	}
+
+	running := batch.Status == "pending" || batch.Status == "processing"
+	replay, stream, unsubscribe, ok := h.events.Subscribe(batch.BatchID, lastEventID, running)
+	defer unsubscribe()
+
+	rc := http.NewResponseController(w)
+	// Streams outlive the server's write timeout.
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if !ok {
+		// The batch finished before this process saw it; only its outcome is known.
+		progress := batch.Progress(time.Now())
+		writeEvent(w, events.Event{Type: jobs.EventComplete, Data: jobs.CompleteEvent{Status: batch.Status, Progress: progress}})
+		rc.Flush()
+		return
+	}
+
+	for _, event := range replay {
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	rc.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			rc.Flush()
+		case event, open := <-stream:
+			if !open {
+				return
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			rc.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	if event.ID > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
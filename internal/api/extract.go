@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"linkChecker/internal/extract"
+)
+
+type ExtractResponse struct {
+	// BatchID is empty for dry runs and when no links were found.
+	BatchID   string              `json:"batch_id,omitempty"`
+	Documents int                 `json:"documents"`
+	External  int                 `json:"external"`
+	Local     int                 `json:"local"`
+	Skipped   int                 `json:"skipped"`
+	Broken    []extract.LocalLink `json:"broken"`
+}
+
+// HandleExtract scans an uploaded zip or tar.gz archive of Markdown, HTML,
+// RST and AsciiDoc files. Relative links are checked against the archive
+// right away and stored as results of a batch; its external links are then
+// checked like any other. Results say where each link was found. Query
+// parameters name, owner and tags (comma separated) describe the batch;
+// dry_run=true only scans.
+func (h *Handler) HandleExtract(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	tree, err := extract.ReadArchive(r.Body)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		h.rejected.add(RejectBodyTooLarge)
+		http.Error(w, fmt.Sprintf("Archive must be at most %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, extract.ErrInvalidArchive):
+		http.Error(w, fmt.Sprintf("Failed to read archive: %v", err), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Failed to read archive: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	report := tree.Scan()
+	response := ExtractResponse{
+		Documents: report.Documents,
+		External:  len(report.External),
+		Local:     len(report.Local),
+		Skipped:   report.Skipped,
+		Broken:    report.Broken(),
+	}
+
+	query := r.URL.Query()
+	links, sources := report.ExternalURLs()
+	local := report.LocalResults(time.Now())
+	if len(links)+len(local) > 0 && query.Get("dry_run") != "true" {
+		// Local links are part of the batch, after the external ones, and
+		// already have their results.
+		urls := append(make([]string, 0, len(links)+len(local)), links...)
+		for _, result := range local {
+			urls = append(urls, result.URL)
+		}
+		if !h.checkLinks(w, urls) {
+			return
+		}
+
+		req := CheckLinksRequest{
+			Links:   links,
+			Name:    query.Get("name"),
+			Owner:   query.Get("owner"),
+			Sources: sources,
+		}
+		if tags := query.Get("tags"); tags != "" {
+			req.Tags = strings.Split(tags, ",")
+		}
+		meta, err := req.metadata()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		meta.APIKeyID = requestKeyID(r)
+		meta.Tenant = requestTenant(r)
+
+		batchID, err := h.jobs.Submit(r.Context(), urls, meta, nil, 0, req.sources(), local)
+		if err != nil {
+			writeSubmitError(w, err)
+			return
+		}
+		batch, err := h.storage.GetBatch(batchID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Batch not found: %v", err), http.StatusNotFound)
+			return
+		}
+		response.BatchID = batch.PublicID
+
+		slog.InfoContext(r.Context(), "Batch submitted", "batch_id", batch.PublicID, "links", len(links), "local", len(local), "documents", report.Documents, "tenant", meta.Tenant, "api_key", meta.APIKeyID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -1,38 +1,156 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"linkChecker/internal/checker"
+	"linkChecker/internal/events"
+	"linkChecker/internal/jobs"
 	"linkChecker/internal/pdf"
+	"linkChecker/internal/scheduler"
 	"linkChecker/internal/storage"
+	"linkChecker/internal/webhook"
 )
 
 type Handler struct {
-	checker *checker.LinkChecker
-	storage *storage.Storage
-	pdf     *pdf.Generator
+	jobs      *jobs.Manager
+	storage   *storage.Storage
+	pdf       *pdf.Generator
+	events    *events.Broker
+	webhooks  *webhook.Dispatcher
+	scheduler *scheduler.Scheduler
+
+	limits   atomic.Pointer[limitState]
+	rejected rejections
+	reload   Reloader
 }
 
-func NewHandler(checker *checker.LinkChecker, storage *storage.Storage, pdfGen *pdf.Generator) *Handler {
-	return &Handler{
-		checker: checker,
-		storage: storage,
-		pdf:     pdfGen,
+func NewHandler(jobs *jobs.Manager, storage *storage.Storage, pdfGen *pdf.Generator, broker *events.Broker, webhooks *webhook.Dispatcher, monitors *scheduler.Scheduler, limits Limits) *Handler {
+	h := &Handler{
+		jobs:      jobs,
+		storage:   storage,
+		pdf:       pdfGen,
+		events:    broker,
+		webhooks:  webhooks,
+		scheduler: monitors,
+		rejected:  newRejections(),
 	}
+	h.SetLimits(limits)
+	return h
 }
 
 type CheckLinksRequest struct {
-	Links []string `json:"links"`
+	Links  []string          `json:"links"`
+	Name   string            `json:"name,omitempty"`
+	Tags   []string          `json:"tags,omitempty"`
+	Owner  string            `json:"owner,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	Webhooks         []string `json:"webhooks,omitempty"`
+	FailureThreshold float64  `json:"failure_threshold,omitempty"`
+
+	// Priority ranges from jobs.MinPriority to jobs.MaxPriority; higher
+	// batches are queued first and get a bigger share of the checker.
+	Priority int `json:"priority,omitempty"`
+
+	// Sources tells where links were found, such as the files POST /extract
+	// reads them from. Each result carries the sources of its link.
+	Sources map[string][]storage.LinkSource `json:"sources,omitempty"`
+}
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// fingerprint identifies the body of a request for idempotency checks. It
+// hashes the decoded request, so formatting and field order do not matter.
+func (req CheckLinksRequest) fingerprint() string {
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// sources returns the sources of links that are part of the request.
+func (req CheckLinksRequest) sources() map[string][]storage.LinkSource {
+	if len(req.Sources) == 0 {
+		return nil
+	}
+	sources := make(map[string][]storage.LinkSource)
+	for _, link := range req.Links {
+		if found, ok := req.Sources[link]; ok {
+			sources[link] = found
+		}
+	}
+	return sources
+}
+
+func (req CheckLinksRequest) priority() (int, error) {
+	if req.Priority < jobs.MinPriority || req.Priority > jobs.MaxPriority {
+		return 0, fmt.Errorf("priority must be between %d and %d", jobs.MinPriority, jobs.MaxPriority)
+	}
+	return req.Priority, nil
+}
+
+func (req CheckLinksRequest) notifySettings() (*storage.NotifySettings, error) {
+	if req.FailureThreshold < 0 || req.FailureThreshold > 1 {
+		return nil, fmt.Errorf("failure_threshold must be between 0 and 1")
+	}
+
+	for _, target := range req.Webhooks {
+		parsed, err := url.Parse(target)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid webhook URL: %s", target)
+		}
+	}
+
+	if len(req.Webhooks) == 0 && req.FailureThreshold == 0 {
+		return nil, nil
+	}
+
+	return &storage.NotifySettings{
+		URLs:             req.Webhooks,
+		FailureThreshold: req.FailureThreshold,
+	}, nil
+}
+
+func (req CheckLinksRequest) metadata() (storage.BatchMetadata, error) {
+	meta := storage.BatchMetadata{
+		Name:  strings.TrimSpace(req.Name),
+		Owner: strings.TrimSpace(req.Owner),
+	}
+
+	for _, tag := range req.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !meta.HasTag(tag) {
+			meta.Tags = append(meta.Tags, tag)
+		}
+	}
+
+	for key, value := range req.Labels {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return meta, fmt.Errorf("label keys must not be empty")
+		}
+		if meta.Labels == nil {
+			meta.Labels = make(map[string]string, len(req.Labels))
+		}
+		meta.Labels[key] = value
+	}
+
+	return meta, nil
 }
 
 type CheckLinksResponse struct {
-	BatchID int64  `json:"batch_id"`
+	BatchID string `json:"batch_id"`
 	Links   any    `json:"links"`
 	Message string `json:"message"`
 }
@@ -44,8 +162,7 @@ func (h *Handler) HandleCheckLinks(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req CheckLinksRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+	if !h.decodeBody(w, r, &req) {
 		return
 	}
 
@@ -53,70 +170,127 @@ func (h *Handler) HandleCheckLinks(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "No links provided", http.StatusBadRequest)
 		return
 	}
+	if !h.checkLinks(w, req.Links) {
+		return
+	}
 
-	batchID := h.storage.SaveBatch(req.Links)
+	meta, err := req.metadata()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	meta.APIKeyID = requestKeyID(r)
+	meta.Tenant = requestTenant(r)
 
-	h.storage.UpdateBatch(batchID, []storage.LinkResult{}, "processing")
+	notify, err := req.notifySettings()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
 
-	go func() {
-		results := h.checker.CheckLinks(req.Links)
+	priority, err := req.priority()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
 
-		// Convert checker results to storage LinkResult format
-		var linkResults []storage.LinkResult
-		for _, result := range results {
-			linkResult := storage.LinkResult{
-				URL:       result.URL,
-				Status:    result.Status,
-				Available: result.Available,
-				CheckedAt: result.CheckedAt,
-				Error:     result.Error,
-			}
-			linkResults = append(linkResults, linkResult)
+	submit := func() (int64, error) {
+		return h.jobs.Submit(r.Context(), req.Links, meta, notify, priority, req.sources(), nil)
+	}
+
+	var batchID int64
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		if len(key) > maxIdempotencyKeyLength {
+			http.Error(w, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength), http.StatusBadRequest)
+			return
+		}
+
+		var replayed bool
+		// Keys are scoped to the API key, so clients cannot collide with
+		// or probe each other's requests.
+		scoped := fmt.Sprintf("%d:%s", meta.APIKeyID, key)
+		batchID, replayed, err = h.storage.ClaimIdempotencyKey(scoped, req.fingerprint(), storage.DefaultIdempotencyTTL, submit)
+		if errors.Is(err, storage.ErrIdempotencyConflict) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if replayed {
+			w.Header().Set("Idempotent-Replayed", "true")
 		}
+	} else {
+		batchID, err = submit()
+	}
+	if err != nil {
+		writeSubmitError(w, err)
+		return
+	}
+
+	batch, err := h.storage.GetBatch(batchID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Batch not found: %v", err), http.StatusNotFound)
+		return
+	}
 
-		h.storage.UpdateBatch(batchID, linkResults, "completed")
-	}()
+	slog.InfoContext(r.Context(), "Batch submitted", "batch_id", batch.PublicID, "links", len(req.Links), "tenant", meta.Tenant, "api_key", meta.APIKeyID)
 
 	w.Header().Set("Content-Type", "application/json")
 	response := CheckLinksResponse{
-		BatchID: batchID,
+		BatchID: batch.PublicID,
 		Links:   req.Links,
 		Message: "Links are being checked. Use batch_id to retrieve the report.",
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
+// writeSubmitError reports why a batch could not be created. Quota errors
+// are the caller's to fix; anything else is a server failure.
+func writeSubmitError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrTooManyURLs):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, storage.ErrDailyQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	default:
+		http.Error(w, fmt.Sprintf("Failed to start batch: %v", err), http.StatusInternalServerError)
+	}
+}
+
 func (h *Handler) HandleGetReport(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	batchIDsStr := r.URL.Query().Get("batch_ids")
-	if batchIDsStr == "" {
-		http.Error(w, "batch_ids parameter is required", http.StatusBadRequest)
+	filter, err := parseBatchFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	filter.Tenant = requestTenant(r)
 
-	batchIDsStrSlice := strings.Split(batchIDsStr, ",")
-	var batchIDs []int64
+	batchIDsStr := r.URL.Query().Get("batch_ids")
+	if batchIDsStr == "" && filter.IsEmpty() {
+		http.Error(w, "batch_ids parameter or a metadata filter is required", http.StatusBadRequest)
+		return
+	}
 
-	for _, idStr := range batchIDsStrSlice {
-		id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid batch_id: %s", idStr), http.StatusBadRequest)
-			return
+	var batches []*storage.LinkBatch
+	if batchIDsStr != "" {
+		for _, batch := range h.storage.GetBatches(filter.Tenant, parseBatchIDs(batchIDsStr)) {
+			if filter.Matches(batch) {
+				batches = append(batches, batch)
+			}
 		}
-		batchIDs = append(batchIDs, id)
+	} else {
+		batches = h.storage.FindBatches(filter)
 	}
 
-	batches, err := h.storage.GetBatches(batchIDs)
-	if err != nil || len(batches) == 0 {
+	if len(batches) == 0 {
 		http.Error(w, "No batches found", http.StatusNotFound)
 		return
 	}
 
-	pdfData, err := h.pdf.GenerateReport(batches)
+	pdfData, err := h.pdf.GenerateReport(r.Context(), batches)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to generate PDF: %v", err), http.StatusInternalServerError)
 		return
@@ -129,11 +303,86 @@ func (h *Handler) HandleGetReport(w http.ResponseWriter, r *http.Request) {
 	w.Write(pdfData)
 }
 
+// parseBatchIDs splits a comma-separated list of public batch IDs.
+func parseBatchIDs(batchIDsStr string) []string {
+	var batchIDs []string
+
+	for _, id := range strings.Split(batchIDsStr, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			batchIDs = append(batchIDs, id)
+		}
+	}
+
+	return batchIDs
+}
+
+// parseBatchFilter reads the batch filter from query parameters. Tags,
+// labels and statuses may be repeated; labels are written as key:value.
+func parseBatchFilter(r *http.Request) (storage.BatchFilter, error) {
+	query := r.URL.Query()
+	filter := storage.BatchFilter{
+		Name:  query.Get("name"),
+		Owner: query.Get("owner"),
+	}
+
+	for _, tags := range query["tag"] {
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				filter.Tags = append(filter.Tags, tag)
+			}
+		}
+	}
+
+	for _, label := range query["label"] {
+		key, value, ok := strings.Cut(label, ":")
+		if !ok || strings.TrimSpace(key) == "" {
+			return filter, fmt.Errorf("Invalid label filter: %s (expected key:value)", label)
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		filter.Labels[strings.TrimSpace(key)] = value
+	}
+
+	for _, statuses := range query["status"] {
+		for _, status := range strings.Split(statuses, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				filter.Statuses = append(filter.Statuses, status)
+			}
+		}
+	}
+
+	var err error
+	if filter.CreatedFrom, err = storage.ParseTimeBound(query.Get("created_from"), false); err != nil {
+		return filter, fmt.Errorf("Invalid created_from: %v", err)
+	}
+	if filter.CreatedTo, err = storage.ParseTimeBound(query.Get("created_to"), true); err != nil {
+		return filter, fmt.Errorf("Invalid created_to: %v", err)
+	}
+
+	filter.ContainsURL = query.Get("url")
+
+	if hasFailures := query.Get("has_failures"); hasFailures != "" {
+		value, err := strconv.ParseBool(hasFailures)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid has_failures: %s", hasFailures)
+		}
+		filter.HasFailures = &value
+	}
+
+	return filter, nil
+}
+
 type StatusResponse struct {
-	BatchID int64    `json:"batch_id"`
-	Status  string   `json:"status"`
-	URLs    []string `json:"urls"`
-	Results any      `json:"results,omitempty"`
+	BatchID  string            `json:"batch_id"`
+	Status   string            `json:"status"`
+	URLs     []string          `json:"urls"`
+	Progress *storage.Progress `json:"progress,omitempty"`
+	// QueuePosition is the 1-based place of a pending batch in the queue.
+	QueuePosition int `json:"queue_position,omitempty"`
+	Priority      int `json:"priority,omitempty"`
+	Results       any `json:"results,omitempty"`
+	storage.BatchMetadata
 }
 
 func (h *Handler) HandleGetStatus(w http.ResponseWriter, r *http.Request) {
@@ -142,38 +391,64 @@ func (h *Handler) HandleGetStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	batchIDStr := r.URL.Query().Get("batch_id")
-	if batchIDStr == "" {
+	batchID := r.URL.Query().Get("batch_id")
+	if batchID == "" {
 		http.Error(w, "batch_id parameter is required", http.StatusBadRequest)
 		return
 	}
 
-	batchID, err := strconv.ParseInt(batchIDStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid batch_id", http.StatusBadRequest)
-		return
-	}
-
-	batch, err := h.storage.GetBatch(batchID)
+	batch, err := h.storage.GetTenantBatch(requestTenant(r), batchID)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Batch not found: %v", err), http.StatusNotFound)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	progress := batch.Progress(time.Now())
 	response := StatusResponse{
-		BatchID: batch.BatchID,
-		Status:  batch.Status,
-		URLs:    batch.URLs,
+		BatchID:       batch.PublicID,
+		Status:        batch.Status,
+		URLs:          batch.URLs,
+		Progress:      &progress,
+		Priority:      batch.Priority,
+		BatchMetadata: batch.BatchMetadata,
 	}
 
-	if batch.Status == "completed" {
+	if position, queued := h.jobs.QueuePosition(batch.BatchID); queued {
+		response.QueuePosition = position
+	}
+
+	if len(batch.Results) > 0 {
 		response.Results = batch.Results
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
+type RetentionResponse struct {
+	LastPurge *storage.PurgeReport   `json:"last_purge"`
+	Summaries []storage.DailySummary `json:"summaries"`
+}
+
+func (h *Handler) HandleGetRetention(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	summaries, err := h.storage.DailySummaries()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read summaries: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RetentionResponse{
+		LastPurge: h.storage.LastPurge(),
+		Summaries: summaries,
+	})
+}
+
 func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
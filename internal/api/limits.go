@@ -0,0 +1,203 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"linkChecker/internal/ratelimit"
+)
+
+// Limits bounds what a single request may ask for and how often clients
+// may call the API. Zero disables a limit.
+type Limits struct {
+	// MaxBodyBytes caps JSON request bodies. Archive uploads to /import are
+	// not affected.
+	MaxBodyBytes int64 `json:"max_body_bytes"`
+	// MaxLinks caps the links of one batch or monitor, on top of the
+	// tenant quota.
+	MaxLinks     int `json:"max_links"`
+	MaxURLLength int `json:"max_url_length"`
+
+	// IPRate is how many requests per second each client IP may make on
+	// average, with bursts of up to IPBurst.
+	IPRate  float64 `json:"ip_rate"`
+	IPBurst int     `json:"ip_burst"`
+	// KeyRate and KeyBurst limit each API key the same way.
+	KeyRate  float64 `json:"key_rate"`
+	KeyBurst int     `json:"key_burst"`
+}
+
+// limitState pairs Limits with the rate limiters built from them, so both
+// are swapped together.
+type limitState struct {
+	Limits
+	ip  *ratelimit.Limiter
+	key *ratelimit.Limiter
+}
+
+// SetLimits replaces the limits of a running handler. A rate limiter whose
+// rate and burst are unchanged is kept, so clients do not get fresh buckets
+// on every reload.
+func (h *Handler) SetLimits(limits Limits) {
+	state := &limitState{Limits: limits}
+	old := h.limits.Load()
+	if old != nil && old.IPRate == limits.IPRate && old.IPBurst == limits.IPBurst {
+		state.ip = old.ip
+	} else {
+		state.ip = ratelimit.New(limits.IPRate, limits.IPBurst)
+	}
+	if old != nil && old.KeyRate == limits.KeyRate && old.KeyBurst == limits.KeyBurst {
+		state.key = old.key
+	} else {
+		state.key = ratelimit.New(limits.KeyRate, limits.KeyBurst)
+	}
+	h.limits.Store(state)
+}
+
+// Limits returns the limits in effect.
+func (h *Handler) Limits() Limits {
+	return h.limits.Load().Limits
+}
+
+// Reasons a request is rejected by Limits.
+const (
+	RejectBodyTooLarge   = "body_too_large"
+	RejectTooManyLinks   = "too_many_links"
+	RejectURLTooLong     = "url_too_long"
+	RejectIPRateLimited  = "ip_rate_limited"
+	RejectKeyRateLimited = "key_rate_limited"
+)
+
+var rejectReasons = []string{
+	RejectBodyTooLarge,
+	RejectTooManyLinks,
+	RejectURLTooLong,
+	RejectIPRateLimited,
+	RejectKeyRateLimited,
+}
+
+// rejections counts requests refused by Limits, per reason.
+type rejections map[string]*atomic.Int64
+
+func newRejections() rejections {
+	counts := make(rejections, len(rejectReasons))
+	for _, reason := range rejectReasons {
+		counts[reason] = new(atomic.Int64)
+	}
+	return counts
+}
+
+func (c rejections) add(reason string) {
+	c[reason].Add(1)
+}
+
+// Snapshot returns the current counts by reason.
+func (c rejections) Snapshot() map[string]int64 {
+	snapshot := make(map[string]int64, len(c))
+	for reason, count := range c {
+		snapshot[reason] = count.Load()
+	}
+	return snapshot
+}
+
+// Rejections returns how many requests were refused by Limits, by reason.
+func (h *Handler) Rejections() map[string]int64 {
+	return h.rejected.Snapshot()
+}
+
+// LimitClients wraps next with the per-IP rate limit. /health is exempt so
+// load balancers are never throttled.
+func (h *Handler) LimitClients(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			if ok, wait := h.limits.Load().ip.Allow(clientIP(r)); !ok {
+				h.rejected.add(RejectIPRateLimited)
+				writeRateLimited(w, wait, "Too many requests from this address")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP is the address the request came from. Forwarding headers are
+// ignored, as they are trivial to forge.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func writeRateLimited(w http.ResponseWriter, wait time.Duration, message string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, message, http.StatusTooManyRequests)
+}
+
+// decodeBody decodes a JSON body of at most Limits.MaxBodyBytes into v,
+// writing the error response if it fails.
+func (h *Handler) decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	if limit := h.Limits().MaxBodyBytes; limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+
+	err := json.NewDecoder(r.Body).Decode(v)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.rejected.add(RejectBodyTooLarge)
+		http.Error(w, fmt.Sprintf("Request body must be at most %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// checkLinks applies MaxLinks and MaxURLLength, writing the error response
+// if links exceed them.
+func (h *Handler) checkLinks(w http.ResponseWriter, links []string) bool {
+	limits := h.Limits()
+	if limits.MaxLinks > 0 && len(links) > limits.MaxLinks {
+		h.rejected.add(RejectTooManyLinks)
+		http.Error(w, fmt.Sprintf("Too many links: %d, at most %d allowed", len(links), limits.MaxLinks), http.StatusRequestEntityTooLarge)
+		return false
+	}
+
+	if limits.MaxURLLength > 0 {
+		for _, link := range links {
+			if len(link) > limits.MaxURLLength {
+				h.rejected.add(RejectURLTooLong)
+				http.Error(w, fmt.Sprintf("Invalid request: URLs must be at most %d characters", limits.MaxURLLength), http.StatusBadRequest)
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+type LimitsResponse struct {
+	Limits
+	Rejected map[string]int64 `json:"rejected"`
+}
+
+// HandleGetLimits shows the configured limits and how many requests they
+// have refused since the server started.
+func (h *Handler) HandleGetLimits(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LimitsResponse{Limits: h.Limits(), Rejected: h.Rejections()})
+}
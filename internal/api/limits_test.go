@@ -0,0 +1,110 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"linkChecker/internal/storage"
+)
+
+func TestLimitClients(t *testing.T) {
+	h := NewHandler(nil, nil, nil, nil, nil, nil, Limits{IPRate: 1, IPBurst: 2})
+	handler := h.LimitClients(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		path   string
+		remote string
+		want   int
+	}{
+		{"/batches", "192.0.2.1:1000", http.StatusOK},
+		{"/batches", "192.0.2.1:1001", http.StatusOK},
+		{"/batches", "192.0.2.1:1002", http.StatusTooManyRequests},
+		{"/health", "192.0.2.1:1003", http.StatusOK},
+		{"/batches", "192.0.2.2:1000", http.StatusOK},
+	}
+
+	for i, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.RemoteAddr = tt.remote
+		// Forwarding headers must not give a client a fresh bucket.
+		req.Header.Set("X-Forwarded-For", "198.51.100.7")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.want {
+			t.Errorf("request %d to %s from %s: status = %d, want %d", i, tt.path, tt.remote, rec.Code, tt.want)
+		}
+		if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "1" {
+			t.Errorf("request %d: Retry-After = %q, want 1", i, rec.Header().Get("Retry-After"))
+		}
+	}
+
+	if got := h.Rejections()[RejectIPRateLimited]; got != 1 {
+		t.Errorf("%d requests counted as rate limited, want 1", got)
+	}
+}
+
+func TestRequireRateLimitsKeys(t *testing.T) {
+	store, err := storage.NewStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, secret, err := store.CreateAPIKey("ci", storage.RoleReader, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(nil, store, nil, nil, nil, nil, Limits{KeyRate: 0.5, KeyBurst: 1})
+	handler := h.Require(storage.RoleReader, func(w http.ResponseWriter, r *http.Request) {})
+	call := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/batches", nil)
+		req.Header.Set("X-API-Key", secret)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	if rec := call(); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d", rec.Code)
+	}
+	rec := call()
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "2" {
+		t.Errorf("second request: status = %d, Retry-After = %q, want 429 and 2", rec.Code, rec.Header().Get("Retry-After"))
+	}
+
+	// Reloading the same rates keeps the empty bucket; new rates start over.
+	h.SetLimits(Limits{KeyRate: 0.5, KeyBurst: 1, MaxLinks: 10})
+	if rec := call(); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("after reloading the same rate: status = %d, want 429", rec.Code)
+	}
+	h.SetLimits(Limits{KeyRate: 0.5, KeyBurst: 2})
+	if rec := call(); rec.Code != http.StatusOK {
+		t.Errorf("after changing the burst: status = %d, want 200", rec.Code)
+	}
+}
+
+func TestDecodeBodyLimit(t *testing.T) {
+	h := NewHandler(nil, nil, nil, nil, nil, nil, Limits{MaxBodyBytes: 16})
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"links": []}`, http.StatusOK},
+		{`{"links": ["https://example.com"]}`, http.StatusRequestEntityTooLarge},
+		{`{"links":`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/check", strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+		var v map[string]any
+		ok := h.decodeBody(rec, req, &v)
+		// A recorder reports 200 until an error is written.
+		if rec.Code != tt.want || ok != (tt.want == http.StatusOK) {
+			t.Errorf("body %s: status = %d, want %d", tt.body, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"linkChecker/internal/metrics"
+)
+
+// statusRecorder remembers the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, which
+// the event stream needs for flushing.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Instrument counts requests and their latency per route. It must wrap the
+// ServeMux, which sets the matched pattern on the request; requests that
+// match no route, or are rejected before routing, are labelled "unmatched".
+func Instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		handler := r.Pattern
+		if handler == "" {
+			handler = "unmatched"
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		metrics.HTTPRequests.Inc(handler, r.Method, strconv.Itoa(rec.status))
+		metrics.HTTPDuration.Observe(time.Since(started).Seconds(), handler)
+	})
+}
@@ -0,0 +1,271 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"linkChecker/internal/scheduler"
+	"linkChecker/internal/storage"
+)
+
+// MonitorRequest defines a monitor: the fields of a check request plus a
+// schedule given as either a cron expression or an interval.
+type MonitorRequest struct {
+	CheckLinksRequest
+	Cron     string `json:"cron,omitempty"`
+	Interval string `json:"interval,omitempty"`
+	Paused   bool   `json:"paused,omitempty"`
+}
+
+func (req MonitorRequest) monitor() (*storage.Monitor, error) {
+	if len(req.Links) == 0 {
+		return nil, fmt.Errorf("no links provided")
+	}
+
+	meta, err := req.metadata()
+	if err != nil {
+		return nil, err
+	}
+
+	notify, err := req.notifySettings()
+	if err != nil {
+		return nil, err
+	}
+
+	priority, err := req.priority()
+	if err != nil {
+		return nil, err
+	}
+
+	return &storage.Monitor{
+		URLs:          req.Links,
+		Cron:          req.Cron,
+		Interval:      req.Interval,
+		Paused:        req.Paused,
+		Priority:      priority,
+		BatchMetadata: meta,
+		Notify:        notify,
+	}, nil
+}
+
+// MonitorResponse shows the last batch of a monitor by its public ID.
+type MonitorResponse struct {
+	*storage.Monitor
+	LastBatchID string `json:"last_batch_id,omitempty"`
+}
+
+func (h *Handler) monitorResponse(monitor *storage.Monitor) MonitorResponse {
+	response := MonitorResponse{Monitor: monitor}
+	if batch, err := h.storage.GetBatch(monitor.LastBatchID); err == nil {
+		response.LastBatchID = batch.PublicID
+	}
+	return response
+}
+
+type RunMonitorResponse struct {
+	MonitorID int64  `json:"monitor_id"`
+	BatchID   string `json:"batch_id"`
+	Message   string `json:"message"`
+}
+
+func (h *Handler) HandleListMonitors(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r)
+	monitors := make([]MonitorResponse, 0)
+	for _, monitor := range h.storage.ListMonitors() {
+		if monitor.Tenant == tenant {
+			monitors = append(monitors, h.monitorResponse(monitor))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"monitors": monitors})
+}
+
+func (h *Handler) HandleCreateMonitor(w http.ResponseWriter, r *http.Request) {
+	monitor, ok := h.decodeMonitorRequest(w, r)
+	if !ok {
+		return
+	}
+	monitor.APIKeyID = requestKeyID(r)
+	monitor.Tenant = requestTenant(r)
+
+	created, err := h.scheduler.Create(monitor)
+	if err != nil {
+		writeMonitorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(h.monitorResponse(created))
+}
+
+func (h *Handler) HandleGetMonitor(w http.ResponseWriter, r *http.Request) {
+	monitorID, ok := h.monitorID(w, r)
+	if !ok {
+		return
+	}
+
+	monitor, err := h.storage.GetMonitor(monitorID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.monitorResponse(monitor))
+}
+
+func (h *Handler) HandleUpdateMonitor(w http.ResponseWriter, r *http.Request) {
+	monitorID, ok := h.monitorID(w, r)
+	if !ok {
+		return
+	}
+
+	definition, ok := h.decodeMonitorRequest(w, r)
+	if !ok {
+		return
+	}
+	definition.APIKeyID = requestKeyID(r)
+	definition.Tenant = requestTenant(r)
+
+	updated, err := h.scheduler.Update(monitorID, definition)
+	if err != nil {
+		writeMonitorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.monitorResponse(updated))
+}
+
+func (h *Handler) HandleDeleteMonitor(w http.ResponseWriter, r *http.Request) {
+	monitorID, ok := h.monitorID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduler.Delete(monitorID); err != nil {
+		writeMonitorError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) HandlePauseMonitor(w http.ResponseWriter, r *http.Request) {
+	monitorID, ok := h.monitorID(w, r)
+	if !ok {
+		return
+	}
+
+	monitor, err := h.scheduler.Pause(monitorID)
+	if err != nil {
+		writeMonitorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.monitorResponse(monitor))
+}
+
+func (h *Handler) HandleResumeMonitor(w http.ResponseWriter, r *http.Request) {
+	monitorID, ok := h.monitorID(w, r)
+	if !ok {
+		return
+	}
+
+	monitor, err := h.scheduler.Resume(monitorID)
+	if err != nil {
+		writeMonitorError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.monitorResponse(monitor))
+}
+
+func (h *Handler) HandleRunMonitor(w http.ResponseWriter, r *http.Request) {
+	monitorID, ok := h.monitorID(w, r)
+	if !ok {
+		return
+	}
+
+	batchID, err := h.scheduler.RunNow(r.Context(), monitorID)
+	if err != nil {
+		writeMonitorError(w, err)
+		return
+	}
+
+	batch, err := h.storage.GetBatch(batchID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Batch not found: %v", err), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(RunMonitorResponse{
+		MonitorID: monitorID,
+		BatchID:   batch.PublicID,
+		Message:   "Links are being checked. Use batch_id to retrieve the report.",
+	})
+}
+
+// monitorID parses the monitor ID from the path and makes sure it exists
+// and belongs to the caller's tenant.
+func (h *Handler) monitorID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	monitorID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid monitor id", http.StatusBadRequest)
+		return 0, false
+	}
+
+	monitor, err := h.storage.GetMonitor(monitorID)
+	if err == nil && monitor.Tenant != requestTenant(r) {
+		err = fmt.Errorf("%w: %d", storage.ErrMonitorNotFound, monitorID)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return 0, false
+	}
+
+	return monitorID, true
+}
+
+func (h *Handler) decodeMonitorRequest(w http.ResponseWriter, r *http.Request) (*storage.Monitor, bool) {
+	var req MonitorRequest
+	if !h.decodeBody(w, r, &req) {
+		return nil, false
+	}
+	if !h.checkLinks(w, req.Links) {
+		return nil, false
+	}
+
+	monitor, err := req.monitor()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	return monitor, true
+}
+
+func writeMonitorError(w http.ResponseWriter, err error) {
+	if errors.Is(err, scheduler.ErrInvalidSchedule) {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, storage.ErrTooManyURLs) || errors.Is(err, storage.ErrDailyQuotaExceeded) {
+		writeSubmitError(w, err)
+		return
+	}
+	if errors.Is(err, storage.ErrMonitorNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
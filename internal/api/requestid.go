@@ -0,0 +1,68 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"linkChecker/internal/logging"
+)
+
+// RequestIDHeader carries the ID of a request in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds incoming request IDs, which end up in logs.
+const maxRequestIDLength = 128
+
+// LogRequests gives every request an ID and logs it once served. An
+// incoming X-Request-ID is kept if it is reasonable, so IDs from a proxy
+// in front of the server line up; otherwise a new one is generated. The ID
+// is echoed in the response and added to every log record made with the
+// request context.
+func LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := logging.With(r.Context(), "request_id", id)
+		r = r.WithContext(ctx)
+
+		started := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		slog.InfoContext(ctx, "HTTP request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", time.Since(started).Milliseconds(),
+			"remote", clientIP(r),
+		)
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"linkChecker/internal/storage"
+)
+
+// HandleListTenants shows quotas and usage. Admins only see their own
+// tenant.
+func (h *Handler) HandleListTenants(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"tenants": h.storage.ListTenants(adminTenant(r))})
+}
+
+// HandleSetTenantQuota overrides the default quota of a tenant:
+// PUT /tenants/{name} with a storage.TenantQuota body.
+func (h *Handler) HandleSetTenantQuota(w http.ResponseWriter, r *http.Request) {
+	var quota storage.TenantQuota
+	if !h.decodeBody(w, r, &quota) {
+		return
+	}
+
+	tenant, err := h.storage.SetTenantQuota(r.PathValue("name"), quota)
+	if errors.Is(err, storage.ErrInvalidTenant) || errors.Is(err, storage.ErrInvalidQuota) {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to store tenant: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tenant)
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+
+	"linkChecker/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("api")
+
+// Trace records a server span for every request, continuing a trace passed
+// in a traceparent header. Like Instrument it must wrap the ServeMux
+// without other middleware copying the request in between, as it names the
+// span after the matched pattern.
+func Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.ClientAddress(clientIP(r)),
+			),
+		)
+		defer span.End()
+
+		r = r.WithContext(tracing.WithLogIDs(ctx))
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if r.Pattern != "" {
+			span.SetName(r.Method + " " + r.Pattern)
+			span.SetAttributes(semconv.HTTPRoute(r.Pattern))
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
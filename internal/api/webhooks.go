@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"linkChecker/internal/storage"
+)
+
+// DeliveryResponse shows the batch of a delivery by its public ID.
+type DeliveryResponse struct {
+	*storage.WebhookDelivery
+	BatchID string `json:"batch_id,omitempty"`
+}
+
+func (h *Handler) deliveryResponse(delivery *storage.WebhookDelivery) DeliveryResponse {
+	response := DeliveryResponse{WebhookDelivery: delivery}
+	if batch, err := h.storage.GetBatch(delivery.BatchID); err == nil {
+		response.BatchID = batch.PublicID
+	}
+	return response
+}
+
+func (h *Handler) HandleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	tenant := requestTenant(r)
+
+	var batchID int64
+	if publicID := r.URL.Query().Get("batch_id"); publicID != "" {
+		batch, err := h.storage.GetTenantBatch(tenant, publicID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Batch not found: %v", err), http.StatusNotFound)
+			return
+		}
+		batchID = batch.BatchID
+	}
+
+	deliveries, err := h.storage.ListDeliveries(tenant, batchID, r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list deliveries: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]DeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		response = append(response, h.deliveryResponse(delivery))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"deliveries": response})
+}
+
+func (h *Handler) HandleGetDelivery(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.storage.GetDelivery(r.PathValue("id"))
+	if err == nil && !delivery.BelongsTo(requestTenant(r)) {
+		err = fmt.Errorf("delivery %s not found", r.PathValue("id"))
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.deliveryResponse(delivery))
+}
+
+func (h *Handler) HandleReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.storage.GetDelivery(r.PathValue("id"))
+	if err == nil && !delivery.BelongsTo(requestTenant(r)) {
+		err = fmt.Errorf("delivery %s not found", r.PathValue("id"))
+	}
+	if err == nil {
+		delivery, err = h.webhooks.Replay(delivery.ID)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(h.deliveryResponse(delivery))
+}
@@ -2,16 +2,31 @@ package checker
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"linkChecker/internal/metrics"
+	"linkChecker/internal/netguard"
+	"linkChecker/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = tracing.Tracer("checker")
+
 // StatusResult represents the result of checking a single URL
 type StatusResult struct {
 	URL       string `json:"url"`
@@ -19,6 +34,8 @@ type StatusResult struct {
 	Available bool   `json:"available"`
 	Error     string `json:"error,omitempty"`
 	CheckedAt string `json:"checked_at"`
+	// ResponseTimeMs is the time until the response headers arrived.
+	ResponseTimeMs int64 `json:"response_time_ms,omitempty"`
 }
 
 // Common error types for better error handling
@@ -29,28 +46,147 @@ var (
 	ErrTimeout           = errors.New("request timeout")
 	ErrDNS               = errors.New("DNS resolution failed")
 	ErrConnection        = errors.New("connection failed")
+	ErrCancelled         = errors.New("check cancelled")
+	ErrBlocked           = errors.New("address not allowed")
 )
 
+// Options tunes how URLs are checked.
+type Options struct {
+	// Timeout bounds a whole check, redirects included.
+	Timeout     time.Duration
+	DialTimeout time.Duration
+	// MaxRedirects is the redirect a check fails on: with 10, nine
+	// redirects are followed and the tenth is refused.
+	MaxRedirects int
+	// Concurrency caps the requests CheckLinks makes at once.
+	Concurrency int
+	UserAgent   string
+	// Headers are sent with every check and override the default
+	// User-Agent and Accept headers.
+	Headers http.Header
+	// Network decides which addresses checks may connect to. It is applied
+	// to the resolved address of every request, redirects included.
+	Network netguard.Policy
+}
+
+// DefaultOptions returns the options NewLinkChecker uses apart from the
+// timeout.
+func DefaultOptions() Options {
+	return Options{
+		Timeout:      10 * time.Second,
+		DialTimeout:  5 * time.Second,
+		MaxRedirects: 10,
+		Concurrency:  100,
+		UserAgent:    "LinkChecker/1.0",
+	}
+}
+
+// Validate reports the first option that is out of range.
+func (o Options) Validate() error {
+	if o.Timeout <= 0 {
+		return fmt.Errorf("timeout must be positive, got %v", o.Timeout)
+	}
+	if o.Timeout > 5*time.Minute {
+		return fmt.Errorf("timeout too large: %v", o.Timeout)
+	}
+	if o.DialTimeout <= 0 {
+		return fmt.Errorf("dial timeout must be positive, got %v", o.DialTimeout)
+	}
+	if o.MaxRedirects < 0 {
+		return fmt.Errorf("max redirects must not be negative, got %d", o.MaxRedirects)
+	}
+	if o.Concurrency <= 0 {
+		return fmt.Errorf("concurrency must be positive, got %d", o.Concurrency)
+	}
+	if strings.TrimSpace(o.UserAgent) == "" {
+		return errors.New("user agent must not be empty")
+	}
+	return ValidateHeaders(o.Headers)
+}
+
+// ValidateHeaders reports the first header that cannot be sent.
+func ValidateHeaders(headers http.Header) error {
+	for name, values := range headers {
+		if !validHeaderName(name) {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		for _, value := range values {
+			if strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("header %s must not contain line breaks", name)
+			}
+		}
+	}
+	return nil
+}
+
+// validHeaderName reports whether name is an HTTP token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r > '~' || r <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
+
 // LinkChecker handles checking URL availability with comprehensive error handling
 type LinkChecker struct {
-	client  *http.Client
-	timeout time.Duration
+	setup atomic.Pointer[setup]
+}
+
+// setup is the client built from one set of options. It is replaced as a
+// whole by Reconfigure, so a check never mixes old and new options.
+type setup struct {
+	opts   Options
+	client *http.Client
 }
 
 // NewLinkChecker creates a new LinkChecker with validation
 func NewLinkChecker(timeout time.Duration) (*LinkChecker, error) {
-	if timeout <= 0 {
-		return nil, fmt.Errorf("timeout must be positive, got %v", timeout)
+	opts := DefaultOptions()
+	opts.Timeout = timeout
+	return NewLinkCheckerWithOptions(opts)
+}
+
+// NewLinkCheckerWithOptions creates a LinkChecker with every option set.
+func NewLinkCheckerWithOptions(opts Options) (*LinkChecker, error) {
+	lc := &LinkChecker{}
+	if err := lc.Reconfigure(opts); err != nil {
+		return nil, err
+	}
+	return lc, nil
+}
+
+// Reconfigure switches to new options. Checks already running finish with
+// the options they started with; later ones use the new options.
+func (lc *LinkChecker) Reconfigure(opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
 	}
-	if timeout > 5*time.Minute {
-		return nil, fmt.Errorf("timeout too large: %v", timeout)
+
+	if old := lc.setup.Swap(newSetup(opts)); old != nil {
+		old.client.CloseIdleConnections()
 	}
+	return nil
+}
+
+// Options returns the options in effect.
+func (lc *LinkChecker) Options() Options {
+	return lc.setup.Load().opts
+}
+
+func newSetup(opts Options) *setup {
+	timeout := opts.Timeout
 
 	// Create custom transport with better error handling
 	transport := &http.Transport{
 		DialContext: (&net.Dialer{
-			Timeout:   5 * time.Second,
+			Timeout:   opts.DialTimeout,
 			KeepAlive: 30 * time.Second,
+			Control:   opts.Network.Control,
 		}).DialContext,
 		MaxIdleConns:          100,
 		IdleConnTimeout:       90 * time.Second,
@@ -64,21 +200,35 @@ func NewLinkChecker(timeout time.Duration) (*LinkChecker, error) {
 		Timeout:   timeout,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			// Limit redirects to prevent infinite loops
-			if len(via) >= 10 {
+			if len(via) >= opts.MaxRedirects {
 				return errors.New("too many redirects")
 			}
+			slog.DebugContext(req.Context(), "Check redirected", "url", via[0].URL.String(), "to", req.URL.String(), "hop", len(via))
+			trace.SpanFromContext(req.Context()).AddEvent("redirect", trace.WithAttributes(
+				attribute.String("url.redirect", req.URL.String()),
+				attribute.Int("http.request.resend_count", len(via)),
+			))
 			return nil
 		},
 	}
 
-	return &LinkChecker{
-		client:  client,
-		timeout: timeout,
-	}, nil
+	return &setup{opts: opts, client: client}
 }
 
-// CheckLinks checks multiple URLs concurrently with comprehensive error handling
-func (lc *LinkChecker) CheckLinks(urls []string) []StatusResult {
+// ResultFunc receives the result of a single URL as soon as it is checked.
+// Calls are made from one goroutine, in completion order.
+type ResultFunc func(index int, result StatusResult)
+
+// CheckLinks checks multiple URLs concurrently with comprehensive error handling.
+// Cancelling ctx aborts in-flight requests and skips URLs not yet started;
+// their results carry ErrCancelled.
+func (lc *LinkChecker) CheckLinks(ctx context.Context, urls []string) []StatusResult {
+	return lc.CheckLinksFunc(ctx, urls, nil)
+}
+
+// CheckLinksFunc works like CheckLinks and additionally reports every result
+// to onResult while the remaining URLs are still being checked.
+func (lc *LinkChecker) CheckLinksFunc(ctx context.Context, urls []string, onResult ResultFunc) []StatusResult {
 	if urls == nil {
 		return []StatusResult{{
 			URL:       "",
@@ -101,7 +251,7 @@ func (lc *LinkChecker) CheckLinks(urls []string) []StatusResult {
 	})
 
 	// Limit concurrent requests to prevent resource exhaustion
-	semaphore := make(chan struct{}, 100) // Max 100 concurrent requests
+	semaphore := make(chan struct{}, lc.Options().Concurrency)
 
 	for i, rawURL := range urls {
 		wg.Add(1)
@@ -132,7 +282,7 @@ func (lc *LinkChecker) CheckLinks(urls []string) []StatusResult {
 				}
 			}()
 
-			result := lc.checkURL(u)
+			result := lc.CheckURL(ctx, u)
 			resultsChan <- struct {
 				index  int
 				result StatusResult
@@ -149,13 +299,65 @@ func (lc *LinkChecker) CheckLinks(urls []string) []StatusResult {
 	// Collect results
 	for r := range resultsChan {
 		results[r.index] = r.result
+		if onResult != nil {
+			onResult(r.index, r.result)
+		}
 	}
 
 	return results
 }
 
-// checkURL performs comprehensive URL checking with detailed error handling
-func (lc *LinkChecker) checkURL(rawURL string) StatusResult {
+// CheckURL checks a single URL. Callers that schedule URLs themselves use
+// it instead of CheckLinks; if ctx is already done the result carries
+// ErrCancelled.
+func (lc *LinkChecker) CheckURL(ctx context.Context, rawURL string) StatusResult {
+	if ctx.Err() != nil {
+		return StatusResult{
+			URL:       rawURL,
+			Error:     ErrCancelled.Error(),
+			CheckedAt: time.Now().Format(time.RFC3339),
+		}
+	}
+	return lc.checkURL(ctx, rawURL)
+}
+
+// checkURL checks a URL and records the check in metrics and as a client
+// span, a child of the span in ctx. At debug level each step is logged
+// with the attributes of ctx, such as the batch ID.
+func (lc *LinkChecker) checkURL(ctx context.Context, rawURL string) StatusResult {
+	ctx, span := tracer.Start(ctx, "check",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPRequestMethodHead, semconv.URLFull(rawURL)),
+	)
+	defer span.End()
+	if span.IsRecording() {
+		ctx = httptrace.WithClientTrace(ctx, spanEvents(span))
+	}
+
+	metrics.ChecksInFlight.Inc()
+	started := time.Now()
+	slog.DebugContext(ctx, "Check started", "url", rawURL)
+
+	result := lc.doCheck(ctx, rawURL)
+
+	elapsed := time.Since(started)
+	metrics.ChecksInFlight.Dec()
+	metrics.CheckDuration.Observe(elapsed.Seconds())
+	metrics.ChecksTotal.Inc(Outcome(result), ErrorClass(result))
+	annotateSpan(span, rawURL, result)
+	slog.DebugContext(ctx, "Check finished",
+		"url", rawURL,
+		"outcome", Outcome(result),
+		"status", result.Status,
+		"error_class", ErrorClass(result),
+		"error", result.Error,
+		"duration_ms", elapsed.Milliseconds(),
+	)
+	return result
+}
+
+// doCheck performs comprehensive URL checking with detailed error handling
+func (lc *LinkChecker) doCheck(parent context.Context, rawURL string) StatusResult {
 	result := StatusResult{
 		URL:       rawURL,
 		CheckedAt: time.Now().Format(time.RFC3339),
@@ -196,8 +398,10 @@ func (lc *LinkChecker) checkURL(rawURL string) StatusResult {
 		return result
 	}
 
+	current := lc.setup.Load()
+
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), lc.timeout)
+	ctx, cancel := context.WithTimeout(parent, current.opts.Timeout)
 	defer cancel()
 
 	// Try HEAD request first, fallback to GET
@@ -217,11 +421,15 @@ func (lc *LinkChecker) checkURL(rawURL string) StatusResult {
 	}
 
 	// Set reasonable headers
-	req.Header.Set("User-Agent", "LinkChecker/1.0")
+	req.Header.Set("User-Agent", current.opts.UserAgent)
 	req.Header.Set("Accept", "*/*")
+	for name, values := range current.opts.Headers {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
 
 	// Execute request with detailed error handling
-	resp, err := lc.client.Do(req)
+	started := time.Now()
+	resp, err := current.client.Do(req)
 
 	// Handle different types of errors
 	if err != nil {
@@ -237,6 +445,7 @@ func (lc *LinkChecker) checkURL(rawURL string) StatusResult {
 
 	// Check for specific HTTP status codes
 	result.Status = resp.StatusCode
+	result.ResponseTimeMs = time.Since(started).Milliseconds()
 
 	// Determine availability based on status code
 	result.Available = resp.StatusCode >= 200 && resp.StatusCode < 400
@@ -249,6 +458,119 @@ func (lc *LinkChecker) checkURL(rawURL string) StatusResult {
 	return result
 }
 
+// IsCancelled reports whether result was cut short by cancellation rather
+// than produced by an actual check
+func IsCancelled(result StatusResult) bool {
+	return result.Error == ErrCancelled.Error()
+}
+
+// annotateSpan records the result of a check on its span.
+func annotateSpan(span trace.Span, rawURL string, result StatusResult) {
+	if parsed, err := url.Parse(strings.TrimSpace(rawURL)); err == nil && parsed.Hostname() != "" {
+		span.SetAttributes(semconv.ServerAddress(parsed.Hostname()))
+	}
+	if result.Status != 0 {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(result.Status))
+	}
+	span.SetAttributes(attribute.String("linkchecker.outcome", Outcome(result)))
+
+	if class := ErrorClass(result); class != "none" {
+		span.SetAttributes(semconv.ErrorTypeKey.String(class))
+		span.SetStatus(codes.Error, result.Error)
+	}
+}
+
+// spanEvents marks the phases of a request on span, so a slow check shows
+// whether the time went to DNS, connecting, TLS or the host itself.
+func spanEvents(span trace.Span) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			span.AddEvent("dns.start", trace.WithAttributes(attribute.String("dns.host", info.Host)))
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			attrs := []attribute.KeyValue{attribute.Int("dns.addresses", len(info.Addrs))}
+			if info.Err != nil {
+				attrs = append(attrs, attribute.String("error.message", info.Err.Error()))
+			}
+			span.AddEvent("dns.done", trace.WithAttributes(attrs...))
+		},
+		ConnectStart: func(network, addr string) {
+			span.AddEvent("connect.start", trace.WithAttributes(attribute.String("network.peer.address", addr)))
+		},
+		ConnectDone: func(network, addr string, err error) {
+			attrs := []attribute.KeyValue{attribute.String("network.peer.address", addr)}
+			if err != nil {
+				attrs = append(attrs, attribute.String("error.message", err.Error()))
+			}
+			span.AddEvent("connect.done", trace.WithAttributes(attrs...))
+		},
+		TLSHandshakeStart: func() {
+			span.AddEvent("tls.start")
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err != nil {
+				span.AddEvent("tls.done", trace.WithAttributes(attribute.String("error.message", err.Error())))
+				return
+			}
+			span.AddEvent("tls.done")
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			span.AddEvent("connection", trace.WithAttributes(attribute.Bool("reused", info.Reused)))
+		},
+		GotFirstResponseByte: func() {
+			span.AddEvent("first_byte")
+		},
+	}
+}
+
+// Outcome sorts a result into available, unavailable or cancelled.
+func Outcome(result StatusResult) string {
+	switch {
+	case IsCancelled(result):
+		return "cancelled"
+	case result.Available:
+		return "available"
+	default:
+		return "unavailable"
+	}
+}
+
+// errorClasses maps the errors of checkURL to short names. Result errors
+// are strings, so they are matched by the prefix the error wrapping leaves.
+var errorClasses = []struct {
+	err   error
+	class string
+}{
+	{ErrCancelled, "cancelled"},
+	{ErrBlocked, "blocked"},
+	{ErrTimeout, "timeout"},
+	{ErrDNS, "dns"},
+	{ErrConnection, "connection"},
+	{ErrInvalidURL, "invalid_url"},
+	{ErrUnsupportedScheme, "unsupported_scheme"},
+	{ErrEmptyURL, "empty_url"},
+}
+
+// ErrorClass names the kind of error in result: "none", "http_4xx",
+// "http_5xx", one of the classes of the Err* variables, or "other".
+func ErrorClass(result StatusResult) string {
+	if result.Error == "" {
+		return "none"
+	}
+	for _, c := range errorClasses {
+		if strings.HasPrefix(result.Error, c.err.Error()) {
+			return c.class
+		}
+	}
+	switch {
+	case result.Status >= 500:
+		return "http_5xx"
+	case result.Status >= 400:
+		return "http_4xx"
+	}
+	return "other"
+}
+
 // isSupportedScheme checks if the URL scheme is supported
 func (lc *LinkChecker) isSupportedScheme(scheme string) bool {
 	supportedSchemes := map[string]bool{
@@ -265,10 +587,14 @@ func (lc *LinkChecker) classifyError(err error, ctxErr error) error {
 			return fmt.Errorf("%w: %v", ErrTimeout, ctxErr)
 		}
 		if errors.Is(ctxErr, context.Canceled) {
-			return fmt.Errorf("request cancelled: %v", ctxErr)
+			return ErrCancelled
 		}
 	}
 
+	if errors.Is(err, netguard.ErrBlocked) {
+		return fmt.Errorf("%w: %v", ErrBlocked, err)
+	}
+
 	var netErr net.Error
 	if errors.As(err, &netErr) {
 		if netErr.Timeout() {
@@ -0,0 +1,159 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultHistorySize is how many recent events a batch keeps for replay.
+	DefaultHistorySize = 1000
+	// closedTopicTTL is how long a finished batch keeps its history around
+	// for subscribers that reconnect late.
+	closedTopicTTL   = 5 * time.Minute
+	subscriberBuffer = 64
+)
+
+// Event is a single message published for a batch. IDs increase by one per
+// batch and are used for Last-Event-ID resumption.
+type Event struct {
+	ID   int64
+	Type string
+	Data any
+}
+
+type topic struct {
+	nextID  int64
+	history []Event
+	subs    map[chan Event]struct{}
+	closed  bool
+}
+
+// Broker is an in-process pub/sub of batch events. Any number of
+// subscribers may watch the same batch.
+type Broker struct {
+	historySize int
+
+	mu     sync.Mutex
+	topics map[int64]*topic
+}
+
+func NewBroker(historySize int) *Broker {
+	if historySize <= 0 {
+		historySize = DefaultHistorySize
+	}
+	return &Broker{
+		historySize: historySize,
+		topics:      make(map[int64]*topic),
+	}
+}
+
+// Publish delivers an event to every subscriber of the batch. Subscribers
+// that cannot keep up are dropped; they can reconnect and replay.
+func (b *Broker) Publish(batchID int64, eventType string, data any) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topicLocked(batchID)
+	t.nextID++
+	event := Event{ID: t.nextID, Type: eventType, Data: data}
+
+	t.history = append(t.history, event)
+	if len(t.history) > b.historySize {
+		t.history = t.history[len(t.history)-b.historySize:]
+	}
+
+	for ch := range t.subs {
+		select {
+		case ch <- event:
+		default:
+			delete(t.subs, ch)
+			close(ch)
+		}
+	}
+
+	return event
+}
+
+// Close ends the stream of a batch. Current subscribers are disconnected
+// after receiving everything published so far; the history stays available
+// for a while so late reconnects can still replay it.
+func (b *Broker) Close(batchID int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[batchID]
+	if !ok || t.closed {
+		return
+	}
+
+	t.closed = true
+	for ch := range t.subs {
+		delete(t.subs, ch)
+		close(ch)
+	}
+
+	time.AfterFunc(closedTopicTTL, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.topics[batchID] == t {
+			delete(b.topics, batchID)
+		}
+	})
+}
+
+// Subscribe returns the events published after lastEventID and a channel
+// for the ones that follow. The channel is closed when the batch stream
+// ends or the subscriber falls behind. Unless create is set, ok is false
+// when the broker knows nothing about the batch.
+func (b *Broker) Subscribe(batchID int64, lastEventID int64, create bool) (replay []Event, events <-chan Event, unsubscribe func(), ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, exists := b.topics[batchID]
+	if !exists && !create {
+		return nil, nil, func() {}, false
+	}
+	if !exists {
+		t = b.topicLocked(batchID)
+	}
+
+	for _, event := range t.history {
+		if event.ID > lastEventID {
+			replay = append(replay, event)
+		}
+	}
+
+	ch := make(chan Event, subscriberBuffer)
+	if t.closed {
+		close(ch)
+		return replay, ch, func() {}, true
+	}
+
+	t.subs[ch] = struct{}{}
+	unsubscribe = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := t.subs[ch]; ok {
+			delete(t.subs, ch)
+			close(ch)
+		}
+	}
+
+	return replay, ch, unsubscribe, true
+}
+
+func (b *Broker) topicLocked(batchID int64) *topic {
+	t, ok := b.topics[batchID]
+	if !ok || t.closed {
+		// A batch that is started again (e.g. resumed) continues its IDs.
+		next := &topic{subs: make(map[chan Event]struct{})}
+		if ok {
+			next.nextID = t.nextID
+			next.history = t.history
+		}
+		t = next
+		b.topics[batchID] = t
+	}
+	return t
+}
@@ -0,0 +1,121 @@
+package extract
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	adocDelimiter = regexp.MustCompile(`^(-{4,}|\.{4,}|/{4,}|\+{4,})\s*$`)
+	adocMacro     = regexp.MustCompile(`\b(link|xref|image|include|video|audio):{1,2}([^\s\[\]]+)\[`)
+	adocXref      = regexp.MustCompile(`<<([^,>\s]+)(?:,[^>]*)?>>`)
+	adocAnchor    = regexp.MustCompile(`\[\[([^\],\s]+)(?:,[^\]]*)?\]\]`)
+	adocBlockID   = regexp.MustCompile(`^\[#([^\].,%\s]+)`)
+	adocAnchorRef = regexp.MustCompile(`anchor:([^\s\[]+)\[`)
+	adocTitle     = regexp.MustCompile(`^={1,6}\s+(\S.*?)\s*$`)
+	adocImagesDir = regexp.MustCompile(`^:imagesdir:\s*(\S+)\s*$`)
+	adocPassthru  = regexp.MustCompile("`[^`]*`")
+)
+
+func asciidocLinks(lines []string, add func(int, string)) {
+	imagesDir := ""
+	eachAsciiDocLine(lines, func(n int, line string) {
+		if match := adocImagesDir.FindStringSubmatch(line); match != nil {
+			imagesDir = match[1]
+			return
+		}
+
+		line = blank(line, adocPassthru)
+		for _, match := range adocMacro.FindAllStringSubmatch(line, -1) {
+			target := match[2]
+			switch match[1] {
+			case "xref":
+				target = asciidocRef(target)
+			case "image":
+				if imagesDir != "" && !hasScheme(target) && !strings.HasPrefix(target, "/") {
+					target = path.Join(imagesDir, target)
+				}
+			}
+			add(n, target)
+		}
+		line = blank(line, adocMacro)
+
+		for _, match := range adocXref.FindAllStringSubmatch(line, -1) {
+			add(n, asciidocRef(match[1]))
+		}
+		bareURLs(blank(line, adocXref), func(target string) { add(n, target) })
+	})
+}
+
+// asciidocRef turns a cross reference into a link target: "id" refers to
+// the same document, "other#id" and "other.adoc#id" to another one.
+func asciidocRef(ref string) string {
+	file, fragment, found := strings.Cut(ref, "#")
+	if !found {
+		if path.Ext(ref) == "" {
+			return "#" + ref
+		}
+		return ref
+	}
+	if file != "" && path.Ext(file) == "" {
+		file += ".adoc"
+	}
+	return file + "#" + fragment
+}
+
+// asciidocAnchors collects explicit anchors and the IDs Asciidoctor
+// generates for section titles with its default _ prefix and separator.
+func asciidocAnchors(lines []string, add func(string)) {
+	ids := newUniqueIDs("_", 2, add)
+	eachAsciiDocLine(lines, func(_ int, line string) {
+		for _, match := range adocAnchor.FindAllStringSubmatch(line, -1) {
+			add(match[1])
+		}
+		for _, match := range adocAnchorRef.FindAllStringSubmatch(line, -1) {
+			add(match[1])
+		}
+		if match := adocBlockID.FindStringSubmatch(line); match != nil {
+			add(match[1])
+		}
+		if match := adocTitle.FindStringSubmatch(line); match != nil {
+			ids.next(asciidocID(match[1]))
+		}
+	})
+}
+
+func asciidocID(title string) string {
+	var b strings.Builder
+	b.WriteByte('_')
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '.':
+			b.WriteRune(r)
+		case !strings.HasSuffix(b.String(), "_"):
+			b.WriteByte('_')
+		}
+	}
+	return strings.TrimRight(b.String(), "_")
+}
+
+// eachAsciiDocLine calls fn for every line outside listing, literal,
+// passthrough and comment blocks and line comments.
+func eachAsciiDocLine(lines []string, fn func(int, string)) {
+	var block string
+	for i, line := range lines {
+		if match := adocDelimiter.FindStringSubmatch(line); match != nil {
+			switch {
+			case block == "":
+				block = match[1]
+			case match[1] == block:
+				block = ""
+			}
+			continue
+		}
+		if block != "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		fn(i+1, line)
+	}
+}
@@ -0,0 +1,169 @@
+// Package extract finds links in documentation sources: Markdown, HTML,
+// reStructuredText and AsciiDoc files.
+package extract
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Link is a link target as written in a document.
+type Link struct {
+	URL  string `json:"url"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// Formats of the documents links are extracted from.
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	FormatRST      = "rst"
+	FormatAsciiDoc = "asciidoc"
+)
+
+var formatsByExt = map[string]string{
+	".md":       FormatMarkdown,
+	".markdown": FormatMarkdown,
+	".mdx":      FormatMarkdown,
+	".html":     FormatHTML,
+	".htm":      FormatHTML,
+	".rst":      FormatRST,
+	".adoc":     FormatAsciiDoc,
+	".asciidoc": FormatAsciiDoc,
+	".asc":      FormatAsciiDoc,
+}
+
+// FormatOf returns the format of a file by its extension, or "" if links
+// are not extracted from it.
+func FormatOf(name string) string {
+	return formatsByExt[strings.ToLower(path.Ext(name))]
+}
+
+// Extract returns the links in a document, in the order they appear. File
+// is only recorded in the links.
+func Extract(file string, data []byte) []Link {
+	var links []Link
+	add := func(line int, target string) {
+		if target = strings.TrimSpace(target); target != "" {
+			links = append(links, Link{URL: target, File: file, Line: line})
+		}
+	}
+
+	lines := splitLines(data)
+	switch FormatOf(file) {
+	case FormatMarkdown:
+		markdownLinks(lines, add)
+	case FormatHTML:
+		htmlLinks(lines, add)
+	case FormatRST:
+		rstLinks(lines, add)
+	case FormatAsciiDoc:
+		asciidocLinks(lines, add)
+	}
+	return links
+}
+
+// Anchors returns the fragment identifiers a document defines: the IDs
+// generated for its headings and those set explicitly.
+func Anchors(file string, data []byte) map[string]bool {
+	anchors := make(map[string]bool)
+	add := func(id string) {
+		if id != "" {
+			anchors[id] = true
+		}
+	}
+
+	lines := splitLines(data)
+	switch FormatOf(file) {
+	case FormatMarkdown:
+		markdownAnchors(lines, add)
+	case FormatHTML:
+		htmlAnchors(lines, add)
+	case FormatRST:
+		rstAnchors(lines, add)
+	case FormatAsciiDoc:
+		asciidocAnchors(lines, add)
+	}
+	return anchors
+}
+
+func splitLines(data []byte) []string {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	return strings.Split(text, "\n")
+}
+
+// bareURL matches URLs written as plain text.
+var bareURL = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `\[\]{}|\\^]+`)
+
+// bareURLs calls add for every plain-text URL in text. Trailing
+// punctuation belongs to the sentence, and a closing parenthesis only to
+// the URL if it opened one.
+func bareURLs(text string, add func(string)) {
+	for _, match := range bareURL.FindAllString(text, -1) {
+		for {
+			trimmed := strings.TrimRight(match, ".,;:!?*_~'\"")
+			if strings.HasSuffix(trimmed, ")") && strings.Count(trimmed, "(") < strings.Count(trimmed, ")") {
+				trimmed = trimmed[:len(trimmed)-1]
+			}
+			if trimmed == match {
+				break
+			}
+			match = trimmed
+		}
+		add(match)
+	}
+}
+
+// blank replaces the parts of text matched by re with spaces, so later
+// patterns do not match them again.
+func blank(text string, re *regexp.Regexp) string {
+	return re.ReplaceAllStringFunc(text, func(match string) string {
+		return strings.Repeat(" ", len(match))
+	})
+}
+
+// slugify builds a heading ID the way generators do: lowercase, with
+// characters outside letters, digits and keep removed or, for
+// separators, replaced by sep.
+func slugify(title string, sep rune, keep string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(keep, r):
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune(sep)
+		}
+	}
+	return b.String()
+}
+
+// uniqueIDs numbers repeated IDs like generators do, such as id, id-1,
+// id-2 with first 1.
+type uniqueIDs struct {
+	seen  map[string]int
+	sep   string
+	first int
+	add   func(string)
+}
+
+func newUniqueIDs(sep string, first int, add func(string)) *uniqueIDs {
+	return &uniqueIDs{seen: make(map[string]int), sep: sep, first: first, add: add}
+}
+
+func (u *uniqueIDs) next(id string) {
+	if id == "" {
+		return
+	}
+	count := u.seen[id]
+	u.seen[id]++
+	if count > 0 {
+		u.add(id + u.sep + strconv.Itoa(u.first+count-1))
+		return
+	}
+	u.add(id)
+}
@@ -0,0 +1,141 @@
+package extract
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		doc  string
+		want []Link
+	}{
+		{
+			name: "markdown",
+			file: "README.md",
+			doc: "---\nurl: https://front.example\n---\n" +
+				"See [docs](guide/intro.md#setup) and ![logo](img/logo.png \"Logo\").\n" +
+				"Visit https://example.com/path_(x). or <https://auto.example>\n" +
+				"`https://code.example` is code\n" +
+				"```\nhttps://fenced.example\n```\n" +
+				"[ref]: https://ref.example\n" +
+				"<a href=\"other.html\">x</a> [wiki](https://en.wikipedia.org/wiki/Go_(language))\n",
+			want: []Link{
+				{"guide/intro.md#setup", "README.md", 4},
+				{"img/logo.png", "README.md", 4},
+				{"https://auto.example", "README.md", 5},
+				{"https://example.com/path_(x)", "README.md", 5},
+				{"https://ref.example", "README.md", 10},
+				{"https://en.wikipedia.org/wiki/Go_(language)", "README.md", 11},
+				{"other.html", "README.md", 11},
+			},
+		},
+		{
+			name: "html",
+			file: "index.html",
+			doc: "<a href=\"a.html#top\">A</a> <img src='img.png'>\n" +
+				"<!-- <a href=\"hidden.html\"> -->\n" +
+				"<a href=x.html?a=1&amp;b=2>X</a>\n",
+			want: []Link{
+				{"a.html#top", "index.html", 1},
+				{"img.png", "index.html", 1},
+				{"x.html?a=1&b=2", "index.html", 3},
+			},
+		},
+		{
+			name: "rst",
+			file: "index.rst",
+			doc: "See `Go <https://go.dev>`_ and https://bare.example.\n" +
+				".. _python: https://python.org\n" +
+				".. image:: img/diagram.png\n" +
+				"Example::\n\n    https://literal.example\n\n" +
+				"``https://inline.example`` and `alias <python_>`_\n",
+			want: []Link{
+				{"https://go.dev", "index.rst", 1},
+				{"https://bare.example", "index.rst", 1},
+				{"https://python.org", "index.rst", 2},
+				{"img/diagram.png", "index.rst", 3},
+			},
+		},
+		{
+			name: "asciidoc",
+			file: "guide.adoc",
+			doc: ":imagesdir: images\n" +
+				"image::arch.png[Architecture] link:https://asciidoc.org[AsciiDoc]\n" +
+				"See <<install>>, xref:other.adoc#setup[Setup] and <<ref#usage,Usage>>.\n" +
+				"----\nhttps://listing.example\n----\n" +
+				"Plain https://plain.example\n",
+			want: []Link{
+				{"images/arch.png", "guide.adoc", 2},
+				{"https://asciidoc.org", "guide.adoc", 2},
+				{"other.adoc#setup", "guide.adoc", 3},
+				{"#install", "guide.adoc", 3},
+				{"ref.adoc#usage", "guide.adoc", 3},
+				{"https://plain.example", "guide.adoc", 7},
+			},
+		},
+		{
+			name: "unknown format",
+			file: "notes.txt",
+			doc:  "https://example.com\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Extract(tt.file, []byte(tt.doc))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Extract returned\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnchors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		doc  string
+		want []string
+	}{
+		{
+			name: "markdown",
+			file: "README.md",
+			doc: "# Getting Started!\n## Getting Started\n" +
+				"## [Link](x.md) and `code`\n## Custom {#my-id}\n" +
+				"Setext\n======\n<a id=\"html-anchor\"></a>\n```\n# not a heading\n```\n",
+			want: []string{"getting-started", "getting-started-1", "link-and-code", "my-id", "setext", "html-anchor"},
+		},
+		{
+			name: "html",
+			file: "index.html",
+			doc:  "<h2 id=\"intro\">Intro</h2><a name='old'></a>\n<!-- <p id=\"gone\"> -->\n",
+			want: []string{"intro", "old"},
+		},
+		{
+			name: "rst",
+			file: "index.rst",
+			doc:  ".. _my-label:\n\nInstall Guide\n=============\n\n1. Second Section!\n------------------\n",
+			want: []string{"my-label", "install-guide", "second-section"},
+		},
+		{
+			name: "asciidoc",
+			file: "guide.adoc",
+			doc:  "= Title\n== First Steps\n== First Steps\n[[explicit]]\n[#block-id]\nanchor:inline[]\n",
+			want: []string{"_title", "_first_steps", "_first_steps_2", "explicit", "block-id", "inline"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := slices.Sorted(maps.Keys(Anchors(tt.file, []byte(tt.doc))))
+			want := slices.Sorted(slices.Values(tt.want))
+			if !slices.Equal(got, want) {
+				t.Errorf("Anchors = %v, want %v", got, want)
+			}
+		})
+	}
+}
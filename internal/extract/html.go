@@ -0,0 +1,72 @@
+package extract
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlURLAttr = regexp.MustCompile(`(?i)(?:^|[\s"'])(?:href|src)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'<>` + "`" + `]+))`)
+	htmlIDAttr  = regexp.MustCompile(`(?i)(?:^|[\s"'])(?:id|name)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'<>` + "`" + `]+))`)
+)
+
+func htmlLinks(lines []string, add func(int, string)) {
+	eachHTMLLine(lines, func(n int, line string) {
+		for _, value := range attrValues(htmlURLAttr, line) {
+			add(n, value)
+		}
+	})
+}
+
+func htmlAnchors(lines []string, add func(string)) {
+	eachHTMLLine(lines, func(_ int, line string) {
+		for _, value := range attrValues(htmlIDAttr, line) {
+			add(value)
+		}
+	})
+}
+
+// eachHTMLLine calls fn for every line with comments removed.
+func eachHTMLLine(lines []string, fn func(int, string)) {
+	inComment := false
+	for i, line := range lines {
+		var visible strings.Builder
+		for line != "" {
+			if inComment {
+				end := strings.Index(line, "-->")
+				if end < 0 {
+					line = ""
+					break
+				}
+				line = line[end+3:]
+				inComment = false
+				continue
+			}
+			start := strings.Index(line, "<!--")
+			if start < 0 {
+				visible.WriteString(line)
+				break
+			}
+			visible.WriteString(line[:start])
+			line = line[start+4:]
+			inComment = true
+		}
+		fn(i+1, visible.String())
+	}
+}
+
+// attrValues returns the unescaped values of the attributes re matches in
+// text.
+func attrValues(re *regexp.Regexp, text string) []string {
+	var values []string
+	for _, match := range re.FindAllStringSubmatch(text, -1) {
+		for _, value := range match[1:] {
+			if value != "" {
+				values = append(values, html.UnescapeString(value))
+				break
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,154 @@
+package extract
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	mdFence     = regexp.MustCompile("^\\s{0,3}(`{3,}|~{3,})")
+	mdCodeSpan  = regexp.MustCompile("`+[^`]*`+")
+	mdRefDef    = regexp.MustCompile(`^\s{0,3}\[[^\]]+\]:\s*<?([^\s>]+)>?`)
+	mdAutolink  = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9+.-]*:[^>\s]+)>`)
+	mdHeading   = regexp.MustCompile(`^\s{0,3}#{1,6}\s+(.*?)(?:\s+#+)?\s*$`)
+	mdSetext    = regexp.MustCompile(`^\s{0,3}(?:=+|-+)\s*$`)
+	mdHeadingID = regexp.MustCompile(`\s*\{#([^}\s]+)\}\s*$`)
+	mdLinkText  = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	mdTag       = regexp.MustCompile(`<[^>]*>`)
+)
+
+func markdownLinks(lines []string, add func(int, string)) {
+	eachMarkdownLine(lines, func(n int, line string) {
+		if match := mdRefDef.FindStringSubmatch(line); match != nil {
+			add(n, match[1])
+			return
+		}
+
+		line = blank(line, mdCodeSpan)
+		line = inlineLinks(line, func(target string) { add(n, target) })
+		for _, match := range mdAutolink.FindAllStringSubmatch(line, -1) {
+			add(n, match[1])
+		}
+		line = blank(line, mdAutolink)
+		for _, value := range attrValues(htmlURLAttr, line) {
+			add(n, value)
+		}
+		bareURLs(blank(line, htmlURLAttr), func(target string) { add(n, target) })
+	})
+}
+
+// markdownAnchors collects heading IDs as GitHub generates them, custom
+// {#id} heading IDs and anchors of embedded HTML.
+func markdownAnchors(lines []string, add func(string)) {
+	ids := newUniqueIDs("-", 1, add)
+	heading := func(title string) {
+		if match := mdHeadingID.FindStringSubmatch(title); match != nil {
+			add(match[1])
+			return
+		}
+		title = mdLinkText.ReplaceAllString(title, "$1")
+		title = mdTag.ReplaceAllString(title, "")
+		ids.next(slugify(title, '-', "-_"))
+	}
+
+	var previous string
+	eachMarkdownLine(lines, func(n int, line string) {
+		for _, value := range attrValues(htmlIDAttr, line) {
+			add(value)
+		}
+
+		if match := mdHeading.FindStringSubmatch(line); match != nil {
+			heading(match[1])
+			previous = ""
+			return
+		}
+		if mdSetext.MatchString(line) && strings.TrimSpace(previous) != "" {
+			heading(strings.TrimSpace(previous))
+			previous = ""
+			return
+		}
+		previous = line
+	})
+}
+
+// eachMarkdownLine calls fn for every line outside fenced code blocks and
+// front matter, with 1-based line numbers.
+func eachMarkdownLine(lines []string, fn func(int, string)) {
+	start := 0
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		for i := 1; i < len(lines); i++ {
+			if trimmed := strings.TrimSpace(lines[i]); trimmed == "---" || trimmed == "..." {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	var fence string
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		if match := mdFence.FindStringSubmatch(line); match != nil {
+			switch {
+			case fence == "":
+				fence = match[1]
+			case strings.HasPrefix(match[1], fence):
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+		fn(i+1, line)
+	}
+}
+
+// inlineLinks calls add for the destination of every inline link or image,
+// [text](destination "title"), and returns line with the destinations
+// blanked out. Destinations may contain balanced parentheses.
+func inlineLinks(line string, add func(string)) string {
+	out := []byte(line)
+	for i := 0; i+1 < len(line); i++ {
+		if line[i] != ']' || line[i+1] != '(' {
+			continue
+		}
+
+		start := i + 2
+		for start < len(line) && line[start] == ' ' {
+			start++
+		}
+
+		end := start
+		if end < len(line) && line[end] == '<' {
+			closing := strings.IndexByte(line[end:], '>')
+			if closing < 0 {
+				continue
+			}
+			add(line[end+1 : end+closing])
+			end += closing + 1
+		} else {
+			depth := 0
+		scan:
+			for ; end < len(line); end++ {
+				switch line[end] {
+				case ' ', '\t':
+					break scan
+				case '(':
+					depth++
+				case ')':
+					if depth == 0 {
+						break scan
+					}
+					depth--
+				}
+			}
+			add(line[start:end])
+		}
+
+		for j := i; j < end; j++ {
+			out[j] = ' '
+		}
+		i = end - 1
+	}
+	return string(out)
+}
@@ -0,0 +1,116 @@
+package extract
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	rstEmbedded  = regexp.MustCompile("`[^`]*<([^<>`]+)>`__?")
+	rstTarget    = regexp.MustCompile("^\\s*\\.\\.\\s+_(?:[^:`]*|`[^`]+`):\\s+(\\S.*?)\\s*$")
+	rstLabel     = regexp.MustCompile("^\\s*\\.\\.\\s+_([^:`]+|`[^`]+`):\\s*$")
+	rstDirective = regexp.MustCompile(`^\s*\.\.\s+(?:image|figure|include|literalinclude|download)::\s+(\S+)`)
+	rstCode      = regexp.MustCompile(`^\s*\.\.\s+(?:code|code-block|sourcecode|raw)::`)
+	rstLiteral   = regexp.MustCompile("``[^`]+``")
+)
+
+func rstLinks(lines []string, add func(int, string)) {
+	eachRSTLine(lines, func(n int, line string) {
+		if match := rstTarget.FindStringSubmatch(line); match != nil {
+			// A target ending in _ points to another target, not a URL.
+			if !strings.HasSuffix(match[1], "_") {
+				add(n, match[1])
+			}
+			return
+		}
+		if match := rstDirective.FindStringSubmatch(line); match != nil {
+			add(n, match[1])
+			return
+		}
+
+		line = blank(line, rstLiteral)
+		for _, match := range rstEmbedded.FindAllStringSubmatch(line, -1) {
+			if !strings.HasSuffix(match[1], "_") {
+				add(n, match[1])
+			}
+		}
+		bareURLs(blank(line, rstEmbedded), func(target string) { add(n, target) })
+	})
+}
+
+// rstAnchors collects the IDs docutils gives section titles and explicit
+// targets such as ".. _label:".
+func rstAnchors(lines []string, add func(string)) {
+	eachRSTLine(lines, func(n int, line string) {
+		if match := rstLabel.FindStringSubmatch(line); match != nil {
+			add(rstID(strings.Trim(match[1], "`")))
+			return
+		}
+
+		// n is 1-based, so lines[n] is the line below.
+		title := strings.TrimSpace(line)
+		if title == "" || n >= len(lines) || line[0] == ' ' || isAdornment(line) {
+			return
+		}
+		underline := strings.TrimSpace(lines[n])
+		if isAdornment(underline) && len(underline) >= utf8.RuneCountInString(title) {
+			add(rstID(title))
+		}
+	})
+}
+
+// isAdornment reports whether line is a section underline or overline: at
+// least two of the same punctuation character.
+func isAdornment(line string) bool {
+	line = strings.TrimRight(line, " \t")
+	if len(line) < 2 || !strings.ContainsRune("=-`:'\"~^_*+#<>.", rune(line[0])) {
+		return false
+	}
+	return strings.Count(line, line[:1]) == len(line)
+}
+
+// rstID builds an ID the way docutils does: lowercase, with runs of other
+// characters than letters and digits turned into single hyphens.
+func rstID(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+			continue
+		}
+		hyphen = true
+	}
+	return strings.TrimLeftFunc(b.String(), func(r rune) bool { return !unicode.IsLetter(r) })
+}
+
+// eachRSTLine calls fn for every line outside literal blocks, with 1-based
+// line numbers. A literal block follows a paragraph ending in "::" or a
+// code directive and lasts while lines are indented deeper.
+func eachRSTLine(lines []string, fn func(int, string)) {
+	literal := -1
+	for i, line := range lines {
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		trimmed := strings.TrimSpace(line)
+
+		if literal >= 0 {
+			if trimmed == "" || indent > literal {
+				continue
+			}
+			literal = -1
+		}
+
+		fn(i+1, line)
+
+		isDirective := strings.HasPrefix(trimmed, "..")
+		if rstCode.MatchString(line) || (!isDirective && strings.HasSuffix(trimmed, "::")) {
+			literal = indent
+		}
+	}
+}
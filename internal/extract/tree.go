@@ -0,0 +1,456 @@
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"linkChecker/internal/storage"
+)
+
+// Limits on what is read from an archive.
+const (
+	maxDocumentBytes = 16 << 20
+	maxArchiveFiles  = 100000
+	// maxArchiveBytes bounds the uncompressed size of all files together.
+	maxArchiveBytes = 256 << 20
+)
+
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// Tree is a set of documents and the paths next to them, which relative
+// links are checked against. Paths use slashes and are relative to the
+// root of the tree.
+type Tree struct {
+	docs  map[string][]byte
+	paths map[string]bool
+}
+
+func newTree() *Tree {
+	return &Tree{docs: make(map[string][]byte), paths: map[string]bool{".": true}}
+}
+
+// add records a file of the tree and keeps its content if it is a
+// document. Only documents are opened, and each is closed once read.
+func (t *Tree) add(name string, size int64, open func() (io.ReadCloser, error)) error {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		t.paths[dir] = true
+	}
+	t.paths[name] = true
+
+	if FormatOf(name) == "" {
+		return nil
+	}
+	if size > maxDocumentBytes {
+		return fmt.Errorf("%s is larger than %d bytes", name, maxDocumentBytes)
+	}
+	r, err := open()
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxDocumentBytes+1))
+	r.Close()
+	if err != nil {
+		return err
+	}
+	if len(data) > maxDocumentBytes {
+		return fmt.Errorf("%s is larger than %d bytes", name, maxDocumentBytes)
+	}
+	t.docs[name] = data
+	return nil
+}
+
+// ReadDir reads the documents under root. Hidden directories, such as
+// .git, are skipped.
+func ReadDir(root string) (*Tree, error) {
+	t := newTree()
+	fsys := os.DirFS(root)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		if d.IsDir() {
+			if strings.HasPrefix(d.Name(), ".") {
+				return fs.SkipDir
+			}
+			t.paths[name] = true
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return t.add(name, info.Size(), func() (io.ReadCloser, error) {
+			return fsys.Open(name)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ReadArchive reads the documents in a zip, tar or gzipped tar archive.
+// When every entry is under one top-level directory, as in archives of a
+// repository, that directory becomes the root. Like ReadDir, it skips
+// hidden directories. Tar archives are read as a stream; zip archives need
+// their directory at the end and are buffered. Archives with more than
+// maxArchiveFiles entries or maxArchiveBytes of uncompressed files are
+// refused as soon as that is known.
+func ReadArchive(r io.Reader) (*Tree, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	var entries []archiveEntry
+	switch {
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		entries, err = zipEntries(br)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, gzErr := gzip.NewReader(br)
+		if gzErr != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, gzErr)
+		}
+		defer gz.Close()
+		entries, err = tarEntries(gz)
+	default:
+		entries, err = tarEntries(br)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for i := range entries {
+		name, ok := cleanEntryName(entries[i].name)
+		if !ok {
+			return nil, fmt.Errorf("%w: unsafe path %q", ErrInvalidArchive, entries[i].name)
+		}
+		entries[i].name = name
+		names = append(names, name)
+	}
+	prefix := commonDir(names)
+
+	t := newTree()
+	for _, e := range entries {
+		name := strings.TrimPrefix(e.name, prefix)
+		if hidden(name) {
+			continue
+		}
+		if err := t.add(name, e.size, e.open); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+	}
+	return t, nil
+}
+
+// archiveEntry is a regular file of an archive.
+type archiveEntry struct {
+	name string
+	size int64
+	open func() (io.ReadCloser, error)
+}
+
+// archiveBudget counts what an archive holds against the limits.
+type archiveBudget struct {
+	files int
+	bytes int64
+}
+
+func (b *archiveBudget) add(size int64) error {
+	b.files++
+	if b.files > maxArchiveFiles {
+		return fmt.Errorf("%w: more than %d files", ErrInvalidArchive, maxArchiveFiles)
+	}
+	if size < 0 || size > maxArchiveBytes-b.bytes {
+		return fmt.Errorf("%w: files add up to more than %d bytes", ErrInvalidArchive, maxArchiveBytes)
+	}
+	b.bytes += size
+	return nil
+}
+
+func zipEntries(r io.Reader) ([]archiveEntry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	// The sizes come from the zip directory; reading a file past its
+	// size fails, so they cannot understate what is decompressed.
+	var budget archiveBudget
+	var entries []archiveEntry
+	for _, f := range zr.File {
+		if !f.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		// Sizes beyond int64 turn negative and are refused too.
+		if err := budget.add(int64(f.UncompressedSize64)); err != nil {
+			return nil, err
+		}
+		entries = append(entries, archiveEntry{f.Name, int64(f.UncompressedSize64), f.Open})
+	}
+	return entries, nil
+}
+
+// tarEntries reads documents as they come by, since tar entries can only
+// be read in order. Other files are skipped without being kept.
+func tarEntries(r io.Reader) ([]archiveEntry, error) {
+	var budget archiveBudget
+	var entries []archiveEntry
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := budget.add(header.Size); err != nil {
+			return nil, err
+		}
+
+		var content []byte
+		if FormatOf(header.Name) != "" && header.Size <= maxDocumentBytes {
+			if content, err = io.ReadAll(io.LimitReader(tr, header.Size)); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+			}
+		}
+		entries = append(entries, archiveEntry{header.Name, header.Size, func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(content)), nil
+		}})
+	}
+}
+
+// cleanEntryName makes an archive path relative to the archive root. Paths
+// that leave the root are refused.
+func cleanEntryName(name string) (string, bool) {
+	name = path.Clean(strings.TrimLeft(strings.ReplaceAll(name, `\`, "/"), "/"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
+
+// hidden reports whether name is inside a directory starting with a dot.
+func hidden(name string) bool {
+	dir := path.Dir(name)
+	return dir != "." && (strings.HasPrefix(dir, ".") || strings.Contains(dir, "/."))
+}
+
+// commonDir returns "dir/" if every name is inside the same top-level
+// directory, or "".
+func commonDir(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	dir, _, found := strings.Cut(names[0], "/")
+	if !found {
+		return ""
+	}
+	for _, name := range names[1:] {
+		if !strings.HasPrefix(name, dir+"/") {
+			return ""
+		}
+	}
+	return dir + "/"
+}
+
+// LocalLink is a link to a file or anchor inside the tree.
+type LocalLink struct {
+	Link
+	// Error says why the target does not exist; empty if it does.
+	Error string `json:"error,omitempty"`
+}
+
+// Report is what a scan found.
+type Report struct {
+	Documents int `json:"documents"`
+	// External are links to http and https URLs, each occurrence in file
+	// and line order.
+	External []Link `json:"external"`
+	// Local are links to files and anchors of the tree.
+	Local []LocalLink `json:"local"`
+	// Skipped counts links that are neither, such as mailto: links or
+	// targets built from template variables.
+	Skipped int `json:"skipped"`
+}
+
+// Scan extracts the links of every document and checks the local ones.
+func (t *Tree) Scan() *Report {
+	report := &Report{Documents: len(t.docs), External: []Link{}, Local: []LocalLink{}}
+
+	names := make([]string, 0, len(t.docs))
+	for name := range t.docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	anchors := make(map[string]map[string]bool)
+	anchorsOf := func(name string) map[string]bool {
+		if _, ok := anchors[name]; !ok {
+			anchors[name] = Anchors(name, t.docs[name])
+		}
+		return anchors[name]
+	}
+
+	for _, name := range names {
+		for _, link := range Extract(name, t.docs[name]) {
+			target := link.URL
+			switch {
+			case strings.HasPrefix(target, "//"):
+				link.URL = "https:" + target
+				report.External = append(report.External, link)
+			case strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "https://"):
+				report.External = append(report.External, link)
+			case hasScheme(target), strings.ContainsAny(target, "{}$"):
+				report.Skipped++
+			default:
+				report.Local = append(report.Local, LocalLink{Link: link, Error: t.check(name, target, anchorsOf)})
+			}
+		}
+	}
+	return report
+}
+
+// check resolves a relative link from the document it is in and reports
+// what is missing, if anything.
+func (t *Tree) check(from, target string, anchorsOf func(string) map[string]bool) string {
+	rawPath, fragment, _ := strings.Cut(target, "#")
+	rawPath, _, _ = strings.Cut(rawPath, "?")
+	if unescaped, err := url.PathUnescape(rawPath); err == nil {
+		rawPath = unescaped
+	}
+
+	file := from
+	if rawPath != "" {
+		if strings.HasPrefix(rawPath, "/") {
+			file = path.Clean(strings.TrimLeft(rawPath, "/"))
+		} else {
+			file = path.Join(path.Dir(from), rawPath)
+		}
+		if file == ".." || strings.HasPrefix(file, "../") {
+			return "target is outside the scanned files"
+		}
+		if !t.paths[file] {
+			// Generated sites link pages by their .html name.
+			source, ok := t.sourceOf(file)
+			if !ok {
+				return "file not found"
+			}
+			file = source
+		}
+	}
+
+	if fragment == "" {
+		return ""
+	}
+	if _, ok := t.docs[file]; !ok {
+		// Fragments of directories, images and the like are not checked.
+		return ""
+	}
+	if unescaped, err := url.PathUnescape(fragment); err == nil {
+		fragment = unescaped
+	}
+	if !anchorsOf(file)[fragment] {
+		return fmt.Sprintf("anchor #%s not found in %s", fragment, file)
+	}
+	return ""
+}
+
+// sourceOf finds the document an .html page is generated from.
+func (t *Tree) sourceOf(page string) (string, bool) {
+	if ext := path.Ext(page); ext == ".html" || ext == ".htm" {
+		stem := strings.TrimSuffix(page, ext)
+		for _, candidate := range []string{".md", ".rst", ".adoc", ".markdown", ".asciidoc"} {
+			if _, ok := t.docs[stem+candidate]; ok {
+				return stem + candidate, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Broken returns the local links whose target does not exist.
+func (r *Report) Broken() []LocalLink {
+	broken := []LocalLink{}
+	for _, link := range r.Local {
+		if link.Error != "" {
+			broken = append(broken, link)
+		}
+	}
+	return broken
+}
+
+// LocalResults turns the local links into results checked at checkedAt,
+// one for each occurrence, since the same target can resolve differently
+// from different files.
+func (r *Report) LocalResults(checkedAt time.Time) []storage.LinkResult {
+	results := make([]storage.LinkResult, 0, len(r.Local))
+	for _, link := range r.Local {
+		results = append(results, storage.LinkResult{
+			URL:       link.URL,
+			Available: link.Error == "",
+			CheckedAt: checkedAt.Format(time.RFC3339),
+			Error:     link.Error,
+			Sources:   []storage.LinkSource{{File: link.File, Line: link.Line}},
+		})
+	}
+	return results
+}
+
+// ExternalURLs returns each external URL once, in the order first found,
+// with every place it was found.
+func (r *Report) ExternalURLs() ([]string, map[string][]storage.LinkSource) {
+	var urls []string
+	sources := make(map[string][]storage.LinkSource)
+	for _, link := range r.External {
+		if _, seen := sources[link.URL]; !seen {
+			urls = append(urls, link.URL)
+		}
+		sources[link.URL] = append(sources[link.URL], storage.LinkSource{File: link.File, Line: link.Line})
+	}
+	return urls, sources
+}
+
+// hasScheme reports whether target starts with a URL scheme like mailto:.
+func hasScheme(target string) bool {
+	scheme, _, found := strings.Cut(target, ":")
+	if !found || scheme == "" {
+		return false
+	}
+	for i, r := range scheme {
+		isLetter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+		if !isLetter && (i == 0 || !(r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.')) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,265 @@
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// docsTree holds a small documentation site with a broken link of each
+// kind; the same files are used as a directory and as archives.
+var docsTree = map[string]string{
+	"README.md": "# Docs\n" +
+		"[guide](guide/intro.md#setup) [missing](guide/gone.md)\n" +
+		"[bad anchor](guide/intro.md#nope) [up](../secret.md)\n" +
+		"[page](guide/intro.html) [self](#docs) [image](img/logo.png)\n" +
+		"https://example.com [mail](mailto:team@example.com) [tpl]({{ .URL }})\n",
+	"guide/intro.md":     "## Setup\nBack to [index](/README.md) or [root](../README.md#docs).\nhttps://example.com\n",
+	"guide/api.rst":      "API\n===\n\n`Intro <intro.md#setup>`_\n",
+	"img/logo.png":       "png",
+	".git/config.md":     "[x](nowhere.md)\n",
+	"guide/index.html":   "<a href=\"../README.md#missing\">x</a>\n",
+	"guide/manual.adoc":  "== Usage\nSee <<_usage>> and xref:api.rst#api[API].\n",
+	"guide/notes.txt":    "https://ignored.example\n",
+	"guide/sub/deep.md":  "[up](../../README.md) [escape](../../../etc/passwd)\n",
+	"guide/sub/other.md": "[encoded](deep%2Emd)\n",
+}
+
+// wantBroken are the errors Scan reports for docsTree, by file and line.
+var wantBroken = []string{
+	"README.md:2 guide/gone.md: file not found",
+	"README.md:3 guide/intro.md#nope: anchor #nope not found in guide/intro.md",
+	"README.md:3 ../secret.md: target is outside the scanned files",
+	"guide/index.html:1 ../README.md#missing: anchor #missing not found in README.md",
+	"guide/sub/deep.md:1 ../../../etc/passwd: target is outside the scanned files",
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range docsTree {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sources := []struct {
+		name string
+		read func() (*Tree, error)
+	}{
+		{"directory", func() (*Tree, error) { return ReadDir(dir) }},
+		{"tar", func() (*Tree, error) { return ReadArchive(bytes.NewReader(tarOf(t, "docs/", docsTree))) }},
+		{"tar.gz", func() (*Tree, error) { return ReadArchive(bytes.NewReader(gzipOf(t, tarOf(t, "docs/", docsTree)))) }},
+		{"zip", func() (*Tree, error) { return ReadArchive(bytes.NewReader(zipOf(t, "", docsTree))) }},
+	}
+
+	for _, src := range sources {
+		t.Run(src.name, func(t *testing.T) {
+			tree, err := src.read()
+			if err != nil {
+				t.Fatalf("reading the tree: %v", err)
+			}
+			report := tree.Scan()
+
+			// .git is hidden and notes.txt is not a document.
+			if report.Documents != 7 {
+				t.Errorf("scanned %d documents, want 7", report.Documents)
+			}
+			if report.Skipped != 2 {
+				t.Errorf("skipped %d links, want 2", report.Skipped)
+			}
+
+			var broken []string
+			for _, link := range report.Broken() {
+				broken = append(broken, link.File+":"+strconv.Itoa(link.Line)+" "+link.URL+": "+link.Error)
+			}
+			if !slices.Equal(broken, wantBroken) {
+				t.Errorf("broken links:\n%s\nwant:\n%s", strings.Join(broken, "\n"), strings.Join(wantBroken, "\n"))
+			}
+
+			urls, sources := report.ExternalURLs()
+			if !slices.Equal(urls, []string{"https://example.com"}) || len(sources["https://example.com"]) != 2 {
+				t.Errorf("external URLs = %v with sources %v, want example.com found twice", urls, sources)
+			}
+		})
+	}
+}
+
+func TestLocalResults(t *testing.T) {
+	report := &Report{Local: []LocalLink{
+		{Link: Link{URL: "a.md", File: "README.md", Line: 3}},
+		{Link: Link{URL: "b.md", File: "README.md", Line: 4}, Error: "file not found"},
+	}}
+	checkedAt := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	results := report.LocalResults(checkedAt)
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	if !results[0].Available || results[1].Available || results[1].Error != "file not found" {
+		t.Errorf("results = %+v, want a.md available and b.md not", results)
+	}
+	if results[1].CheckedAt != "2026-01-01T00:00:00Z" || len(results[1].Sources) != 1 || results[1].Sources[0].Line != 4 {
+		t.Errorf("result %+v does not carry its check time and source", results[1])
+	}
+}
+
+// countingFile records whether it was closed.
+type countingFile struct {
+	io.Reader
+	closed *int
+}
+
+func (f countingFile) Close() error {
+	*f.closed++
+	return nil
+}
+
+func TestAddClosesDocuments(t *testing.T) {
+	tree := newTree()
+	opened, closed := 0, 0
+	open := func() (io.ReadCloser, error) {
+		opened++
+		return countingFile{strings.NewReader("# Title\n"), &closed}, nil
+	}
+
+	for i := range 100 {
+		name := "doc" + strconv.Itoa(i) + ".md"
+		if err := tree.add(name, 8, open); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tree.add("logo.png", 3, open); err != nil {
+		t.Fatal(err)
+	}
+	if opened != 100 || closed != opened {
+		t.Errorf("opened %d files and closed %d, want 100 of each", opened, closed)
+	}
+}
+
+func TestCleanEntryName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"docs/README.md", "docs/README.md", true},
+		{"./docs//guide/../README.md", "docs/README.md", true},
+		{"/etc/passwd", "etc/passwd", true},
+		{`docs\guide\intro.md`, "docs/guide/intro.md", true},
+		{"../outside.md", "", false},
+		{"docs/../../outside.md", "", false},
+		{`..\outside.md`, "", false},
+		{".", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := cleanEntryName(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("cleanEntryName(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestReadArchiveErrors(t *testing.T) {
+	many := make(map[string]string, maxArchiveFiles+1)
+	for i := range maxArchiveFiles + 1 {
+		many["f"+strconv.Itoa(i)] = ""
+	}
+
+	tests := []struct {
+		name    string
+		archive func() []byte
+		wantMsg string
+	}{
+		{"unsafe tar path", func() []byte { return tarOf(t, "", map[string]string{"../evil.md": "x"}) }, "unsafe path"},
+		{"unsafe zip path", func() []byte { return zipOf(t, "", map[string]string{"a/../../evil.md": "x"}) }, "unsafe path"},
+		{"too many files", func() []byte { return tarOf(t, "", many) }, "more than"},
+		{"too many bytes", func() []byte { return sparseTar(t, maxArchiveBytes+1) }, "bytes"},
+		{"broken gzip", func() []byte { return []byte{0x1f, 0x8b, 0, 0} }, ""},
+		{"broken zip", func() []byte { return []byte("PK\x03\x04garbage") }, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadArchive(bytes.NewReader(tt.archive()))
+			if !errors.Is(err, ErrInvalidArchive) {
+				t.Fatalf("error = %v, want ErrInvalidArchive", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("error = %v, want it to mention %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func tarOf(t *testing.T, prefix string, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		content := files[name]
+		if err := tw.WriteHeader(&tar.Header{Name: prefix + name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(tw, content)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// sparseTar is a tar whose only entry claims size bytes; ReadArchive must
+// refuse it from the header, before reading the content.
+func sparseTar(t *testing.T, size int64) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "big.bin", Mode: 0644, Size: size, Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipOf(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipOf(t *testing.T, prefix string, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		w, err := zw.Create(prefix + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, files[name])
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,266 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"linkChecker/internal/checker"
+)
+
+// Priority bounds for batches. The default priority is 0.
+const (
+	MinPriority = -10
+	MaxPriority = 10
+)
+
+// priorityWeight turns a priority into a round-robin weight: a batch at
+// MaxPriority gets 21 requests for every one of a batch at MinPriority.
+func priorityWeight(priority int) int {
+	if priority < MinPriority {
+		priority = MinPriority
+	}
+	if priority > MaxPriority {
+		priority = MaxPriority
+	}
+	return priority - MinPriority + 1
+}
+
+// lane is the URLs of one running batch waiting for the dispatcher.
+type lane struct {
+	ctx      context.Context
+	tenant   string
+	weight   int
+	urls     []string
+	next     int
+	inFlight int
+	current  int
+	onResult checker.ResultFunc
+	resultMu sync.Mutex
+	done     chan struct{}
+}
+
+func (l *lane) eligible(limit int) bool {
+	return l.ctx.Err() == nil && l.next < len(l.urls) && l.inFlight < limit
+}
+
+func (l *lane) finished() bool {
+	return l.inFlight == 0 && (l.next == len(l.urls) || l.ctx.Err() != nil)
+}
+
+// tenantGroup holds the running batches of one tenant.
+type tenantGroup struct {
+	name    string
+	lanes   []*lane
+	current int
+}
+
+// dispatcher checks the URLs of all running batches with one shared pool
+// of requests. It interleaves URLs with smooth weighted round-robin, first
+// between tenants and then between the batches of a tenant, so a large
+// low-priority batch cannot starve a small interactive one. Tenants are
+// taken from the API key, not from anything the client sends. No batch may
+// use more than perBatch requests at a time.
+type dispatcher struct {
+	checker     *checker.LinkChecker
+	concurrency int
+	perBatch    int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	groups  []*tenantGroup
+	stopped bool
+}
+
+func newDispatcher(lc *checker.LinkChecker, concurrency, perBatch int) *dispatcher {
+	if perBatch <= 0 || perBatch > concurrency {
+		perBatch = concurrency
+	}
+
+	d := &dispatcher{checker: lc, concurrency: concurrency, perBatch: perBatch}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+// start launches the request workers. They run until stop is called.
+func (d *dispatcher) start() {
+	for i := 0; i < d.concurrency; i++ {
+		go d.work()
+	}
+}
+
+// stop makes the workers exit once no batch is left. Callers must not
+// queue URLs after calling it.
+func (d *dispatcher) stop() {
+	d.mu.Lock()
+	d.stopped = true
+	d.cond.Broadcast()
+	d.mu.Unlock()
+}
+
+// check queues the URLs of a batch and blocks until all of them are checked
+// or ctx is cancelled and the requests in flight have returned. onResult is
+// never called concurrently for the same batch.
+func (d *dispatcher) check(ctx context.Context, tenant string, priority int, urls []string, onResult checker.ResultFunc) {
+	if len(urls) == 0 {
+		return
+	}
+
+	l := &lane{
+		ctx:      ctx,
+		tenant:   tenant,
+		weight:   priorityWeight(priority),
+		urls:     urls,
+		onResult: onResult,
+		done:     make(chan struct{}),
+	}
+
+	d.mu.Lock()
+	group := d.groupLocked(tenant)
+	group.lanes = append(group.lanes, l)
+	d.cond.Broadcast()
+	d.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return
+	case <-ctx.Done():
+	}
+
+	d.mu.Lock()
+	d.finishLocked(l)
+	d.mu.Unlock()
+	<-l.done
+}
+
+func (d *dispatcher) work() {
+	for {
+		d.mu.Lock()
+		l, index := d.pickLocked()
+		for l == nil {
+			if d.stopped && len(d.groups) == 0 {
+				d.mu.Unlock()
+				return
+			}
+			d.cond.Wait()
+			l, index = d.pickLocked()
+		}
+		l.inFlight++
+		d.mu.Unlock()
+
+		result := d.checkURL(l.ctx, l.urls[index])
+
+		l.resultMu.Lock()
+		l.onResult(index, result)
+		l.resultMu.Unlock()
+
+		d.mu.Lock()
+		l.inFlight--
+		d.finishLocked(l)
+		d.cond.Broadcast()
+		d.mu.Unlock()
+	}
+}
+
+// checkURL protects the pool against panics in a single check.
+func (d *dispatcher) checkURL(ctx context.Context, rawURL string) (result checker.StatusResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = checker.StatusResult{
+				URL:       rawURL,
+				Error:     fmt.Sprintf("panic during check: %v", r),
+				CheckedAt: time.Now().Format(time.RFC3339),
+			}
+		}
+	}()
+	return d.checker.CheckURL(ctx, rawURL)
+}
+
+// pickLocked chooses the next URL to check, or returns nil if no batch may
+// start another request right now.
+func (d *dispatcher) pickLocked() (*lane, int) {
+	var group *tenantGroup
+	total := 0
+	for _, g := range d.groups {
+		weight := g.weightLocked(d.perBatch)
+		if weight == 0 {
+			continue
+		}
+		g.current += weight
+		total += weight
+		if group == nil || g.current > group.current {
+			group = g
+		}
+	}
+	if group == nil {
+		return nil, 0
+	}
+	group.current -= total
+
+	var chosen *lane
+	total = 0
+	for _, l := range group.lanes {
+		if !l.eligible(d.perBatch) {
+			continue
+		}
+		l.current += l.weight
+		total += l.weight
+		if chosen == nil || l.current > chosen.current {
+			chosen = l
+		}
+	}
+	chosen.current -= total
+
+	index := chosen.next
+	chosen.next++
+	return chosen, index
+}
+
+// weightLocked is the weight of a tenant: that of its most important batch
+// that can take another request, so submitting many batches does not earn a
+// bigger share.
+func (g *tenantGroup) weightLocked(perBatch int) int {
+	weight := 0
+	for _, l := range g.lanes {
+		if l.eligible(perBatch) && l.weight > weight {
+			weight = l.weight
+		}
+	}
+	return weight
+}
+
+func (d *dispatcher) groupLocked(tenant string) *tenantGroup {
+	for _, g := range d.groups {
+		if g.name == tenant {
+			return g
+		}
+	}
+	g := &tenantGroup{name: tenant}
+	d.groups = append(d.groups, g)
+	return g
+}
+
+// finishLocked removes a lane once nothing more will happen to it.
+func (d *dispatcher) finishLocked(l *lane) {
+	if !l.finished() {
+		return
+	}
+
+	for gi, g := range d.groups {
+		if g.name != l.tenant {
+			continue
+		}
+		for i, candidate := range g.lanes {
+			if candidate == l {
+				g.lanes = append(g.lanes[:i], g.lanes[i+1:]...)
+				close(l.done)
+				break
+			}
+		}
+		if len(g.lanes) == 0 {
+			d.groups = append(d.groups[:gi], d.groups[gi+1:]...)
+		}
+		return
+	}
+}
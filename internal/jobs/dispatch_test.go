@@ -0,0 +1,211 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"linkChecker/internal/checker"
+)
+
+func TestPriorityWeight(t *testing.T) {
+	tests := []struct {
+		priority int
+		want     int
+	}{
+		{MinPriority, 1},
+		{0, 11},
+		{MaxPriority, 21},
+		{MinPriority - 5, 1},
+		{MaxPriority + 5, 21},
+	}
+	for _, tt := range tests {
+		if got := priorityWeight(tt.priority); got != tt.want {
+			t.Errorf("priorityWeight(%d) = %d, want %d", tt.priority, got, tt.want)
+		}
+	}
+}
+
+// lanePlan is one batch queued on the dispatcher in a test.
+type lanePlan struct {
+	tenant   string
+	priority int
+	urls     int
+}
+
+func TestDispatcherFairness(t *testing.T) {
+	tests := []struct {
+		name  string
+		lanes []lanePlan
+		// want is the tenant of each of the first requests.
+		want string
+	}{
+		{
+			name:  "tenants alternate",
+			lanes: []lanePlan{{"a", 0, 6}, {"b", 0, 3}},
+			want:  "ababab",
+		},
+		{
+			name:  "more batches do not earn a bigger share",
+			lanes: []lanePlan{{"a", 0, 4}, {"a", 0, 4}, {"b", 0, 4}},
+			want:  "abababab",
+		},
+		{
+			name:  "higher priority gets more requests",
+			lanes: []lanePlan{{"a", MaxPriority, 8}, {"b", MinPriority, 8}},
+			want:  "aaaaaaaa",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var order strings.Builder
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				order.WriteString(strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")[0])
+				mu.Unlock()
+			}))
+			defer server.Close()
+
+			lc, err := checker.NewLinkChecker(5 * time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// One request at a time makes the order of requests the order
+			// in which the dispatcher picks URLs.
+			d := newDispatcher(lc, 1, 1)
+
+			var wg sync.WaitGroup
+			for i, plan := range tt.lanes {
+				urls := make([]string, plan.urls)
+				for j := range urls {
+					urls[j] = fmt.Sprintf("%s/%s/%d/%d", server.URL, plan.tenant, i, j)
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					d.check(context.Background(), plan.tenant, plan.priority, urls, func(int, checker.StatusResult) {})
+				}()
+				waitFor(t, func() bool { return d.lanes() == i+1 })
+			}
+
+			d.start()
+			wg.Wait()
+			d.stop()
+
+			if got := order.String(); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("requests went to %s, want them to start with %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcherPerBatchLimit(t *testing.T) {
+	const perBatch = 2
+
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		mu.Unlock()
+		<-release
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	lc, err := checker.NewLinkChecker(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newDispatcher(lc, 8, perBatch)
+	d.start()
+	defer d.stop()
+
+	urls := make([]string, 6)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%s/%d", server.URL, i)
+	}
+	results := 0
+	done := make(chan struct{})
+	go func() {
+		d.check(context.Background(), "a", 0, urls, func(int, checker.StatusResult) { results++ })
+		close(done)
+	}()
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return inFlight == perBatch
+	})
+	close(release)
+	<-done
+
+	if peak != perBatch {
+		t.Errorf("at most %d requests ran at once, want %d", peak, perBatch)
+	}
+	if results != len(urls) {
+		t.Errorf("got %d results, want %d", results, len(urls))
+	}
+}
+
+func TestDispatcherCancel(t *testing.T) {
+	lc, err := checker.NewLinkChecker(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without workers nothing is checked, so only cancelling ends check.
+	d := newDispatcher(lc, 1, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.check(ctx, "a", 0, []string{"http://example.invalid/"}, func(int, checker.StatusResult) {
+			t.Error("a URL was checked")
+		})
+		close(done)
+	}()
+	waitFor(t, func() bool { return d.lanes() == 1 })
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("check did not return after cancel")
+	}
+	if n := d.lanes(); n != 0 {
+		t.Errorf("%d lanes left after cancel, want 0", n)
+	}
+}
+
+// lanes counts the batches queued on the dispatcher.
+func (d *dispatcher) lanes() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, g := range d.groups {
+		n += len(g.lanes)
+	}
+	return n
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
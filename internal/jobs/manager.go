@@ -0,0 +1,429 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"linkChecker/internal/checker"
+	"linkChecker/internal/events"
+	"linkChecker/internal/logging"
+	"linkChecker/internal/storage"
+	"linkChecker/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("jobs")
+
+// progressTickInterval is how often a running batch publishes a progress event.
+const progressTickInterval = time.Second
+
+// Event types published to the broker for every batch.
+const (
+	EventResult   = "result"
+	EventProgress = "progress"
+	EventComplete = "complete"
+)
+
+// ResultEvent is published after each checked URL.
+type ResultEvent struct {
+	Result   storage.LinkResult `json:"result"`
+	Progress storage.Progress   `json:"progress"`
+}
+
+// CompleteEvent is the last event of a batch stream.
+type CompleteEvent struct {
+	Status   string           `json:"status"`
+	Progress storage.Progress `json:"progress"`
+}
+
+var (
+	ErrNotRunning = errors.New("batch is not running")
+	ErrFinished   = errors.New("batch has already finished")
+)
+
+// Notifier is told about batch outcomes worth pushing to the outside world.
+type Notifier interface {
+	BatchFinished(batch *storage.LinkBatch)
+	FailureThresholdCrossed(batch *storage.LinkBatch)
+	// FailureThreshold returns the share of unavailable links that should
+	// trigger FailureThresholdCrossed, or 0 to disable it.
+	FailureThreshold(batch *storage.LinkBatch) float64
+}
+
+// job is the handle of a batch being checked in the background.
+type job struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Limits bounds how much checking work runs at the same time.
+type Limits struct {
+	// Batches is how many batches are taken from the queue at once.
+	Batches int
+	// Requests is how many URLs are checked at once across all batches.
+	Requests int
+	// RequestsPerBatch caps the share of Requests a single batch may use.
+	RequestsPerBatch int
+}
+
+// Manager queues batches and checks them with a fixed pool of workers,
+// keeping a cancellable handle for each running batch. URLs of running
+// batches share one pool of requests, see dispatcher.
+type Manager struct {
+	storage  *storage.Storage
+	events   *events.Broker
+	notify   Notifier
+	workers  int
+	queue    *queue
+	dispatch *dispatcher
+
+	mu      sync.Mutex
+	running map[int64]*job
+}
+
+// NewManager creates a manager. notifier may be nil. Call Run to start
+// taking batches from the queue.
+func NewManager(checker *checker.LinkChecker, storage *storage.Storage, broker *events.Broker, notifier Notifier, limits Limits) *Manager {
+	if limits.Batches <= 0 {
+		limits.Batches = 1
+	}
+	if limits.Requests <= 0 {
+		limits.Requests = 1
+	}
+	return &Manager{
+		storage:  storage,
+		events:   broker,
+		notify:   notifier,
+		workers:  limits.Batches,
+		queue:    newQueue(),
+		dispatch: newDispatcher(checker, limits.Requests, limits.RequestsPerBatch),
+		running:  make(map[int64]*job),
+	}
+}
+
+// Submit stores a new batch and puts it in the queue. The batch is traced as
+// a child of the span in ctx. sources, which may be nil, tells where each
+// URL was found; checked, which may be nil too, holds results that need no
+// request, see storage.SaveBatch.
+func (m *Manager) Submit(ctx context.Context, urls []string, meta storage.BatchMetadata, notify *storage.NotifySettings, priority int, sources map[string][]storage.LinkSource, checked []storage.LinkResult) (int64, error) {
+	batchID, err := m.storage.SaveBatch(urls, meta, notify, priority, sources, checked)
+	if err != nil {
+		return 0, err
+	}
+	if err := m.Enqueue(ctx, batchID); err != nil {
+		return batchID, err
+	}
+	return batchID, nil
+}
+
+// Run starts the worker pool. Workers stop taking batches from the queue
+// once ctx is done; batches already being checked run to completion, after
+// which the request workers exit too.
+func (m *Manager) Run(ctx context.Context) {
+	m.dispatch.start()
+
+	var workers sync.WaitGroup
+	for i := 0; i < m.workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				item, ok := m.queue.pop(ctx)
+				if !ok {
+					return
+				}
+				m.run(item)
+			}
+		}()
+	}
+
+	go func() {
+		workers.Wait()
+		m.dispatch.stop()
+	}()
+}
+
+// Enqueue marks the batch as pending and queues it for a worker. A batch
+// that was being checked when the server stopped goes back to pending too.
+func (m *Manager) Enqueue(ctx context.Context, batchID int64) error {
+	batch, err := m.storage.GetBatch(batchID)
+	if err != nil {
+		return err
+	}
+
+	if batch.Status != "pending" {
+		if err := m.storage.UpdateBatch(batchID, batch.Results, "pending"); err != nil {
+			return err
+		}
+	}
+
+	m.queue.push(queueItem{
+		batchID:  batchID,
+		priority: batch.Priority,
+		queuedAt: time.Now(),
+		origin:   trace.SpanContextFromContext(ctx),
+	})
+	return nil
+}
+
+// QueuePosition returns the 1-based place of a pending batch in the queue.
+func (m *Manager) QueuePosition(batchID int64) (int, bool) {
+	return m.queue.position(batchID)
+}
+
+// QueueLength returns how many batches are waiting for a worker.
+func (m *Manager) QueueLength() int {
+	return m.queue.len()
+}
+
+// run checks the remaining URLs of a batch. Results already stored for the
+// batch are kept, so a resumed batch only checks what is left.
+func (m *Manager) run(item queueItem) {
+	batchID := item.batchID
+
+	// Holding the lock until the job is registered keeps Cancel from
+	// missing a batch that has just left the queue.
+	m.mu.Lock()
+	batch, err := m.storage.GetBatch(batchID)
+	if err != nil || batch.Status != "pending" {
+		m.mu.Unlock()
+		return
+	}
+
+	// Checker logs and spans are tied to the batch through ctx. The batch
+	// span starts when the batch was queued; its first child is the wait.
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), item.origin)
+	ctx, span := tracer.Start(ctx, "batch",
+		trace.WithTimestamp(item.queuedAt),
+		trace.WithAttributes(
+			attribute.String("linkchecker.batch_id", batch.PublicID),
+			attribute.String("linkchecker.tenant", batch.Tenant),
+			attribute.Int("linkchecker.priority", batch.Priority),
+			attribute.Int("linkchecker.urls", len(batch.URLs)),
+			attribute.Int("linkchecker.resumed_results", len(batch.Results)),
+		),
+	)
+	_, wait := tracer.Start(ctx, "batch.queued", trace.WithTimestamp(item.queuedAt))
+	wait.End()
+
+	ctx, cancel := context.WithCancel(logging.With(tracing.WithLogIDs(ctx), "batch_id", batch.PublicID))
+	j := &job{cancel: cancel, done: make(chan struct{})}
+	m.running[batchID] = j
+	m.storage.UpdateBatch(batchID, batch.Results, "processing")
+	m.mu.Unlock()
+
+	urls := batch.PendingURLs()
+	slog.InfoContext(ctx, "Batch started", "urls", len(urls), "checked", len(batch.Results), "priority", batch.Priority)
+
+	defer func() {
+		cancel()
+		span.End()
+		m.mu.Lock()
+		delete(m.running, batchID)
+		m.mu.Unlock()
+		close(j.done)
+	}()
+
+	var (
+		progressMu  sync.Mutex
+		done        = len(batch.Results)
+		total       = len(batch.URLs)
+		resumedFrom = done
+		started     = time.Now()
+		unavailable = countUnavailable(batch.Results)
+		threshold   = m.failureThreshold(batch)
+	)
+	// The ETA only uses the pace of this run, so a resumed batch is not
+	// skewed by the time the server was down.
+	progress := func() storage.Progress {
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		p := storage.NewProgress(done, total, 0)
+		if checked := done - resumedFrom; checked > 0 && done < total {
+			p.ETASeconds = time.Since(started).Seconds() / float64(checked) * float64(total-done)
+		}
+		return p
+	}
+
+	stopTicks := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(progressTickInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopTicks:
+				return
+			case <-ticker.C:
+				m.events.Publish(batchID, EventProgress, progress())
+			}
+		}
+	}()
+
+	// Requests are shared fairly between tenants; owner is set by the client
+	// and could be used to claim extra shares.
+	m.dispatch.check(ctx, batch.Tenant, batch.Priority, urls, func(_ int, result checker.StatusResult) {
+		if checker.IsCancelled(result) {
+			return
+		}
+		linkResult := toLinkResult(result)
+		m.storage.AppendResult(batchID, linkResult)
+
+		progressMu.Lock()
+		done++
+		progressMu.Unlock()
+		m.events.Publish(batchID, EventResult, ResultEvent{Result: linkResult, Progress: progress()})
+
+		if !linkResult.Available {
+			unavailable++
+			if threshold > 0 && float64(unavailable)/float64(total) >= threshold {
+				m.thresholdCrossed(batchID)
+			}
+		}
+	})
+	close(stopTicks)
+
+	// A cancel that arrives after the last result has nothing left to stop.
+	status := "completed"
+	if ctx.Err() != nil && done < total {
+		status = "cancelled"
+	}
+
+	span.SetAttributes(attribute.String("linkchecker.status", status), attribute.Int("linkchecker.unavailable", unavailable))
+	m.finish(batchID, batch.PublicID, status)
+	m.events.Publish(batchID, EventComplete, CompleteEvent{Status: status, Progress: progress()})
+	m.events.Close(batchID)
+}
+
+// finish stores the final status with results put back in submission order.
+func (m *Manager) finish(batchID int64, publicID, status string) {
+	batch, err := m.storage.GetBatch(batchID)
+	if err != nil {
+		slog.Error("Batch disappeared before finishing", "batch_id", publicID, "error", err)
+		return
+	}
+
+	m.storage.UpdateBatch(batchID, batch.OrderedResults(), status)
+	slog.Info("Batch finished", "batch_id", publicID, "status", status, "results", len(batch.Results))
+
+	m.notifyFinished(batchID)
+}
+
+func (m *Manager) notifyFinished(batchID int64) {
+	if m.notify == nil {
+		return
+	}
+	if batch, err := m.storage.GetBatch(batchID); err == nil {
+		m.notify.BatchFinished(batch)
+	}
+}
+
+func (m *Manager) failureThreshold(batch *storage.LinkBatch) float64 {
+	if m.notify == nil || (batch.Notify != nil && batch.Notify.ThresholdFired) {
+		return 0
+	}
+	return m.notify.FailureThreshold(batch)
+}
+
+// thresholdCrossed notifies at most once per batch, even across restarts.
+func (m *Manager) thresholdCrossed(batchID int64) {
+	first, err := m.storage.MarkThresholdFired(batchID)
+	if err != nil || !first {
+		return
+	}
+	if batch, err := m.storage.GetBatch(batchID); err == nil {
+		m.notify.FailureThresholdCrossed(batch)
+	}
+}
+
+// Cancel stops a running batch and waits until its partial results are
+// stored. Queued batches, and batches left pending without a worker, are
+// marked cancelled directly.
+func (m *Manager) Cancel(ctx context.Context, batchID int64) error {
+	m.mu.Lock()
+	if j, ok := m.running[batchID]; ok {
+		m.mu.Unlock()
+		j.cancel()
+		select {
+		case <-j.done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// The lock stays held until the status is written: a worker that has
+	// just popped the batch waits in run, then sees it is no longer pending.
+	m.queue.remove(batchID)
+	batch, err := m.storage.GetBatch(batchID)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	switch batch.Status {
+	case "pending":
+	case "processing":
+		// Processing batches are always registered in m.running, so this
+		// one is left over and belongs to no worker that could be stopped.
+		m.mu.Unlock()
+		return fmt.Errorf("%w: status is processing without a worker", ErrNotRunning)
+	default:
+		m.mu.Unlock()
+		return fmt.Errorf("%w: status is %s", ErrFinished, batch.Status)
+	}
+
+	// A batch whose URLs were all checked before it was stopped, such as one
+	// interrupted while finishing, is complete rather than cancelled.
+	status := "cancelled"
+	results := batch.Results
+	if len(batch.PendingURLs()) == 0 {
+		status = "completed"
+		results = batch.OrderedResults()
+	}
+	err = m.storage.UpdateBatch(batchID, results, status)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	m.events.Publish(batchID, EventComplete, CompleteEvent{Status: status, Progress: batch.Progress(time.Now())})
+	m.events.Close(batchID)
+	m.notifyFinished(batchID)
+	return nil
+}
+
+// Delete cancels the batch if it is still running and removes it from storage.
+func (m *Manager) Delete(ctx context.Context, batchID int64) error {
+	if err := m.Cancel(ctx, batchID); err != nil && !errors.Is(err, ErrFinished) && !errors.Is(err, ErrNotRunning) {
+		return err
+	}
+	return m.storage.DeleteBatch(batchID)
+}
+
+func countUnavailable(results []storage.LinkResult) int {
+	count := 0
+	for _, result := range results {
+		if !result.Available {
+			count++
+		}
+	}
+	return count
+}
+
+// toLinkResult converts a checker result to the storage format.
+func toLinkResult(result checker.StatusResult) storage.LinkResult {
+	return storage.LinkResult{
+		URL:       result.URL,
+		Status:    result.Status,
+		Available: result.Available,
+		CheckedAt: result.CheckedAt,
+		Error:     result.Error,
+
+		ResponseTimeMs: result.ResponseTimeMs,
+	}
+}
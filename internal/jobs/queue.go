@@ -0,0 +1,125 @@
+package jobs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// queueItem is a batch waiting for a worker.
+type queueItem struct {
+	batchID  int64
+	priority int
+	// queuedAt and origin, the span that queued the batch, let the batch
+	// span show how long it waited.
+	queuedAt time.Time
+	origin   trace.SpanContext
+}
+
+// queue orders waiting batches by priority, highest first, and by batch ID
+// within the same priority. Batch IDs only grow, so that is FIFO order.
+// The queue itself lives in memory; pending batches in storage are its
+// durable form and are enqueued again on restart.
+type queue struct {
+	mu    sync.Mutex
+	items []queueItem
+	ready chan struct{}
+}
+
+func newQueue() *queue {
+	return &queue{ready: make(chan struct{}, 1)}
+}
+
+func (q *queue) push(item queueItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, existing := range q.items {
+		if existing.batchID == item.batchID {
+			return
+		}
+	}
+
+	i := sort.Search(len(q.items), func(i int) bool {
+		return less(item, q.items[i])
+	})
+	q.items = append(q.items, queueItem{})
+	copy(q.items[i+1:], q.items[i:])
+	q.items[i] = item
+
+	q.signal()
+}
+
+// pop blocks until a batch is available or ctx is done.
+func (q *queue) pop(ctx context.Context) (queueItem, bool) {
+	for ctx.Err() == nil {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			item := q.items[0]
+			q.items = q.items[1:]
+			if len(q.items) > 0 {
+				q.signal()
+			}
+			q.mu.Unlock()
+			return item, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+		case <-q.ready:
+		}
+	}
+	return queueItem{}, false
+}
+
+// remove takes a batch out of the queue and reports whether it was there.
+func (q *queue) remove(batchID int64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, item := range q.items {
+		if item.batchID == batchID {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// position returns the 1-based place of a batch in the queue.
+func (q *queue) position(batchID int64) (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, item := range q.items {
+		if item.batchID == batchID {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// signal wakes one waiting worker without blocking.
+func (q *queue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func less(a, b queueItem) bool {
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	return a.batchID < b.batchID
+}
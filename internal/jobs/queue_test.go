@@ -0,0 +1,101 @@
+package jobs
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestQueueOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []queueItem
+		want  []int64
+	}{
+		{
+			name:  "same priority is first in, first out",
+			items: []queueItem{{batchID: 3}, {batchID: 1}, {batchID: 2}},
+			want:  []int64{1, 2, 3},
+		},
+		{
+			name:  "higher priority first",
+			items: []queueItem{{batchID: 1, priority: -5}, {batchID: 2}, {batchID: 3, priority: 10}},
+			want:  []int64{3, 2, 1},
+		},
+		{
+			name:  "duplicates are queued once",
+			items: []queueItem{{batchID: 1}, {batchID: 2}, {batchID: 1, priority: 5}},
+			want:  []int64{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newQueue()
+			for _, item := range tt.items {
+				q.push(item)
+			}
+
+			for i, id := range tt.want {
+				if pos, ok := q.position(id); !ok || pos != i+1 {
+					t.Errorf("position(%d) = %d, %v, want %d", id, pos, ok, i+1)
+				}
+			}
+
+			var got []int64
+			for q.len() > 0 {
+				item, ok := q.pop(context.Background())
+				if !ok {
+					t.Fatal("pop failed with items left")
+				}
+				got = append(got, item.batchID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("popped %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueRemove(t *testing.T) {
+	q := newQueue()
+	q.push(queueItem{batchID: 1})
+	q.push(queueItem{batchID: 2})
+
+	if !q.remove(1) {
+		t.Error("remove(1) = false, want true")
+	}
+	if q.remove(1) {
+		t.Error("second remove(1) = true, want false")
+	}
+	if pos, ok := q.position(2); !ok || pos != 1 {
+		t.Errorf("position(2) = %d, %v, want 1", pos, ok)
+	}
+}
+
+func TestQueuePopWaits(t *testing.T) {
+	q := newQueue()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, ok := q.pop(ctx); ok {
+		t.Fatal("pop of an empty queue returned an item")
+	}
+
+	popped := make(chan int64)
+	go func() {
+		item, _ := q.pop(context.Background())
+		popped <- item.batchID
+	}()
+	q.push(queueItem{batchID: 7})
+
+	select {
+	case id := <-popped:
+		if id != 7 {
+			t.Errorf("popped %d, want 7", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pop did not wake up after push")
+	}
+}
@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Formats accepted by Options.Format.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options controls the output of the server logs.
+type Options struct {
+	// Level is debug, info, warn or error. At debug every URL check logs
+	// its lifecycle.
+	Level string
+	// Format is text or json.
+	Format string
+}
+
+// level is shared by every logger Setup creates, so SetLevel takes effect
+// without rebuilding them.
+var level slog.LevelVar
+
+// ParseLevel parses a level name; an empty name means info.
+func ParseLevel(name string) (slog.Level, error) {
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: use debug, info, warn or error", name)
+	}
+	return l, nil
+}
+
+// Setup makes slog's default logger write to w with the given options.
+// Messages from the standard log package end up there too, at info level.
+func Setup(w io.Writer, opts Options) error {
+	l, err := ParseLevel(opts.Level)
+	if err != nil {
+		return err
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: &level}
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", FormatText:
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return fmt.Errorf("invalid log format %q: use text or json", opts.Format)
+	}
+
+	level.Set(l)
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	return nil
+}
+
+// SetLevel changes the level of the loggers created by Setup.
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// Level returns the current level.
+func Level() slog.Level {
+	return level.Level()
+}
+
+type attrsKey struct{}
+
+// With returns a context whose log records carry the given attributes, such
+// as a request or batch ID, in addition to those already in ctx. They are
+// added to every record logged with the *Context functions of slog.
+func With(ctx context.Context, args ...any) context.Context {
+	attrs := append(attrsFrom(ctx), slog.Group("", args...).Value.Group()...)
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+func attrsFrom(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	// Copy, so contexts derived from the same parent do not share appends.
+	return append([]slog.Attr(nil), attrs...)
+}
+
+// contextHandler adds the attributes stored by With to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
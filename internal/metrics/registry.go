@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the Prometheus text exposition format written by Registry.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// labelSeparator joins label values into a series key. It cannot appear in
+// valid UTF-8, so keys never collide.
+const labelSeparator = "\xff"
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds metrics and writes them in the Prometheus text format.
+// It needs no Prometheus server: WriteTo works on any writer, so the
+// output can be inspected directly.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteTo writes every metric in registration order.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	counter := &countingWriter{w: w}
+	buf := bufio.NewWriter(counter)
+	for _, m := range metrics {
+		m.write(buf)
+	}
+	err := buf.Flush()
+	return counter.n, err
+}
+
+// Handler serves the registry, for GET /metrics.
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteTo(w)
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// desc is the name, help and labels shared by every kind of metric.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) writeHeader(w *bufio.Writer) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, help, d.name, d.kind)
+}
+
+// series formats name{labels} for one set of label values; extra adds a
+// trailing label such as le for histogram buckets.
+func (d desc) series(name string, values []string, extra ...string) string {
+	if len(d.labels) == 0 && len(extra) == 0 {
+		return name
+	}
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	pairs := 0
+	pair := func(label, value string) {
+		if pairs > 0 {
+			b.WriteByte(',')
+		}
+		pairs++
+		b.WriteString(label)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(value))
+		b.WriteByte('"')
+	}
+	for i, label := range d.labels {
+		pair(label, values[i])
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pair(extra[i], extra[i+1])
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func splitKey(key string, labels int) []string {
+	if labels == 0 {
+		return nil
+	}
+	return strings.Split(key, labelSeparator)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
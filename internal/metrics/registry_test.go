@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(r *Registry)
+		want     string
+	}{
+		{
+			name: "counter with labels in sorted order",
+			register: func(r *Registry) {
+				c := r.NewCounterVec("checks_total", "Checked links.", "outcome")
+				c.Inc("unavailable")
+				c.Add(2, "available")
+			},
+			want: `# HELP checks_total Checked links.
+# TYPE checks_total counter
+checks_total{outcome="available"} 2
+checks_total{outcome="unavailable"} 1
+`,
+		},
+		{
+			name: "gauge",
+			register: func(r *Registry) {
+				g := r.NewGauge("queue_length", "Batches waiting.")
+				g.Set(3)
+				g.Dec()
+			},
+			want: `# HELP queue_length Batches waiting.
+# TYPE queue_length gauge
+queue_length 2
+`,
+		},
+		{
+			name: "histogram buckets are cumulative",
+			register: func(r *Registry) {
+				h := r.NewHistogramVec("duration_seconds", "Durations.", []float64{1, 0.5}, "handler")
+				h.Observe(0.2, "/check")
+				h.Observe(0.7, "/check")
+				h.Observe(3, "/check")
+			},
+			want: `# HELP duration_seconds Durations.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{handler="/check",le="0.5"} 1
+duration_seconds_bucket{handler="/check",le="1"} 2
+duration_seconds_bucket{handler="/check",le="+Inf"} 3
+duration_seconds_sum{handler="/check"} 3.9
+duration_seconds_count{handler="/check"} 3
+`,
+		},
+		{
+			name: "label values and help are escaped",
+			register: func(r *Registry) {
+				r.NewGaugeFunc("info", "Line one\nline \\two.", "name", func() map[string]float64 {
+					return map[string]float64{"say \"hi\"\n": 1}
+				})
+			},
+			want: `# HELP info Line one\nline \\two.
+# TYPE info gauge
+info{name="say \"hi\"\n"} 1
+`,
+		},
+		{
+			name: "func without label and infinite values",
+			register: func(r *Registry) {
+				r.NewCounterFunc("total", "Total.", "", func() map[string]float64 {
+					return map[string]float64{"": math.Inf(1)}
+				})
+			},
+			want: `# HELP total Total.
+# TYPE total counter
+total +Inf
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			tt.register(r)
+
+			var b strings.Builder
+			n, err := r.WriteTo(&b)
+			if err != nil {
+				t.Fatalf("WriteTo: %v", err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("WriteTo wrote\n%s\nwant\n%s", got, tt.want)
+			}
+			if n != int64(b.Len()) {
+				t.Errorf("WriteTo returned %d, wrote %d bytes", n, b.Len())
+			}
+		})
+	}
+}
+
+func TestRegistryDuplicateName(t *testing.T) {
+	r := NewRegistry()
+	r.NewGauge("up", "Up.")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a name twice did not panic")
+		}
+	}()
+	r.NewCounterVec("up", "Up again.")
+}
@@ -0,0 +1,27 @@
+package metrics
+
+// Default holds the metrics of the server, served on GET /metrics.
+var Default = NewRegistry()
+
+// Metrics recorded by the packages of the server. Values that are already
+// tracked elsewhere, such as the queue length, are registered by main with
+// NewGaugeFunc instead.
+var (
+	ChecksTotal = Default.NewCounterVec("linkchecker_checks_total",
+		"URLs checked, by outcome and error class.", "outcome", "error_class")
+	CheckDuration = Default.NewHistogramVec("linkchecker_check_duration_seconds",
+		"Time taken to check one URL.", nil)
+	ChecksInFlight = Default.NewGauge("linkchecker_checks_in_flight",
+		"URLs being checked right now.")
+
+	PDFDuration = Default.NewHistogramVec("linkchecker_pdf_generation_seconds",
+		"Time taken to generate a PDF, by report type.", nil, "report")
+
+	StorageWriteErrors = Default.NewCounterVec("linkchecker_storage_write_errors_total",
+		"Failed writes to the data directory.")
+
+	HTTPRequests = Default.NewCounterVec("linkchecker_http_requests_total",
+		"HTTP requests served, by route pattern, method and status code.", "handler", "method", "code")
+	HTTPDuration = Default.NewHistogramVec("linkchecker_http_request_duration_seconds",
+		"Time taken to serve an HTTP request, by route pattern.", nil, "handler")
+)
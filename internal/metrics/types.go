@@ -0,0 +1,220 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets suit durations in seconds, from a fast HTTP handler to a
+// slow link.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// CounterVec is a family of counters partitioned by labels.
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec registers a counter. Without labels it has a single series.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{name: name, help: help, kind: "counter", labels: labels},
+		values: make(map[string]float64),
+	}
+	if len(labels) == 0 {
+		// A counter without labels is reported from the start, at zero.
+		c.values[""] = 0
+	}
+	r.register(name, c)
+	return c
+}
+
+// Inc adds one to the series with the given label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta, which must not be negative, to a series.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	key := c.key(values)
+	c.mu.Lock()
+	c.values[key] += delta
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) key(values []string) string {
+	if len(values) != len(c.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", c.name, len(c.labels), len(values)))
+	}
+	return strings.Join(values, labelSeparator)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	values := make(map[string]float64, len(c.values))
+	for key, value := range c.values {
+		values[key] = value
+	}
+	c.mu.Unlock()
+
+	c.writeHeader(w)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s %s\n", c.series(c.name, splitKey(key, len(c.labels))), formatValue(values[key]))
+	}
+}
+
+// Gauge is a single value that goes up and down, such as in-flight work.
+type Gauge struct {
+	desc
+	bits atomic.Uint64
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{desc: desc{name: name, help: help, kind: "gauge"}}
+	r.register(name, g)
+	return g
+}
+
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		if g.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+func (g *Gauge) Inc() { g.Add(1) }
+func (g *Gauge) Dec() { g.Add(-1) }
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.Value()))
+}
+
+// HistogramVec is a family of histograms partitioned by labels.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec registers a histogram with the given upper bounds, which
+// are sorted; nil means DefaultBuckets.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogram),
+	}
+	r.register(name, h)
+	return h
+}
+
+// Observe records v in the series with the given label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	if len(values) != len(h.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", h.name, len(h.labels), len(values)))
+	}
+	key := strings.Join(values, labelSeparator)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	series := make(map[string]histogram, len(h.series))
+	for key, s := range h.series {
+		series[key] = histogram{counts: append([]uint64(nil), s.counts...), count: s.count, sum: s.sum}
+	}
+	h.mu.Unlock()
+
+	h.writeHeader(w)
+	for _, key := range sortedKeys(series) {
+		s := series[key]
+		values := splitKey(key, len(h.labels))
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s %d\n", h.desc.series(h.name+"_bucket", values, "le", formatValue(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s %d\n", h.desc.series(h.name+"_bucket", values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s %s\n", h.desc.series(h.name+"_sum", values), formatValue(s.sum))
+		fmt.Fprintf(w, "%s %d\n", h.desc.series(h.name+"_count", values), s.count)
+	}
+}
+
+// FuncVec reads its values from collect on every scrape. It suits state
+// that is already kept elsewhere, like the queue length, and counters
+// maintained by other packages.
+type FuncVec struct {
+	desc
+	collect func() map[string]float64
+}
+
+// NewGaugeFunc registers a gauge whose series are keyed by the value of a
+// single label. Without a label, collect returns one entry with key "".
+func (r *Registry) NewGaugeFunc(name, help, label string, collect func() map[string]float64) *FuncVec {
+	return r.newFuncVec("gauge", name, help, label, collect)
+}
+
+// NewCounterFunc is NewGaugeFunc for values that only ever grow.
+func (r *Registry) NewCounterFunc(name, help, label string, collect func() map[string]float64) *FuncVec {
+	return r.newFuncVec("counter", name, help, label, collect)
+}
+
+func (r *Registry) newFuncVec(kind, name, help, label string, collect func() map[string]float64) *FuncVec {
+	f := &FuncVec{desc: desc{name: name, help: help, kind: kind}, collect: collect}
+	if label != "" {
+		f.labels = []string{label}
+	}
+	r.register(name, f)
+	return f
+}
+
+func (f *FuncVec) write(w *bufio.Writer) {
+	values := f.collect()
+	f.writeHeader(w)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s %s\n", f.series(f.name, splitKey(key, len(f.labels))), formatValue(values[key]))
+	}
+}
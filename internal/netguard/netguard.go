@@ -0,0 +1,102 @@
+// Package netguard keeps outgoing requests away from addresses they must not
+// reach, such as the network the server itself runs in.
+package netguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrBlocked = errors.New("address is not allowed")
+
+// sharedAddressSpace is the carrier-grade NAT range, which netip does not
+// count as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Policy decides which addresses a connection may be made to. Allow wins
+// over Deny and BlockPrivate, so denying 0.0.0.0/0 and ::/0 and allowing a
+// few networks permits only those.
+type Policy struct {
+	// BlockPrivate refuses loopback, private, link-local, shared,
+	// unspecified and multicast addresses.
+	BlockPrivate bool
+	// Allow lists networks that may always be reached.
+	Allow []netip.Prefix
+	// Deny lists networks that may not be reached.
+	Deny []netip.Prefix
+}
+
+// Check returns an error wrapping ErrBlocked if addr may not be reached.
+func (p Policy) Check(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if contains(p.Allow, addr) {
+		return nil
+	}
+	if contains(p.Deny, addr) {
+		return fmt.Errorf("%w: %s is in a denied network", ErrBlocked, addr)
+	}
+	if p.BlockPrivate && isPrivate(addr) {
+		return fmt.Errorf("%w: %s is a private address", ErrBlocked, addr)
+	}
+	return nil
+}
+
+// Control is a net.Dialer Control function. It runs after the host name is
+// resolved, on the address actually dialed, so a name cannot be pointed at
+// a blocked address.
+func (p Policy) Control(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: cannot parse %s", ErrBlocked, address)
+	}
+	return p.Check(addrPort.Addr())
+}
+
+// Dialer returns a dialer enforcing the policy.
+func (p Policy) Dialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{Timeout: timeout, Control: p.Control}
+}
+
+func isPrivate(addr netip.Addr) bool {
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified() || sharedAddressSpace.Contains(addr)
+}
+
+// ParsePrefixes parses networks in CIDR notation. A bare address stands for
+// itself.
+func ParsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q", value)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", value)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
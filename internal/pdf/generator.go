@@ -1,21 +1,37 @@
 package pdf
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"linkChecker/internal/metrics"
 	"linkChecker/internal/storage"
+	"linkChecker/internal/tracing"
 
 	"github.com/phpdave11/gofpdf"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = tracing.Tracer("pdf")
+
 type Generator struct{}
 
 func NewGenerator() *Generator {
 	return &Generator{}
 }
 
-func (g *Generator) GenerateReport(batches []*storage.LinkBatch) ([]byte, error) {
+func (g *Generator) GenerateReport(ctx context.Context, batches []*storage.LinkBatch) ([]byte, error) {
+	links := 0
+	for _, batch := range batches {
+		links += len(batch.URLs)
+	}
+	span := startReport(ctx, "report", attribute.Int("linkchecker.batches", len(batches)), attribute.Int("linkchecker.links", links))
+	defer span.End()
+
 	pdf := gofpdf.New("P", "mm", "A4", "")
 
 	pdf.AddPage()
@@ -45,13 +61,46 @@ func (g *Generator) GenerateReport(batches []*storage.LinkBatch) ([]byte, error)
 	return buf.Bytes(), nil
 }
 
+// reportSpan times the generation of one PDF for metrics and tracing.
+type reportSpan struct {
+	trace.Span
+	report  string
+	started time.Time
+}
+
+func startReport(ctx context.Context, report string, attrs ...attribute.KeyValue) reportSpan {
+	_, span := tracer.Start(ctx, "pdf."+report, trace.WithAttributes(attrs...))
+	return reportSpan{Span: span, report: report, started: time.Now()}
+}
+
+func (s reportSpan) End() {
+	metrics.PDFDuration.Observe(time.Since(s.started).Seconds(), s.report)
+	s.Span.End()
+}
+
 func (g *Generator) addBatchToReport(pdf *gofpdf.Fpdf, batch *storage.LinkBatch) {
 	pdf.SetFont("helvetica", "B", 14)
 	pdf.SetFillColor(200, 220, 255)
-	pdf.CellFormat(190, 8, fmt.Sprintf("Batch #%d", batch.BatchID), "1", 1, "L", true, 0, "")
+	pdf.CellFormat(190, 8, fmt.Sprintf("Batch %s", batch.PublicID), "1", 1, "L", true, 0, "")
 	pdf.Ln(2)
 
 	pdf.SetFont("helvetica", "", 9)
+	if batch.Name != "" {
+		pdf.Cell(200, 5, fmt.Sprintf("Name: %s", batch.Name))
+		pdf.Ln(5)
+	}
+	if batch.Owner != "" {
+		pdf.Cell(200, 5, fmt.Sprintf("Owner: %s", batch.Owner))
+		pdf.Ln(5)
+	}
+	if len(batch.Tags) > 0 {
+		pdf.Cell(200, 5, fmt.Sprintf("Tags: %s", strings.Join(batch.Tags, ", ")))
+		pdf.Ln(5)
+	}
+	if len(batch.Labels) > 0 {
+		pdf.Cell(200, 5, fmt.Sprintf("Labels: %s", formatLabels(batch.Labels)))
+		pdf.Ln(5)
+	}
 	pdf.Cell(200, 5, fmt.Sprintf("Created: %s", batch.CreatedAt))
 	pdf.Ln(5)
 	pdf.Cell(200, 5, fmt.Sprintf("Status: %s", batch.Status))
@@ -104,6 +153,146 @@ func (g *Generator) addBatchToReport(pdf *gofpdf.Fpdf, batch *storage.LinkBatch)
 	}
 }
 
+// GenerateDiffReport renders the comparison of two batches.
+func (g *Generator) GenerateDiffReport(ctx context.Context, diff *storage.BatchDiff) ([]byte, error) {
+	span := startReport(ctx, "diff")
+	defer span.End()
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+
+	pdf.AddPage()
+
+	pdf.SetFont("helvetica", "B", 20)
+	pdf.Cell(200, 15, "Link Comparison Report")
+	pdf.Ln(10)
+
+	pdf.SetFont("helvetica", "", 10)
+	pdf.Cell(200, 5, fmt.Sprintf("Generated: %s", getCurrentTime()))
+	pdf.Ln(10)
+
+	g.addDiffSides(pdf, diff)
+	g.addDiffSummary(pdf, diff)
+
+	if !diff.HasChanges() {
+		pdf.SetFont("helvetica", "", 12)
+		pdf.Cell(200, 10, "No changes found")
+	}
+
+	g.addDiffSection(pdf, "Newly broken", diff.NewlyBroken, false)
+	g.addDiffSection(pdf, "Recovered", diff.Recovered, false)
+	g.addDiffSection(pdf, "Status changed", diff.StatusChanged, false)
+	g.addDiffSection(pdf, "Latency regressions", diff.LatencyRegressions, true)
+	g.addDiffSection(pdf, "Added URLs", diff.Added, false)
+	g.addDiffSection(pdf, "Removed URLs", diff.Removed, false)
+
+	var buf Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to generate PDF: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (g *Generator) addDiffSides(pdf *gofpdf.Fpdf, diff *storage.BatchDiff) {
+	colW := []float64{40, 75, 75}
+
+	pdf.SetFont("helvetica", "B", 9)
+	pdf.SetFillColor(200, 220, 255)
+	pdf.CellFormat(colW[0], 7, "", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(colW[1], 7, fmt.Sprintf("From: batch %s", diff.From.PublicID), "1", 0, "L", true, 0, "")
+	pdf.CellFormat(colW[2], 7, fmt.Sprintf("To: batch %s", diff.To.PublicID), "1", 1, "L", true, 0, "")
+
+	rows := []struct {
+		label    string
+		from, to string
+	}{
+		{"Name", diff.From.Name, diff.To.Name},
+		{"Created", diff.From.CreatedAt, diff.To.CreatedAt},
+		{"Status", diff.From.Status, diff.To.Status},
+		{"Links", fmt.Sprintf("%d", diff.From.Total), fmt.Sprintf("%d", diff.To.Total)},
+		{"Unavailable", fmt.Sprintf("%d", diff.From.Unavailable), fmt.Sprintf("%d", diff.To.Unavailable)},
+	}
+
+	pdf.SetFont("helvetica", "", 8)
+	for _, row := range rows {
+		pdf.CellFormat(colW[0], 6, row.label, "1", 0, "L", false, 0, "")
+		pdf.CellFormat(colW[1], 6, row.from, "1", 0, "L", false, 0, "")
+		pdf.CellFormat(colW[2], 6, row.to, "1", 1, "L", false, 0, "")
+	}
+	pdf.Ln(5)
+}
+
+func (g *Generator) addDiffSummary(pdf *gofpdf.Fpdf, diff *storage.BatchDiff) {
+	pdf.SetFont("helvetica", "", 9)
+	pdf.Cell(200, 5, fmt.Sprintf("Newly broken: %d   Recovered: %d   Status changed: %d   Slower: %d",
+		len(diff.NewlyBroken), len(diff.Recovered), len(diff.StatusChanged), len(diff.LatencyRegressions)))
+	pdf.Ln(5)
+	pdf.Cell(200, 5, fmt.Sprintf("Added: %d   Removed: %d   Unchanged: %d   Not checked: %d",
+		len(diff.Added), len(diff.Removed), diff.Unchanged, diff.Unchecked))
+	pdf.Ln(8)
+}
+
+func (g *Generator) addDiffSection(pdf *gofpdf.Fpdf, title string, changes []storage.LinkChange, latency bool) {
+	if len(changes) == 0 {
+		return
+	}
+
+	if pdf.GetY() > 250 {
+		pdf.AddPage()
+	}
+
+	pdf.SetFont("helvetica", "B", 12)
+	pdf.SetFillColor(200, 220, 255)
+	pdf.CellFormat(190, 8, fmt.Sprintf("%s (%d)", title, len(changes)), "1", 1, "L", true, 0, "")
+	pdf.Ln(2)
+
+	colW := []float64{100, 45, 45}
+	pdf.SetFont("helvetica", "B", 9)
+	pdf.SetFillColor(220, 220, 220)
+	pdf.CellFormat(colW[0], 7, "URL", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(colW[1], 7, "Before", "1", 0, "C", true, 0, "")
+	pdf.CellFormat(colW[2], 7, "After", "1", 1, "C", true, 0, "")
+
+	pdf.SetFont("helvetica", "", 8)
+	for i, change := range changes {
+		fill := i%2 == 0
+		if fill {
+			pdf.SetFillColor(245, 245, 245)
+		} else {
+			pdf.SetFillColor(255, 255, 255)
+		}
+
+		url := change.URL
+		if len(url) > 60 {
+			url = url[:57] + "..."
+		}
+
+		pdf.CellFormat(colW[0], 6, url, "1", 0, "L", fill, 0, "")
+		pdf.CellFormat(colW[1], 6, formatDiffResult(change.From, latency), "1", 0, "C", fill, 0, "")
+		pdf.CellFormat(colW[2], 6, formatDiffResult(change.To, latency), "1", 1, "C", fill, 0, "")
+
+		if pdf.GetY() > 270 {
+			pdf.AddPage()
+		}
+	}
+
+	pdf.Ln(3)
+}
+
+// formatDiffResult describes one side of a change in a table cell.
+func formatDiffResult(result *storage.LinkResult, latency bool) string {
+	if result == nil {
+		return "-"
+	}
+	if latency {
+		return fmt.Sprintf("%d ms", result.ResponseTimeMs)
+	}
+	if result.Status == 0 {
+		return "error"
+	}
+	return fmt.Sprintf("%d", result.Status)
+}
+
 type Buffer struct {
 	data []byte
 }
@@ -117,6 +306,20 @@ func (b *Buffer) Bytes() []byte {
 	return b.data
 }
 
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, labels[key]))
+	}
+	return strings.Join(pairs, ", ")
+}
+
 func getCurrentTime() string {
 	return time.Now().Format("2006-01-02 15:04:05")
 }
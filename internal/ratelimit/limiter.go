@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have refilled completely are
+// dropped, so one-off clients do not accumulate in memory.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter is a set of token buckets, one per key (a client IP, an API key).
+// Each bucket holds up to burst tokens and refills at rate tokens per
+// second; every allowed request takes one token.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// New creates a limiter. A rate of zero or less disables it.
+func New(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Enabled reports whether the limiter rejects anything at all.
+func (l *Limiter) Enabled() bool {
+	return l != nil && l.rate > 0
+}
+
+// Allow takes a token from the bucket of key. When the bucket is empty it
+// returns false and how long until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if !l.Enabled() {
+		return true, 0
+	}
+	return l.allowAt(key, time.Now())
+}
+
+func (l *Limiter) allowAt(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// sweep removes buckets that are full again; a new bucket starts full, so
+// this forgets nothing.
+func (l *Limiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
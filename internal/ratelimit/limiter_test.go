@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	// step is one call to Allow, at after past start.
+	type step struct {
+		after    time.Duration
+		want     bool
+		wantWait time.Duration
+	}
+
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		steps []step
+	}{
+		{
+			name:  "burst then empty",
+			rate:  1,
+			burst: 3,
+			steps: []step{{0, true, 0}, {0, true, 0}, {0, true, 0}, {0, false, time.Second}},
+		},
+		{
+			name:  "refills at rate",
+			rate:  2,
+			burst: 1,
+			steps: []step{{0, true, 0}, {250 * time.Millisecond, false, 250 * time.Millisecond}, {500 * time.Millisecond, true, 0}},
+		},
+		{
+			name:  "refill is capped at burst",
+			rate:  10,
+			burst: 2,
+			steps: []step{{0, true, 0}, {0, true, 0}, {time.Hour, true, 0}, {time.Hour, true, 0}, {time.Hour, false, 100 * time.Millisecond}},
+		},
+		{
+			name:  "burst below one allows one",
+			rate:  1,
+			burst: 0,
+			steps: []step{{0, true, 0}, {0, false, time.Second}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(tt.rate, tt.burst)
+			for i, s := range tt.steps {
+				ok, wait := l.allowAt("client", start.Add(s.after))
+				if ok != s.want || wait != s.wantWait {
+					t.Errorf("call %d: Allow = %v, %v, want %v, %v", i, ok, wait, s.want, s.wantWait)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterKeysAreIndependent(t *testing.T) {
+	l := New(1, 1)
+	now := time.Now()
+	if ok, _ := l.allowAt("a", now); !ok {
+		t.Fatal("first request of a was refused")
+	}
+	if ok, _ := l.allowAt("a", now); ok {
+		t.Error("second request of a was allowed")
+	}
+	if ok, _ := l.allowAt("b", now); !ok {
+		t.Error("b was limited by the bucket of a")
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	var unset *Limiter
+	for _, l := range []*Limiter{unset, New(0, 1), New(-1, 5)} {
+		if l.Enabled() {
+			t.Errorf("limiter %+v is enabled", l)
+		}
+		for range 10 {
+			if ok, wait := l.Allow("client"); !ok || wait != 0 {
+				t.Fatalf("disabled limiter refused a request: %v, %v", ok, wait)
+			}
+		}
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l := New(1, 2)
+	start := time.Now()
+	l.allowAt("idle", start)
+
+	// A sweep interval later the bucket of idle is full again, so it is
+	// dropped when the next request comes in.
+	l.allowAt("busy", start.Add(sweepInterval))
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("full bucket was not swept")
+	}
+	if len(l.buckets) != 1 {
+		t.Errorf("%d buckets left, want 1", len(l.buckets))
+	}
+}
@@ -0,0 +1,195 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// Schedule computes the next run time after a given moment.
+type Schedule interface {
+	Next(after time.Time) time.Time
+}
+
+// cronSchedule is a standard five-field cron expression:
+// minute hour day-of-month month day-of-week.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+// intervalSchedule fires at a fixed interval.
+type intervalSchedule struct {
+	every time.Duration
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// maxSearch bounds how far ahead Next looks for a matching minute, so
+// impossible expressions such as "0 0 31 2 *" terminate.
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// ParseCron parses a five-field cron expression or one of the @macros.
+func ParseCron(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: expected 5 fields, got %d", ErrInvalidSchedule, len(fields))
+	}
+
+	var s cronSchedule
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("%w: minute: %v", ErrInvalidSchedule, err)
+	}
+	if s.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("%w: hour: %v", ErrInvalidSchedule, err)
+	}
+	if s.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("%w: day of month: %v", ErrInvalidSchedule, err)
+	}
+	if s.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("%w: month: %v", ErrInvalidSchedule, err)
+	}
+	if s.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("%w: day of week: %v", ErrInvalidSchedule, err)
+	}
+
+	// Sunday may be written as 0 or 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	// A day field only restricts the day if it leaves some out, so "*/1"
+	// and "1-31" behave like "*" when combined with the other day field.
+	s.domAny = s.dom == bitRange(1, 31)
+	s.dowAny = s.dow&bitRange(0, 6) == bitRange(0, 6)
+
+	return &s, nil
+}
+
+// ParseInterval parses a Go duration of at least one minute.
+func ParseInterval(value string) (Schedule, error) {
+	every, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	if every < time.Minute {
+		return nil, fmt.Errorf("%w: interval must be at least 1m, got %v", ErrInvalidSchedule, every)
+	}
+	return intervalSchedule{every: every}, nil
+}
+
+func (s intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(s.every)
+}
+
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// dayMatches follows cron semantics: when both day fields are restricted,
+// a day matching either of them is enough.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domAny || s.dowAny {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// bitRange returns the bit set of the values from lo to hi.
+func bitRange(lo, hi uint) uint64 {
+	return (1<<(hi+1) - 1) &^ (1<<lo - 1)
+}
+
+// parseField turns a cron field such as "*/15", "1-5" or "0,30" into a
+// bit set of allowed values.
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			loStr, hiStr, _ := strings.Cut(rangePart, "-")
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(loStr)
+			hi, err2 = strconv.Atoi(hiStr)
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", rangePart)
+			}
+			lo = n
+			if !hasStep {
+				hi = n
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// A Thursday.
+	after := time.Date(2026, time.January, 1, 10, 7, 30, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, time.January, 1, 10, 15, 0, 0, time.UTC)},
+		{"7 10 * * *", time.Date(2026, time.January, 2, 10, 7, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2026, time.January, 2, 9, 0, 0, 0, time.UTC)},
+		{"0,30 12 * * *", time.Date(2026, time.January, 1, 12, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, time.January, 2, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * *", time.Date(2026, time.January, 13, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: the 13th or a Friday, whichever is first.
+		{"0 0 13 * 5", time.Date(2026, time.January, 2, 0, 0, 0, 0, time.UTC)},
+		// A day of month covering every day leaves only the weekday.
+		{"0 0 */1 * 1", time.Date(2026, time.January, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1-31 * 1", time.Date(2026, time.January, 5, 0, 0, 0, 0, time.UTC)},
+		// Sunday as 7.
+		{"0 0 * * 7", time.Date(2026, time.January, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron: %v", err)
+			}
+			if got := s.Next(after); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNextSkipsCurrentMinute(t *testing.T) {
+	s, err := ParseCron("*/15 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Date(2026, time.January, 1, 10, 15, 0, 0, time.UTC)
+	want := time.Date(2026, time.January, 1, 10, 30, 0, 0, time.UTC)
+	if got := s.Next(after); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v", after, got, want)
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"@often",
+	} {
+		if _, err := ParseCron(expr); !errors.Is(err, ErrInvalidSchedule) {
+			t.Errorf("ParseCron(%q) error = %v, want ErrInvalidSchedule", expr, err)
+		}
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	after := time.Date(2026, time.January, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "1m", want: after.Add(time.Minute)},
+		{value: "6h", want: after.Add(6 * time.Hour)},
+		{value: "30s", wantErr: true},
+		{value: "daily", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseInterval(tt.value)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidSchedule) {
+				t.Errorf("ParseInterval(%q) error = %v, want ErrInvalidSchedule", tt.value, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseInterval(%q): %v", tt.value, err)
+			continue
+		}
+		if got := s.Next(after); !got.Equal(tt.want) {
+			t.Errorf("ParseInterval(%q).Next = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
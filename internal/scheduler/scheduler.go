@@ -0,0 +1,318 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"linkChecker/internal/jobs"
+	"linkChecker/internal/storage"
+)
+
+// MonitorLabel is set on every batch created by a monitor, with the
+// monitor ID as its value.
+const MonitorLabel = "monitor_id"
+
+// maxSleep bounds how long the scheduler sleeps between checks, so clock
+// jumps are noticed in reasonable time.
+const maxSleep = time.Minute
+
+// errSkipRun signals that a monitor changed between listing and firing it.
+var errSkipRun = errors.New("monitor changed since it was listed")
+
+// Scheduler runs monitors: it creates a normal batch for each monitor
+// whenever its schedule is due.
+type Scheduler struct {
+	storage *storage.Storage
+	jobs    *jobs.Manager
+	wake    chan struct{}
+}
+
+func New(store *storage.Storage, jobManager *jobs.Manager) *Scheduler {
+	return &Scheduler{
+		storage: store,
+		jobs:    jobManager,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// ParseMonitorSchedule returns the schedule of a monitor defined by either
+// a cron expression or an interval.
+func ParseMonitorSchedule(cron, interval string) (Schedule, error) {
+	switch {
+	case cron != "" && interval != "":
+		return nil, fmt.Errorf("%w: set either cron or interval, not both", ErrInvalidSchedule)
+	case cron != "":
+		return ParseCron(cron)
+	case interval != "":
+		return ParseInterval(interval)
+	default:
+		return nil, fmt.Errorf("%w: cron or interval is required", ErrInvalidSchedule)
+	}
+}
+
+// Start runs the scheduler loop until ctx is cancelled. Runs missed while
+// the server was down are collapsed into a single run at startup.
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		for {
+			next := s.runDue(time.Now())
+
+			wait := maxSleep
+			if !next.IsZero() && time.Until(next) < wait {
+				wait = time.Until(next)
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			case <-s.wake:
+				timer.Stop()
+			}
+		}
+	}()
+}
+
+// Create validates and stores a new monitor and schedules its first run.
+func (s *Scheduler) Create(monitor *storage.Monitor) (*storage.Monitor, error) {
+	schedule, err := validSchedule(monitor)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	monitor.CreatedAt = now.Format(time.RFC3339)
+	monitor.UpdatedAt = monitor.CreatedAt
+	monitor.NextRunAt = nextRunAt(schedule, monitor.Paused, now)
+	monitor.LastRunAt = ""
+	monitor.LastBatchID = 0
+
+	created, err := s.storage.CreateMonitor(monitor)
+	if err != nil {
+		return nil, err
+	}
+
+	s.reschedule()
+	return created, nil
+}
+
+// Update replaces the definition of a monitor and schedules its next run
+// from now. The run history is kept.
+func (s *Scheduler) Update(id int64, definition *storage.Monitor) (*storage.Monitor, error) {
+	schedule, err := validSchedule(definition)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	updated, err := s.storage.UpdateMonitor(id, func(m *storage.Monitor) error {
+		m.URLs = definition.URLs
+		m.Cron = definition.Cron
+		m.Interval = definition.Interval
+		m.Paused = definition.Paused
+		m.Priority = definition.Priority
+		m.BatchMetadata = definition.BatchMetadata
+		m.Notify = definition.Notify
+		m.UpdatedAt = now.Format(time.RFC3339)
+		m.NextRunAt = nextRunAt(schedule, m.Paused, now)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.reschedule()
+	return updated, nil
+}
+
+func (s *Scheduler) Pause(id int64) (*storage.Monitor, error) {
+	return s.storage.UpdateMonitor(id, func(m *storage.Monitor) error {
+		m.Paused = true
+		m.NextRunAt = ""
+		m.UpdatedAt = time.Now().Format(time.RFC3339)
+		return nil
+	})
+}
+
+// Resume schedules the next run of a paused monitor from now; runs missed
+// while it was paused are not made up.
+func (s *Scheduler) Resume(id int64) (*storage.Monitor, error) {
+	now := time.Now()
+	updated, err := s.storage.UpdateMonitor(id, func(m *storage.Monitor) error {
+		schedule, err := ParseMonitorSchedule(m.Cron, m.Interval)
+		if err != nil {
+			return err
+		}
+		m.Paused = false
+		m.NextRunAt = nextRunAt(schedule, false, now)
+		m.UpdatedAt = now.Format(time.RFC3339)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.reschedule()
+	return updated, nil
+}
+
+func (s *Scheduler) Delete(id int64) error {
+	if err := s.storage.DeleteMonitor(id); err != nil {
+		return err
+	}
+
+	s.reschedule()
+	return nil
+}
+
+// RunNow starts a run of the monitor immediately, even if it is paused.
+// The regular schedule is not affected. The batch is traced as a child of
+// the span in ctx.
+func (s *Scheduler) RunNow(ctx context.Context, id int64) (int64, error) {
+	monitor, err := s.storage.UpdateMonitor(id, func(m *storage.Monitor) error {
+		m.LastRunAt = time.Now().Format(time.RFC3339)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return s.run(ctx, monitor)
+}
+
+// runDue fires every monitor whose next run has come and returns the time
+// of the earliest upcoming run.
+func (s *Scheduler) runDue(now time.Time) time.Time {
+	var earliest time.Time
+
+	for _, monitor := range s.storage.ListMonitors() {
+		if monitor.Paused {
+			continue
+		}
+
+		schedule, err := ParseMonitorSchedule(monitor.Cron, monitor.Interval)
+		if err != nil {
+			slog.Warn("Monitor has an invalid schedule", "monitor", monitor.ID, "error", err)
+			continue
+		}
+
+		next, err := time.Parse(time.RFC3339, monitor.NextRunAt)
+		if err != nil || next.After(now) {
+			if err != nil {
+				next, err = s.setNextRun(monitor, schedule, now)
+				if err != nil {
+					continue
+				}
+			}
+			if !next.IsZero() && (earliest.IsZero() || next.Before(earliest)) {
+				earliest = next
+			}
+			continue
+		}
+
+		// The following run is persisted before this one starts, so a
+		// restart in between cannot fire it a second time.
+		following := schedule.Next(now)
+		due := monitor.NextRunAt
+		fired, err := s.storage.UpdateMonitor(monitor.ID, func(m *storage.Monitor) error {
+			if m.Paused || m.NextRunAt != due {
+				return errSkipRun
+			}
+			m.NextRunAt = formatRunAt(following)
+			m.LastRunAt = now.Format(time.RFC3339)
+			return nil
+		})
+		if err != nil {
+			if !errors.Is(err, errSkipRun) {
+				slog.Error("Failed to schedule monitor", "monitor", monitor.ID, "error", err)
+			}
+			continue
+		}
+
+		if _, err := s.run(context.Background(), fired); err != nil {
+			slog.Error("Monitor run failed", "monitor", monitor.ID, "error", err)
+		}
+
+		if !following.IsZero() && (earliest.IsZero() || following.Before(earliest)) {
+			earliest = following
+		}
+	}
+
+	return earliest
+}
+
+// run creates a batch for the monitor and queues it.
+func (s *Scheduler) run(ctx context.Context, monitor *storage.Monitor) (int64, error) {
+	meta := monitor.BatchMetadata
+	meta.Labels = make(map[string]string, len(monitor.Labels)+1)
+	for key, value := range monitor.Labels {
+		meta.Labels[key] = value
+	}
+	meta.Labels[MonitorLabel] = fmt.Sprint(monitor.ID)
+
+	batchID, err := s.jobs.Submit(ctx, monitor.URLs, meta, monitor.Notify, monitor.Priority, nil, nil)
+	if err != nil {
+		return batchID, err
+	}
+	if batch, err := s.storage.GetBatch(batchID); err == nil {
+		slog.Info("Monitor queued batch", "monitor", monitor.ID, "batch_id", batch.PublicID)
+	}
+
+	s.storage.UpdateMonitor(monitor.ID, func(m *storage.Monitor) error {
+		m.LastBatchID = batchID
+		return nil
+	})
+
+	return batchID, nil
+}
+
+// setNextRun schedules a monitor that has no valid next run yet.
+func (s *Scheduler) setNextRun(monitor *storage.Monitor, schedule Schedule, now time.Time) (time.Time, error) {
+	next := schedule.Next(now)
+	due := monitor.NextRunAt
+	_, err := s.storage.UpdateMonitor(monitor.ID, func(m *storage.Monitor) error {
+		if m.Paused || m.NextRunAt != due {
+			return errSkipRun
+		}
+		m.NextRunAt = formatRunAt(next)
+		return nil
+	})
+	return next, err
+}
+
+func (s *Scheduler) reschedule() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func validSchedule(monitor *storage.Monitor) (Schedule, error) {
+	schedule, err := ParseMonitorSchedule(monitor.Cron, monitor.Interval)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("%w: schedule never fires", ErrInvalidSchedule)
+	}
+	return schedule, nil
+}
+
+func nextRunAt(schedule Schedule, paused bool, now time.Time) string {
+	if paused {
+		return ""
+	}
+	return formatRunAt(schedule.Next(now))
+}
+
+func formatRunAt(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
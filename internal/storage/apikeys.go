@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const apiKeysDir = "apikeys"
+
+// apiKeyPrefix starts every secret so keys are easy to spot in configs and
+// logs.
+const apiKeyPrefix = "lc_"
+
+// Roles of API keys. Each role includes the permissions of the ones before
+// it: a submitter can also read and an admin manages its own tenant. A
+// superadmin manages the whole instance; only the create-key command can
+// make one.
+const (
+	RoleReader     = "reader"
+	RoleSubmitter  = "submitter"
+	RoleAdmin      = "admin"
+	RoleSuperadmin = "superadmin"
+)
+
+var roleRanks = map[string]int{
+	RoleReader:     1,
+	RoleSubmitter:  2,
+	RoleAdmin:      3,
+	RoleSuperadmin: 4,
+}
+
+var (
+	ErrInvalidRole   = errors.New("role must be reader, submitter, admin or superadmin")
+	ErrUnknownAPIKey = errors.New("unknown or revoked API key")
+)
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAllows reports whether a key with role may use an endpoint that
+// requires the required role.
+func RoleAllows(role, required string) bool {
+	return roleRanks[role] > 0 && roleRanks[role] >= roleRanks[required]
+}
+
+// APIKey is a credential for the HTTP API. Only a SHA-256 hash of the
+// secret is stored; the secret itself is shown once when the key is created.
+type APIKey struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Tenant string `json:"tenant"`
+	// Hint is the start of the secret, enough to tell keys apart.
+	Hint      string `json:"hint"`
+	Hash      string `json:"hash"`
+	CreatedAt string `json:"created_at"`
+	RevokedAt string `json:"revoked_at,omitempty"`
+}
+
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != ""
+}
+
+func (k *APIKey) snapshot() *APIKey {
+	c := *k
+	return &c
+}
+
+// CreateAPIKey generates a new key of tenant and returns it together with
+// its secret. An empty tenant means DefaultTenant.
+func (s *Storage) CreateAPIKey(name, role, tenant string) (*APIKey, string, error) {
+	if !ValidRole(role) {
+		return nil, "", ErrInvalidRole
+	}
+	tenant = tenantOrDefault(tenant)
+	if !ValidTenant(tenant) {
+		return nil, "", ErrInvalidTenant
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+	secret := apiKeyPrefix + hex.EncodeToString(raw)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := &APIKey{
+		ID:        s.nextAPIKeyID,
+		Name:      name,
+		Role:      role,
+		Tenant:    tenant,
+		Hint:      secret[:len(apiKeyPrefix)+8],
+		Hash:      hashAPIKey(secret),
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+
+	if err := s.persistAPIKey(key); err != nil {
+		return nil, "", err
+	}
+	s.apiKeys[key.ID] = key
+	s.apiKeysByHash[key.Hash] = key
+	s.nextAPIKeyID++
+	s.persistNextAPIKeyID()
+
+	return key.snapshot(), secret, nil
+}
+
+// AuthenticateAPIKey returns the active key matching secret.
+func (s *Storage) AuthenticateAPIKey(secret string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, exists := s.apiKeysByHash[hashAPIKey(secret)]
+	if !exists || key.Revoked() {
+		return nil, ErrUnknownAPIKey
+	}
+
+	return key.snapshot(), nil
+}
+
+// ListAPIKeys returns the keys of tenant, revoked ones included, ordered by
+// ID. An empty tenant lists the keys of all tenants.
+func (s *Storage) ListAPIKeys(tenant string) []*APIKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*APIKey, 0, len(s.apiKeys))
+	for _, key := range s.apiKeys {
+		if tenant == "" || key.Tenant == tenant {
+			keys = append(keys, key.snapshot())
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+
+	return keys
+}
+
+// GetAPIKey returns a key of tenant, or of any tenant if tenant is empty.
+func (s *Storage) GetAPIKey(tenant string, id int64) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, exists := s.apiKeys[id]
+	if !exists || (tenant != "" && key.Tenant != tenant) {
+		return nil, fmt.Errorf("API key %d not found", id)
+	}
+	return key.snapshot(), nil
+}
+
+// HasAPIKeys reports whether any key that is not revoked exists.
+func (s *Storage) HasAPIKeys() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, key := range s.apiKeys {
+		if !key.Revoked() {
+			return true
+		}
+	}
+	return false
+}
+
+// RevokeAPIKey disables a key of tenant, or of any tenant if tenant is
+// empty. The record is kept so batches can still be traced back to the key
+// that created them.
+func (s *Storage) RevokeAPIKey(tenant string, id int64) (*APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.apiKeys[id]
+	if !exists || (tenant != "" && current.Tenant != tenant) {
+		return nil, fmt.Errorf("API key %d not found", id)
+	}
+	if current.Revoked() {
+		return current.snapshot(), nil
+	}
+
+	key := current.snapshot()
+	key.RevokedAt = time.Now().Format(time.RFC3339)
+	if err := s.persistAPIKey(key); err != nil {
+		return nil, err
+	}
+	s.apiKeys[id] = key
+	s.apiKeysByHash[key.Hash] = key
+
+	return key.snapshot(), nil
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Storage) loadAPIKeys() error {
+	dir := filepath.Join(s.dataDir, apiKeysDir)
+	if data, err := os.ReadFile(filepath.Join(dir, nextIDFile)); err == nil {
+		var nextID int64
+		if err := json.Unmarshal(data, &nextID); err == nil && nextID > s.nextAPIKeyID {
+			s.nextAPIKeyID = nextID
+		}
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" || file.Name() == nextIDFile {
+			continue
+		}
+
+		data, err := s.readFile(filepath.Join(dir, file.Name()))
+		if isKeyError(err) {
+			return fmt.Errorf("%s: %w", file.Name(), err)
+		}
+		if err != nil {
+			continue
+		}
+
+		var key APIKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			continue
+		}
+		key.Tenant = tenantOrDefault(key.Tenant)
+
+		s.apiKeys[key.ID] = &key
+		s.apiKeysByHash[key.Hash] = &key
+		if key.ID >= s.nextAPIKeyID {
+			s.nextAPIKeyID = key.ID + 1
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) apiKeyFilePath(id int64) string {
+	return filepath.Join(s.dataDir, apiKeysDir, fmt.Sprintf("key_%d.json", id))
+}
+
+func (s *Storage) persistAPIKey(key *APIKey) error {
+	if err := os.MkdirAll(filepath.Join(s.dataDir, apiKeysDir), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(key, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return s.writeFile(s.apiKeyFilePath(key.ID), data)
+}
+
+func (s *Storage) persistNextAPIKeyID() error {
+	data, err := json.Marshal(s.nextAPIKeyID)
+	if err != nil {
+		return err
+	}
+
+	return s.writePlain(filepath.Join(s.dataDir, apiKeysDir, nextIDFile), data)
+}
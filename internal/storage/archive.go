@@ -0,0 +1,299 @@
+package storage
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+const (
+	// ArchiveSchemaVersion is bumped whenever the archive layout changes.
+	// Version 2 lists public batch IDs in the manifest and leaves internal
+	// IDs out of the batch lines.
+	ArchiveSchemaVersion = 2
+
+	archiveManifestName = "manifest.json"
+	archiveBatchesName  = "batches.jsonl"
+
+	// Import reads at most this much of an archive once decompressed, so a
+	// small upload cannot inflate into more than the server can hold.
+	maxManifestBytes = 1 << 20
+	maxImportBytes   = 1 << 30
+)
+
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// ExportFilter selects batches for export. Empty filters select everything.
+type ExportFilter struct {
+	// Tenant limits the export to the batches of one tenant.
+	Tenant   string
+	BatchIDs []int64
+	From     time.Time
+	To       time.Time
+}
+
+type ArchiveManifest struct {
+	SchemaVersion      int               `json:"schema_version"`
+	BatchSchemaVersion int               `json:"batch_schema_version"`
+	CreatedAt          string            `json:"created_at"`
+	BatchCount         int               `json:"batch_count"`
+	BatchIDs           []string          `json:"batch_ids"`
+	Checksums          map[string]string `json:"checksums"`
+}
+
+// exportedBatch is a batch as written to an archive. The empty BatchID
+// hides the internal ID of the embedded batch, which would tell how many
+// batches the instance holds; Import assigns new ones anyway.
+type exportedBatch struct {
+	*LinkBatch
+	BatchID int64 `json:"batch_id,omitempty"`
+}
+
+// ImportResult maps the public ID of each batch in the archive to the one it
+// was stored under, which differs only if the ID was already taken.
+type ImportResult struct {
+	Imported int               `json:"imported"`
+	IDMap    map[string]string `json:"id_map"`
+}
+
+// Export writes the selected batches to w as a tar.gz archive containing
+// a manifest and the batches as JSON lines.
+func (s *Storage) Export(w io.Writer, filter ExportFilter) (*ArchiveManifest, error) {
+	s.mu.RLock()
+	batches := s.selectForExportLocked(filter)
+
+	var lines bytes.Buffer
+	ids := make([]string, 0, len(batches))
+	for _, batch := range batches {
+		data, err := json.Marshal(exportedBatch{LinkBatch: batch})
+		if err != nil {
+			s.mu.RUnlock()
+			return nil, fmt.Errorf("failed to encode batch %d: %w", batch.BatchID, err)
+		}
+		lines.Write(data)
+		lines.WriteByte('\n')
+		ids = append(ids, batch.PublicID)
+	}
+	s.mu.RUnlock()
+
+	sum := sha256.Sum256(lines.Bytes())
+	manifest := &ArchiveManifest{
+		SchemaVersion:      ArchiveSchemaVersion,
+		BatchSchemaVersion: CurrentSchemaVersion,
+		CreatedAt:          time.Now().Format(time.RFC3339),
+		BatchCount:         len(batches),
+		BatchIDs:           ids,
+		Checksums: map[string]string{
+			archiveBatchesName: hex.EncodeToString(sum[:]),
+		},
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	if err := writeTarFile(tw, archiveManifestName, manifestData); err != nil {
+		return nil, err
+	}
+	if err := writeTarFile(tw, archiveBatchesName, lines.Bytes()); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// Import reads an archive produced by Export and stores its batches under
+// freshly allocated IDs so they never collide with existing ones.
+func (s *Storage) Import(r io.Reader) (*ImportResult, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+
+	var manifestData, batchesData []byte
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+
+		var limit int64
+		var target *[]byte
+		switch header.Name {
+		case archiveManifestName:
+			limit, target = maxManifestBytes, &manifestData
+		case archiveBatchesName:
+			limit, target = maxImportBytes, &batchesData
+		default:
+			// Unknown entries are skipped without being read.
+			continue
+		}
+		if *target != nil {
+			return nil, fmt.Errorf("%w: duplicate %s", ErrInvalidArchive, header.Name)
+		}
+		if header.Size > limit {
+			return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrInvalidArchive, header.Name, limit)
+		}
+
+		data, err := io.ReadAll(io.LimitReader(tr, header.Size))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+
+		*target = data
+	}
+
+	if manifestData == nil || batchesData == nil {
+		return nil, fmt.Errorf("%w: missing %s or %s", ErrInvalidArchive, archiveManifestName, archiveBatchesName)
+	}
+
+	var manifest ArchiveManifest
+	if err := ignoreLegacyBatchIDs(json.Unmarshal(manifestData, &manifest)); err != nil {
+		return nil, fmt.Errorf("%w: bad manifest: %v", ErrInvalidArchive, err)
+	}
+	if manifest.SchemaVersion > ArchiveSchemaVersion {
+		return nil, fmt.Errorf("%w: unsupported schema version %d", ErrInvalidArchive, manifest.SchemaVersion)
+	}
+	if manifest.BatchSchemaVersion > CurrentSchemaVersion {
+		return nil, fmt.Errorf("%w: batches use %w %d", ErrInvalidArchive, ErrUnknownSchemaVersion, manifest.BatchSchemaVersion)
+	}
+
+	sum := sha256.Sum256(batchesData)
+	if manifest.Checksums[archiveBatchesName] != hex.EncodeToString(sum[:]) {
+		return nil, fmt.Errorf("%w: checksum mismatch for %s", ErrInvalidArchive, archiveBatchesName)
+	}
+
+	var batches []*LinkBatch
+	scanner := bufio.NewScanner(bytes.NewReader(batchesData))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(batchesData)+1)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		batch, _, err := decodeBatch(scanner.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad batch line: %w", ErrInvalidArchive, err)
+		}
+		batches = append(batches, batch)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if len(batches) != manifest.BatchCount {
+		return nil, fmt.Errorf("%w: manifest lists %d batches, archive has %d", ErrInvalidArchive, manifest.BatchCount, len(batches))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &ImportResult{IDMap: make(map[string]string, len(batches))}
+	for _, batch := range batches {
+		oldID := batch.PublicID
+		batch.BatchID = s.nextID
+		s.nextID++
+
+		// Imported batches have no worker attached, so they cannot stay in flight.
+		if batch.Status == "pending" || batch.Status == "processing" {
+			batch.Status = "interrupted"
+			batch.Error = "imported while in progress"
+		}
+
+		s.batches[batch.BatchID] = batch
+		s.indexBatchLocked(batch)
+		if err := s.persistBatch(batch); err != nil {
+			return result, fmt.Errorf("failed to persist batch %d: %w", batch.BatchID, err)
+		}
+
+		// Batches exported before public IDs existed have none to map.
+		if oldID != "" {
+			result.IDMap[oldID] = batch.PublicID
+		}
+		result.Imported++
+	}
+
+	if err := s.persistNextID(); err != nil {
+		return result, fmt.Errorf("failed to persist next id: %w", err)
+	}
+
+	return result, nil
+}
+
+func (s *Storage) selectForExportLocked(filter ExportFilter) []*LinkBatch {
+	wanted := make(map[int64]bool, len(filter.BatchIDs))
+	for _, id := range filter.BatchIDs {
+		wanted[id] = true
+	}
+
+	var selected []*LinkBatch
+	for _, batch := range s.batches {
+		if len(wanted) > 0 && !wanted[batch.BatchID] {
+			continue
+		}
+		if filter.Tenant != "" && batch.Tenant != filter.Tenant {
+			continue
+		}
+
+		if !filter.From.IsZero() || !filter.To.IsZero() {
+			created, err := time.Parse(time.RFC3339, batch.CreatedAt)
+			if err != nil {
+				continue
+			}
+			if !filter.From.IsZero() && created.Before(filter.From) {
+				continue
+			}
+			if !filter.To.IsZero() && created.After(filter.To) {
+				continue
+			}
+		}
+
+		selected = append(selected, batch)
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].BatchID < selected[j].BatchID
+	})
+
+	return selected
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s header: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	src := newTestStorage(t, Options{})
+	var publicIDs []string
+	for _, tenant := range []string{"acme", "acme", "globex"} {
+		id, err := src.SaveBatch([]string{"https://a.example"}, BatchMetadata{Tenant: tenant, Tags: []string{"nightly"}}, nil, 0, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := src.UpdateBatch(id, []LinkResult{{URL: "https://a.example", Status: 200, Available: true}}, "completed"); err != nil {
+			t.Fatal(err)
+		}
+		batch, _ := src.GetBatch(id)
+		publicIDs = append(publicIDs, batch.PublicID)
+	}
+
+	var archive bytes.Buffer
+	manifest, err := src.Export(&archive, ExportFilter{Tenant: "acme"})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if manifest.BatchCount != 2 || strings.Join(manifest.BatchIDs, ",") != strings.Join(publicIDs[:2], ",") {
+		t.Errorf("manifest lists %d batches %v, want the two acme batches %v", manifest.BatchCount, manifest.BatchIDs, publicIDs[:2])
+	}
+	lines := archiveEntry(t, archive.Bytes(), archiveBatchesName)
+	if strings.Contains(lines, `"batch_id"`) {
+		t.Errorf("exported batches carry internal IDs:\n%s", lines)
+	}
+
+	// The destination already has batches, so imported ones get new
+	// internal IDs but keep their public IDs.
+	dst := newTestStorage(t, Options{})
+	if _, err := dst.SaveBatch([]string{"https://b.example"}, BatchMetadata{}, nil, 0, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	result, err := dst.Import(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if result.Imported != 2 {
+		t.Errorf("imported %d batches, want 2", result.Imported)
+	}
+	for _, publicID := range publicIDs[:2] {
+		if result.IDMap[publicID] != publicID {
+			t.Errorf("ID map has %s -> %q, want the ID kept", publicID, result.IDMap[publicID])
+		}
+		batch, err := dst.GetTenantBatch("acme", publicID)
+		if err != nil {
+			t.Errorf("imported batch %s: %v", publicID, err)
+			continue
+		}
+		if batch.BatchID < 2 || len(batch.Results) != 1 || batch.Status != "completed" {
+			t.Errorf("imported batch = %+v, want a new internal ID and its result", batch)
+		}
+	}
+
+	// Importing again finds the public IDs taken and assigns new ones.
+	again, err := dst.Import(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatalf("second Import: %v", err)
+	}
+	for old, assigned := range again.IDMap {
+		if assigned == old {
+			t.Errorf("second import kept the taken ID %s", old)
+		}
+	}
+}
+
+func TestImportLegacyArchive(t *testing.T) {
+	lines := `{"batch_id": 7, "urls": ["https://a.example"], "results": [], "created_at": "2025-01-02T03:04:05Z", "status": "processing"}` + "\n"
+	sum := sha256.Sum256([]byte(lines))
+	manifest := `{"schema_version": 1, "batch_schema_version": 1, "batch_count": 1, "batch_ids": [7],
+		"checksums": {"batches.jsonl": "` + hex.EncodeToString(sum[:]) + `"}}`
+
+	s := newTestStorage(t, Options{})
+	result, err := s.Import(bytes.NewReader(tarGz(t, map[string]string{
+		archiveManifestName: manifest,
+		archiveBatchesName:  lines,
+	})))
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if result.Imported != 1 || len(result.IDMap) != 0 {
+		t.Errorf("result = %+v, want one batch and nothing to map", result)
+	}
+
+	batch, err := s.GetBatch(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Status != "interrupted" || len(batch.PublicID) != 26 || batch.Tenant != DefaultTenant {
+		t.Errorf("imported batch = %+v, want it interrupted with a public ID in the default tenant", batch)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	valid := map[string]string{
+		archiveManifestName: `{"schema_version": 2, "batch_count": 0, "checksums": {"batches.jsonl": "` + hex.EncodeToString(sha256.New().Sum(nil)) + `"}}`,
+		archiveBatchesName:  "",
+	}
+	with := func(name, content string) map[string]string {
+		files := map[string]string{archiveManifestName: valid[archiveManifestName], archiveBatchesName: valid[archiveBatchesName]}
+		files[name] = content
+		return files
+	}
+
+	tests := []struct {
+		name    string
+		archive []byte
+	}{
+		{"not gzip", []byte("plain")},
+		{"missing batches", tarGz(t, map[string]string{archiveManifestName: valid[archiveManifestName]})},
+		{"future archive", tarGz(t, with(archiveManifestName, `{"schema_version": 99}`))},
+		{"checksum mismatch", tarGz(t, with(archiveBatchesName, "{}\n"))},
+		{"count mismatch", tarGz(t, with(archiveManifestName, `{"schema_version": 2, "batch_count": 3, "checksums": {"batches.jsonl": "`+hex.EncodeToString(sha256.New().Sum(nil))+`"}}`))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t, Options{})
+			if _, err := s.Import(bytes.NewReader(tt.archive)); !errors.Is(err, ErrInvalidArchive) {
+				t.Errorf("error = %v, want ErrInvalidArchive", err)
+			}
+		})
+	}
+
+	s := newTestStorage(t, Options{})
+	if result, err := s.Import(bytes.NewReader(tarGz(t, valid))); err != nil || result.Imported != 0 {
+		t.Errorf("empty archive: %+v, %v, want nothing imported", result, err)
+	}
+}
+
+// tarGz builds an archive in the layout Export writes.
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range []string{archiveManifestName, archiveBatchesName} {
+		if content, ok := files[name]; ok {
+			if err := writeTarFile(tw, name, []byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// archiveEntry returns the content of one file of an exported archive.
+func archiveEntry(t *testing.T, archive []byte, name string) string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			t.Fatalf("%s not found in the archive: %v", name, err)
+		}
+		if header.Name == name {
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(data)
+		}
+	}
+}
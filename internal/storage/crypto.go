@@ -0,0 +1,365 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"linkChecker/internal/metrics"
+)
+
+const (
+	encryptionAlgorithm = "AES-256-GCM"
+	encryptionKeySize   = 32
+)
+
+var (
+	ErrEncryptionKeyMissing = errors.New("data is encrypted but no encryption key was supplied")
+	ErrWrongEncryptionKey   = errors.New("encryption key does not match the stored data")
+	ErrInvalidEncryptionKey = errors.New("invalid encryption key")
+	ErrNotEncrypted         = errors.New("data is not encrypted but an encryption key was supplied")
+)
+
+// isKeyError reports whether err means the configured key does not fit the
+// stored data, which must stop loading instead of skipping the file.
+func isKeyError(err error) bool {
+	return errors.Is(err, ErrEncryptionKeyMissing) || errors.Is(err, ErrWrongEncryptionKey) || errors.Is(err, ErrNotEncrypted)
+}
+
+// sealedDirs are the data subdirectories whose files are written with
+// writeFile. RotateKey re-seals all of them, so a directory missing here
+// becomes unreadable after a rotation.
+var sealedDirs = []string{deliveriesDir, monitorsDir, idempotencyDir, apiKeysDir, tenantsDir}
+
+// envelope is the on-disk form of an encrypted file. The payload is sealed
+// with a random per-file data key, which is in turn sealed with the master key.
+type envelope struct {
+	Algorithm  string `json:"algorithm"`
+	KeyID      string `json:"key_id"`
+	WrappedKey string `json:"wrapped_key"`
+	KeyNonce   string `json:"key_nonce"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// ParseKey accepts a 32-byte key as raw bytes, base64 or hex text.
+func ParseKey(raw []byte) ([]byte, error) {
+	if len(raw) == encryptionKeySize {
+		return raw, nil
+	}
+
+	text := string(bytes.TrimSpace(raw))
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == encryptionKeySize {
+		return key, nil
+	}
+	if key, err := hex.DecodeString(text); err == nil && len(key) == encryptionKeySize {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: expected %d bytes as raw, base64 or hex", ErrInvalidEncryptionKey, encryptionKeySize)
+}
+
+// ReadKeyFile loads a key from a file in any format accepted by ParseKey.
+func ReadKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	return ParseKey(data)
+}
+
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// seal encrypts plaintext with key. A nil key leaves the data untouched.
+func seal(key, plaintext []byte) ([]byte, error) {
+	if key == nil {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, encryptionKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	nonce, ciphertext, err := gcmSeal(dataKey, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	keyNonce, wrappedKey, err := gcmSeal(key, dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(envelope{
+		Algorithm:  encryptionAlgorithm,
+		KeyID:      keyID(key),
+		WrappedKey: base64.StdEncoding.EncodeToString(wrappedKey),
+		KeyNonce:   base64.StdEncoding.EncodeToString(keyNonce),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	}, "", "  ")
+}
+
+// unseal decrypts data written by seal. Without a key, plaintext files are
+// returned as is. With a key, every file must be sealed: a plaintext file in
+// an encrypted data directory has been replaced or tampered with. Existing
+// plaintext directories are encrypted with rotate-key, which runs without a
+// current key.
+func unseal(key, data []byte) ([]byte, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil || env.Algorithm == "" || env.Ciphertext == "" {
+		if key != nil {
+			return nil, ErrNotEncrypted
+		}
+		return data, nil
+	}
+
+	if env.Algorithm != encryptionAlgorithm {
+		return nil, fmt.Errorf("unsupported encryption algorithm %q", env.Algorithm)
+	}
+	if key == nil {
+		return nil, ErrEncryptionKeyMissing
+	}
+	if env.KeyID != keyID(key) {
+		return nil, fmt.Errorf("%w (file key id %s, configured key id %s)", ErrWrongEncryptionKey, env.KeyID, keyID(key))
+	}
+
+	wrappedKey, err1 := base64.StdEncoding.DecodeString(env.WrappedKey)
+	keyNonce, err2 := base64.StdEncoding.DecodeString(env.KeyNonce)
+	nonce, err3 := base64.StdEncoding.DecodeString(env.Nonce)
+	ciphertext, err4 := base64.StdEncoding.DecodeString(env.Ciphertext)
+	if err := errors.Join(err1, err2, err3, err4); err != nil {
+		return nil, fmt.Errorf("corrupt encrypted file: %w", err)
+	}
+
+	dataKey, err := gcmOpen(key, keyNonce, wrappedKey)
+	if err != nil {
+		return nil, ErrWrongEncryptionKey
+	}
+
+	plaintext, err := gcmOpen(dataKey, nonce, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt encrypted file: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+func gcmSeal(key, plaintext []byte) ([]byte, []byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+
+	return nonce, gcm.Seal(nil, nonce, plaintext, nil), nil
+}
+
+func gcmOpen(key, nonce, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeFile persists data, encrypting it when a key is configured.
+func (s *Storage) writeFile(path string, data []byte) error {
+	sealed, err := seal(s.key, data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", path, err)
+	}
+	return s.writePlain(path, sealed)
+}
+
+// writePlain writes data as is. Failed writes are counted in metrics.
+func (s *Storage) writePlain(path string, data []byte) error {
+	err := os.WriteFile(path, data, 0644)
+	if err != nil {
+		metrics.StorageWriteErrors.Inc()
+	}
+	return err
+}
+
+// readFile loads data written by writeFile.
+func (s *Storage) readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return unseal(s.key, data)
+}
+
+// RotateKey re-encrypts every stored batch, webhook delivery, monitor,
+// idempotency key, API key and tenant quota with newKey. A nil newKey decrypts the data
+// directory back to plaintext. All files are staged before any of them is
+// replaced, and replaced files are restored if a later one fails, so a
+// failure leaves the data readable with the old key.
+func (s *Storage) RotateKey(newKey []byte) (int, error) {
+	if newKey != nil && len(newKey) != encryptionKeySize {
+		return 0, ErrInvalidEncryptionKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	staged := make(map[string]string, len(s.batches))
+	cleanup := func() {
+		for tmpPath := range staged {
+			os.Remove(tmpPath)
+		}
+	}
+
+	for _, batch := range s.batches {
+		batch.SchemaVersion = CurrentSchemaVersion
+		data, err := json.MarshalIndent(batch, "", "  ")
+		if err != nil {
+			cleanup()
+			return 0, err
+		}
+
+		sealed, err := seal(newKey, data)
+		if err != nil {
+			cleanup()
+			return 0, fmt.Errorf("failed to encrypt batch %d: %w", batch.BatchID, err)
+		}
+
+		filePath := s.batchFilePath(batch.BatchID)
+		tmpPath := filePath + ".rotate"
+		if err := s.writePlain(tmpPath, sealed); err != nil {
+			cleanup()
+			return 0, fmt.Errorf("failed to stage batch %d: %w", batch.BatchID, err)
+		}
+		staged[tmpPath] = filePath
+	}
+
+	for _, dir := range sealedDirs {
+		if err := s.stageResealedDir(dir, newKey, staged); err != nil {
+			cleanup()
+			return 0, err
+		}
+	}
+
+	if err := replaceStaged(staged); err != nil {
+		return 0, err
+	}
+	s.key = newKey
+	return len(staged), nil
+}
+
+// replaceStaged moves staged files over the files they replace, keeping the
+// originals as .old until all of them are in place. If a move fails, the
+// files already replaced are restored and the error lists any file that
+// could not be.
+func replaceStaged(staged map[string]string) error {
+	var replaced []string
+	for tmpPath, filePath := range staged {
+		err := os.Rename(filePath, filePath+".old")
+		if err != nil && !os.IsNotExist(err) {
+			err = fmt.Errorf("failed to back up %s: %w", filePath, err)
+		} else if err = os.Rename(tmpPath, filePath); err != nil {
+			os.Rename(filePath+".old", filePath)
+			err = fmt.Errorf("failed to replace %s: %w", filePath, err)
+		}
+		if err != nil {
+			return restoreReplaced(staged, replaced, err)
+		}
+		replaced = append(replaced, filePath)
+	}
+
+	for _, filePath := range replaced {
+		os.Remove(filePath + ".old")
+	}
+	return nil
+}
+
+// restoreReplaced undoes replaceStaged after cause stopped it.
+func restoreReplaced(staged map[string]string, replaced []string, cause error) error {
+	for tmpPath := range staged {
+		os.Remove(tmpPath)
+	}
+
+	var stuck []string
+	for _, filePath := range replaced {
+		err := os.Rename(filePath+".old", filePath)
+		if os.IsNotExist(err) {
+			// The file is new, so there is nothing to restore.
+			err = os.Remove(filePath)
+		}
+		if err != nil {
+			stuck = append(stuck, filePath)
+		}
+	}
+	if len(stuck) > 0 {
+		sort.Strings(stuck)
+		return fmt.Errorf("%w; these files use the new key and their originals are kept as .old: %s", cause, strings.Join(stuck, ", "))
+	}
+	return fmt.Errorf("%w; all files were restored and still use the old key", cause)
+}
+
+// stageResealedDir writes a copy of every JSON file in a data subdirectory
+// sealed with newKey and records it in staged.
+func (s *Storage) stageResealedDir(dir string, newKey []byte, staged map[string]string) error {
+	files, err := os.ReadDir(filepath.Join(s.dataDir, dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" || file.Name() == nextIDFile {
+			continue
+		}
+
+		filePath := filepath.Join(s.dataDir, dir, file.Name())
+		data, err := s.readFile(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filePath, err)
+		}
+
+		sealed, err := seal(newKey, data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", filePath, err)
+		}
+
+		tmpPath := filePath + ".rotate"
+		if err := s.writePlain(tmpPath, sealed); err != nil {
+			return fmt.Errorf("failed to stage %s: %w", filePath, err)
+		}
+		staged[tmpPath] = filePath
+	}
+
+	return nil
+}
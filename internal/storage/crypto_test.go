@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// newTestStorage opens a storage in a temporary directory.
+func newTestStorage(t *testing.T, opts Options) *Storage {
+	t.Helper()
+	s, err := NewStorageWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatalf("NewStorageWithOptions: %v", err)
+	}
+	return s
+}
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, encryptionKeySize)
+}
+
+func TestParseKey(t *testing.T) {
+	key := testKey(7)
+
+	tests := []struct {
+		name    string
+		raw     []byte
+		wantErr bool
+	}{
+		{name: "raw", raw: key},
+		{name: "base64", raw: []byte(base64.StdEncoding.EncodeToString(key) + "\n")},
+		{name: "hex", raw: []byte(hex.EncodeToString(key))},
+		{name: "too short", raw: []byte("secret"), wantErr: true},
+		{name: "short base64", raw: []byte(base64.StdEncoding.EncodeToString(key[:16])), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKey(tt.raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidEncryptionKey) {
+					t.Errorf("error = %v, want ErrInvalidEncryptionKey", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseKey: %v", err)
+			}
+			if !bytes.Equal(got, key) {
+				t.Errorf("ParseKey = %x, want %x", got, key)
+			}
+		})
+	}
+}
+
+func TestSealUnseal(t *testing.T) {
+	plaintext := []byte(`{"batch_id": 1}`)
+	sealed, err := seal(testKey(1), plaintext)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if bytes.Contains(sealed, plaintext) {
+		t.Fatal("sealed data contains the plaintext")
+	}
+
+	tests := []struct {
+		name    string
+		key     []byte
+		data    []byte
+		want    []byte
+		wantErr error
+	}{
+		{name: "plaintext without key", data: plaintext, want: plaintext},
+		{name: "sealed with its key", key: testKey(1), data: sealed, want: plaintext},
+		{name: "sealed with another key", key: testKey(2), data: sealed, wantErr: ErrWrongEncryptionKey},
+		{name: "sealed without key", data: sealed, wantErr: ErrEncryptionKeyMissing},
+		{name: "plaintext with key", key: testKey(1), data: plaintext, wantErr: ErrNotEncrypted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unseal(tt.key, tt.data)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unseal: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("unseal = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	s := newTestStorage(t, Options{})
+	batchID, err := s.SaveBatch([]string{"https://a.example"}, BatchMetadata{Tenant: "acme"}, nil, 0, nil, nil)
+	if err != nil {
+		t.Fatalf("SaveBatch: %v", err)
+	}
+	if _, _, err := s.CreateAPIKey("ci", RoleSubmitter, "acme"); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if _, err := s.SetTenantQuota("acme", TenantQuota{MaxURLsPerBatch: 10}); err != nil {
+		t.Fatalf("SetTenantQuota: %v", err)
+	}
+	if _, _, err := s.ClaimIdempotencyKey("k", "h", DefaultIdempotencyTTL, func() (int64, error) { return batchID, nil }); err != nil {
+		t.Fatalf("ClaimIdempotencyKey: %v", err)
+	}
+
+	rotations := []struct {
+		name    string
+		from    []byte
+		to      []byte
+		wantErr error
+	}{
+		{name: "encrypt", to: testKey(1), wantErr: ErrEncryptionKeyMissing},
+		{name: "change key", from: testKey(1), to: testKey(2), wantErr: ErrWrongEncryptionKey},
+		{name: "decrypt", from: testKey(2), wantErr: ErrNotEncrypted},
+	}
+
+	for _, r := range rotations {
+		t.Run(r.name, func(t *testing.T) {
+			n, err := s.RotateKey(r.to)
+			if err != nil {
+				t.Fatalf("RotateKey: %v", err)
+			}
+			// The batch, API key, tenant and idempotency key.
+			if n != 4 {
+				t.Errorf("RotateKey rewrote %d files, want 4", n)
+			}
+
+			reopened, err := NewStorageWithOptions(s.dataDir, Options{EncryptionKey: r.to})
+			if err != nil {
+				t.Fatalf("reopening with the new key: %v", err)
+			}
+			if _, err := reopened.GetBatch(batchID); err != nil {
+				t.Errorf("GetBatch after reopening: %v", err)
+			}
+			if keys := reopened.ListAPIKeys("acme"); len(keys) != 1 {
+				t.Errorf("%d API keys after reopening, want 1", len(keys))
+			}
+			if tenants := reopened.ListTenants("acme"); len(tenants) != 1 || !tenants[0].Custom {
+				t.Errorf("tenants after reopening = %+v, want the acme quota", tenants)
+			}
+
+			if _, err := NewStorageWithOptions(s.dataDir, Options{EncryptionKey: r.from}); !errors.Is(err, r.wantErr) {
+				t.Errorf("reopening with the old key: error = %v, want %v", err, r.wantErr)
+			}
+		})
+	}
+}
+
+func TestRotateKeyRejectsShortKey(t *testing.T) {
+	s := newTestStorage(t, Options{})
+	if _, err := s.RotateKey([]byte("short")); !errors.Is(err, ErrInvalidEncryptionKey) {
+		t.Errorf("error = %v, want ErrInvalidEncryptionKey", err)
+	}
+}
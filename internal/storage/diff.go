@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DiffOptions tunes what counts as a latency regression.
+type DiffOptions struct {
+	// LatencyFactor is how many times slower a URL must get, e.g. 1.5.
+	LatencyFactor float64
+	// MinLatencyDeltaMs ignores slowdowns smaller than this, so fast URLs
+	// do not flap on noise.
+	MinLatencyDeltaMs int64
+}
+
+var DefaultDiffOptions = DiffOptions{
+	LatencyFactor:     1.5,
+	MinLatencyDeltaMs: 200,
+}
+
+// LinkChange is one URL that differs between two batches. From is nil for
+// added URLs and To is nil for removed ones.
+type LinkChange struct {
+	URL  string      `json:"url"`
+	From *LinkResult `json:"from,omitempty"`
+	To   *LinkResult `json:"to,omitempty"`
+}
+
+// BatchDiff describes what changed between two runs of a URL list.
+type BatchDiff struct {
+	From BatchSummary `json:"from"`
+	To   BatchSummary `json:"to"`
+
+	NewlyBroken        []LinkChange `json:"newly_broken"`
+	Recovered          []LinkChange `json:"recovered"`
+	StatusChanged      []LinkChange `json:"status_changed"`
+	LatencyRegressions []LinkChange `json:"latency_regressions"`
+	Added              []LinkChange `json:"added"`
+	Removed            []LinkChange `json:"removed"`
+
+	// Unchanged counts URLs checked in both batches with the same outcome.
+	Unchanged int `json:"unchanged"`
+	// Unchecked counts URLs present in both batches that lack a result in
+	// at least one of them, e.g. because a batch was cancelled.
+	Unchecked int `json:"unchecked"`
+}
+
+// HasChanges reports whether any URL differs between the two batches.
+func (d *BatchDiff) HasChanges() bool {
+	return len(d.NewlyBroken) > 0 || len(d.Recovered) > 0 || len(d.StatusChanged) > 0 ||
+		len(d.LatencyRegressions) > 0 || len(d.Added) > 0 || len(d.Removed) > 0
+}
+
+// DiffBatches compares two batches URL by URL. URLs are matched after
+// NormalizeURL; if a URL appears more than once, its last result is used.
+func DiffBatches(from, to *LinkBatch, opts DiffOptions) *BatchDiff {
+	diff := &BatchDiff{
+		From:               from.Summarize(time.Now()),
+		To:                 to.Summarize(time.Now()),
+		NewlyBroken:        make([]LinkChange, 0),
+		Recovered:          make([]LinkChange, 0),
+		StatusChanged:      make([]LinkChange, 0),
+		LatencyRegressions: make([]LinkChange, 0),
+		Added:              make([]LinkChange, 0),
+		Removed:            make([]LinkChange, 0),
+	}
+
+	fromURLs, fromResults := indexByURL(from)
+	toURLs, toResults := indexByURL(to)
+
+	for key, rawURL := range toURLs {
+		if _, ok := fromURLs[key]; !ok {
+			diff.Added = append(diff.Added, LinkChange{URL: rawURL, To: toResults[key]})
+		}
+	}
+
+	for key, rawURL := range fromURLs {
+		if _, ok := toURLs[key]; !ok {
+			diff.Removed = append(diff.Removed, LinkChange{URL: rawURL, From: fromResults[key]})
+			continue
+		}
+
+		before, after := fromResults[key], toResults[key]
+		if before == nil || after == nil {
+			diff.Unchecked++
+			continue
+		}
+
+		change := LinkChange{URL: toURLs[key], From: before, To: after}
+		switch {
+		case before.Available && !after.Available:
+			diff.NewlyBroken = append(diff.NewlyBroken, change)
+		case !before.Available && after.Available:
+			diff.Recovered = append(diff.Recovered, change)
+		case before.Status != after.Status:
+			diff.StatusChanged = append(diff.StatusChanged, change)
+		case isLatencyRegression(before, after, opts):
+			diff.LatencyRegressions = append(diff.LatencyRegressions, change)
+		default:
+			diff.Unchanged++
+		}
+	}
+
+	for _, changes := range [][]LinkChange{diff.NewlyBroken, diff.Recovered, diff.StatusChanged, diff.LatencyRegressions, diff.Added, diff.Removed} {
+		sort.Slice(changes, func(i, j int) bool {
+			return changes[i].URL < changes[j].URL
+		})
+	}
+
+	return diff
+}
+
+func isLatencyRegression(before, after *LinkResult, opts DiffOptions) bool {
+	if !after.Available || before.ResponseTimeMs <= 0 || after.ResponseTimeMs <= 0 {
+		return false
+	}
+	if after.ResponseTimeMs-before.ResponseTimeMs < opts.MinLatencyDeltaMs {
+		return false
+	}
+	return float64(after.ResponseTimeMs) >= float64(before.ResponseTimeMs)*opts.LatencyFactor
+}
+
+// indexByURL maps normalized URLs to the URL as submitted and to its
+// result, if the URL has been checked.
+func indexByURL(batch *LinkBatch) (map[string]string, map[string]*LinkResult) {
+	urls := make(map[string]string, len(batch.URLs))
+	for _, rawURL := range batch.URLs {
+		urls[NormalizeURL(rawURL)] = rawURL
+	}
+
+	results := make(map[string]*LinkResult, len(batch.Results))
+	for i := range batch.Results {
+		result := batch.Results[i]
+		results[NormalizeURL(result.URL)] = &result
+	}
+
+	return urls, results
+}
+
+// NormalizeURL reduces equivalent spellings of a URL to one key: the scheme
+// and host are lowercased, default ports and fragments are dropped, an
+// empty path becomes "/" and query parameters are sorted.
+func NormalizeURL(rawURL string) string {
+	trimmed := strings.TrimSpace(rawURL)
+	parsed, err := url.Parse(trimmed)
+	if err != nil || parsed.Host == "" {
+		return trimmed
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	host := strings.ToLower(parsed.Hostname())
+	if strings.Contains(host, ":") {
+		// IPv6 literal.
+		host = "[" + host + "]"
+	}
+	port := parsed.Port()
+	if (parsed.Scheme == "http" && port == "80") || (parsed.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	parsed.Host = host
+
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	if parsed.RawQuery != "" {
+		parsed.RawQuery = parsed.Query().Encode()
+	}
+
+	return parsed.String()
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// BatchFilter selects batches by their metadata and state. Empty fields
+// match everything; every listed tag and label must be present on the batch.
+type BatchFilter struct {
+	// Tenant, when set, restricts the filter to one tenant. It only scopes
+	// the filter and does not count towards IsEmpty.
+	Tenant string
+
+	Name   string
+	Owner  string
+	Tags   []string
+	Labels map[string]string
+
+	Statuses    []string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// ContainsURL matches batches with at least one URL containing it.
+	ContainsURL string
+	// HasFailures, when set, matches batches with (true) or without (false)
+	// unavailable links.
+	HasFailures *bool
+}
+
+// IsEmpty reports whether the filter matches every batch.
+func (f BatchFilter) IsEmpty() bool {
+	return f.Name == "" && f.Owner == "" && len(f.Tags) == 0 && len(f.Labels) == 0 &&
+		len(f.Statuses) == 0 && f.CreatedFrom.IsZero() && f.CreatedTo.IsZero() &&
+		f.ContainsURL == "" && f.HasFailures == nil
+}
+
+// Matches reports whether batch satisfies the filter.
+func (f BatchFilter) Matches(batch *LinkBatch) bool {
+	if f.Tenant != "" && batch.Tenant != f.Tenant {
+		return false
+	}
+	if f.Name != "" && batch.Name != f.Name {
+		return false
+	}
+	if f.Owner != "" && batch.Owner != f.Owner {
+		return false
+	}
+
+	for _, tag := range f.Tags {
+		if !batch.HasTag(tag) {
+			return false
+		}
+	}
+
+	for key, value := range f.Labels {
+		if actual, ok := batch.Labels[key]; !ok || actual != value {
+			return false
+		}
+	}
+
+	if len(f.Statuses) > 0 && !containsString(f.Statuses, batch.Status) {
+		return false
+	}
+
+	if !f.CreatedFrom.IsZero() || !f.CreatedTo.IsZero() {
+		created, err := time.Parse(time.RFC3339, batch.CreatedAt)
+		if err != nil {
+			return false
+		}
+		if !f.CreatedFrom.IsZero() && created.Before(f.CreatedFrom) {
+			return false
+		}
+		if !f.CreatedTo.IsZero() && created.After(f.CreatedTo) {
+			return false
+		}
+	}
+
+	if f.ContainsURL != "" && !batchContainsURL(batch, f.ContainsURL) {
+		return false
+	}
+
+	if f.HasFailures != nil && (batch.unavailableCount() > 0) != *f.HasFailures {
+		return false
+	}
+
+	return true
+}
+
+func batchContainsURL(batch *LinkBatch, fragment string) bool {
+	for _, u := range batch.URLs {
+		if strings.Contains(u, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// HasTag reports whether the batch carries tag.
+func (m BatchMetadata) HasTag(tag string) bool {
+	return containsString(m.Tags, tag)
+}
+
+// FindBatches returns the batches matching filter ordered by ID.
+func (s *Storage) FindBatches(filter BatchFilter) []*LinkBatch {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found []*LinkBatch
+	for _, batch := range s.batches {
+		if filter.Matches(batch) {
+			found = append(found, batch.snapshot())
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].BatchID < found[j].BatchID
+	})
+
+	return found
+}
+
+// ParseTimeBound parses a time filter given either as an RFC3339 timestamp
+// or a plain date. With endOfDay set, a plain date covers the whole day. An
+// empty value is the zero time, which filters nothing.
+func ParseTimeBound(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const idempotencyDir = "idempotency"
+
+// DefaultIdempotencyTTL is how long an idempotency key is remembered.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// ErrIdempotencyConflict is returned when a key is reused for a different
+// request.
+var ErrIdempotencyConflict = errors.New("idempotency key was already used for a different request")
+
+// IdempotencyRecord maps a client-supplied key to the batch it created.
+type IdempotencyRecord struct {
+	Key         string `json:"key"`
+	RequestHash string `json:"request_hash"`
+	BatchID     int64  `json:"batch_id"`
+	CreatedAt   string `json:"created_at"`
+	ExpiresAt   string `json:"expires_at"`
+}
+
+func (r *IdempotencyRecord) expired(now time.Time) bool {
+	return !now.Before(parseTimestamp(r.ExpiresAt))
+}
+
+// idempotencySweepInterval is how often claiming a key also forgets every
+// expired one, so keys do not pile up when the janitor is off.
+const idempotencySweepInterval = time.Minute
+
+// idempotencyKeys keeps records in memory; every record is also a file so
+// keys survive restarts. inFlight holds keys whose batch is being created;
+// the channel is closed once it is.
+type idempotencyKeys struct {
+	mu       sync.Mutex
+	records  map[string]*IdempotencyRecord
+	inFlight map[string]chan struct{}
+	sweptAt  time.Time
+}
+
+// ClaimIdempotencyKey returns the batch created earlier for key, or calls
+// create and remembers its batch for ttl. A key whose record holds a
+// different requestHash yields ErrIdempotencyConflict. Concurrent retries
+// of one key wait for the first to finish, so they create a single batch;
+// claims of other keys are not held up.
+func (s *Storage) ClaimIdempotencyKey(key, requestHash string, ttl time.Duration, create func() (int64, error)) (batchID int64, replayed bool, err error) {
+	s.idempotency.mu.Lock()
+	for {
+		now := time.Now()
+		if now.Sub(s.idempotency.sweptAt) >= idempotencySweepInterval {
+			s.purgeExpiredIdempotencyKeysLocked(now)
+			s.idempotency.sweptAt = now
+		}
+
+		if record, ok := s.idempotency.records[key]; ok {
+			if !record.expired(now) {
+				s.idempotency.mu.Unlock()
+				if record.RequestHash != requestHash {
+					return 0, false, ErrIdempotencyConflict
+				}
+				return record.BatchID, true, nil
+			}
+			s.deleteIdempotencyRecordLocked(key)
+		}
+
+		done, busy := s.idempotency.inFlight[key]
+		if !busy {
+			break
+		}
+		s.idempotency.mu.Unlock()
+		<-done
+		s.idempotency.mu.Lock()
+	}
+
+	done := make(chan struct{})
+	s.idempotency.inFlight[key] = done
+	s.idempotency.mu.Unlock()
+
+	defer func() {
+		s.idempotency.mu.Lock()
+		delete(s.idempotency.inFlight, key)
+		s.idempotency.mu.Unlock()
+		close(done)
+	}()
+
+	batchID, err = create()
+	if err != nil {
+		return batchID, false, err
+	}
+
+	now := time.Now()
+	record := &IdempotencyRecord{
+		Key:         key,
+		RequestHash: requestHash,
+		BatchID:     batchID,
+		CreatedAt:   now.Format(time.RFC3339),
+		ExpiresAt:   now.Add(ttl).Format(time.RFC3339),
+	}
+
+	s.idempotency.mu.Lock()
+	s.idempotency.records[key] = record
+	s.idempotency.mu.Unlock()
+
+	if err := s.persistIdempotencyRecord(record); err != nil {
+		return batchID, false, fmt.Errorf("failed to store idempotency key: %w", err)
+	}
+
+	return batchID, false, nil
+}
+
+// PurgeExpiredIdempotencyKeys forgets keys past their expiry and returns
+// how many were removed.
+func (s *Storage) PurgeExpiredIdempotencyKeys(now time.Time) int {
+	s.idempotency.mu.Lock()
+	defer s.idempotency.mu.Unlock()
+
+	return s.purgeExpiredIdempotencyKeysLocked(now)
+}
+
+func (s *Storage) purgeExpiredIdempotencyKeysLocked(now time.Time) int {
+	purged := 0
+	for key, record := range s.idempotency.records {
+		if record.expired(now) {
+			s.deleteIdempotencyRecordLocked(key)
+			purged++
+		}
+	}
+	return purged
+}
+
+func (s *Storage) loadIdempotencyKeys() error {
+	dir := filepath.Join(s.dataDir, idempotencyDir)
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	now := time.Now()
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		path := filepath.Join(dir, file.Name())
+		data, err := s.readFile(path)
+		if isKeyError(err) {
+			return fmt.Errorf("%s: %w", file.Name(), err)
+		}
+		if err != nil {
+			continue
+		}
+
+		var record IdempotencyRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			continue
+		}
+
+		if record.expired(now) {
+			os.Remove(path)
+			continue
+		}
+		s.idempotency.records[record.Key] = &record
+	}
+
+	return nil
+}
+
+func (s *Storage) deleteIdempotencyRecordLocked(key string) {
+	delete(s.idempotency.records, key)
+	os.Remove(s.idempotencyFilePath(key))
+}
+
+// idempotencyFilePath names files by a hash of the key, since keys are
+// arbitrary client strings.
+func (s *Storage) idempotencyFilePath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dataDir, idempotencyDir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (s *Storage) persistIdempotencyRecord(record *IdempotencyRecord) error {
+	if err := os.MkdirAll(filepath.Join(s.dataDir, idempotencyDir), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return s.writeFile(s.idempotencyFilePath(record.Key), data)
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClaimIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		hash         string
+		wantID       int64
+		wantReplayed bool
+		wantErr      error
+	}{
+		{name: "same request replays", hash: "h1", wantID: 1, wantReplayed: true},
+		{name: "different request conflicts", hash: "h2", wantErr: ErrIdempotencyConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t, Options{})
+			if _, _, err := s.ClaimIdempotencyKey("k", "h1", time.Hour, func() (int64, error) { return 1, nil }); err != nil {
+				t.Fatalf("first claim: %v", err)
+			}
+
+			id, replayed, err := s.ClaimIdempotencyKey("k", tt.hash, time.Hour, func() (int64, error) {
+				t.Error("create ran for a known key")
+				return 2, nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if id != tt.wantID || replayed != tt.wantReplayed {
+				t.Errorf("claim = %d, %v, want %d, %v", id, replayed, tt.wantID, tt.wantReplayed)
+			}
+		})
+	}
+}
+
+func TestClaimIdempotencyKeyConcurrent(t *testing.T) {
+	s := newTestStorage(t, Options{})
+
+	var created atomic.Int64
+	var wg sync.WaitGroup
+	ids := make([]int64, 8)
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id, _, err := s.ClaimIdempotencyKey("k", "h", time.Hour, func() (int64, error) {
+				time.Sleep(10 * time.Millisecond)
+				return created.Add(1), nil
+			})
+			if err != nil {
+				t.Errorf("claim: %v", err)
+			}
+			ids[i] = id
+		}()
+	}
+	wg.Wait()
+
+	if n := created.Load(); n != 1 {
+		t.Fatalf("create ran %d times, want once", n)
+	}
+	for i, id := range ids {
+		if id != 1 {
+			t.Errorf("claim %d got batch %d, want 1", i, id)
+		}
+	}
+}
+
+func TestClaimIdempotencyKeyFailedCreate(t *testing.T) {
+	s := newTestStorage(t, Options{})
+	failed := errors.New("quota exceeded")
+
+	if _, _, err := s.ClaimIdempotencyKey("k", "h", time.Hour, func() (int64, error) { return 0, failed }); !errors.Is(err, failed) {
+		t.Fatalf("error = %v, want %v", err, failed)
+	}
+
+	// A failed request is not remembered, so a retry creates the batch.
+	id, replayed, err := s.ClaimIdempotencyKey("k", "h", time.Hour, func() (int64, error) { return 3, nil })
+	if err != nil || id != 3 || replayed {
+		t.Errorf("retry = %d, %v, %v, want 3, false, nil", id, replayed, err)
+	}
+}
+
+func TestIdempotencyKeysExpire(t *testing.T) {
+	s := newTestStorage(t, Options{})
+	if _, _, err := s.ClaimIdempotencyKey("k", "h", time.Hour, func() (int64, error) { return 1, nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewStorage(s.dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, replayed, _ := reopened.ClaimIdempotencyKey("k", "h", time.Hour, nil); id != 1 || !replayed {
+		t.Errorf("after reopening: claim = %d, %v, want a replay of 1", id, replayed)
+	}
+
+	if n := reopened.PurgeExpiredIdempotencyKeys(time.Now()); n != 0 {
+		t.Errorf("purged %d live keys", n)
+	}
+	if n := reopened.PurgeExpiredIdempotencyKeys(time.Now().Add(2 * time.Hour)); n != 1 {
+		t.Errorf("purged %d keys after expiry, want 1", n)
+	}
+
+	id, replayed, err := reopened.ClaimIdempotencyKey("k", "other", time.Hour, func() (int64, error) { return 2, nil })
+	if err != nil || id != 2 || replayed {
+		t.Errorf("claim after expiry = %d, %v, %v, want 2, false, nil", id, replayed, err)
+	}
+}
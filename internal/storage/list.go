@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort field")
+)
+
+// sortFields maps the supported sort names to the summary value they order by.
+// Ties are ordered by public ID, so batch_id needs no value of its own:
+// public IDs are ULIDs and sort by creation time.
+var sortFields = map[string]func(BatchSummary) float64{
+	"batch_id":   func(b BatchSummary) float64 { return 0 },
+	"created_at": func(b BatchSummary) float64 { return float64(parseTimestamp(b.CreatedAt).Unix()) },
+	"links":      func(b BatchSummary) float64 { return float64(b.Total) },
+	"failures":   liveSortValue(func(b BatchSummary) float64 { return float64(b.Unavailable) }),
+	"duration":   liveSortValue(func(b BatchSummary) float64 { return b.DurationSeconds }),
+}
+
+// liveSortValue wraps a sort value that keeps changing while a batch is
+// checked. A cursor holding such a value would skip or repeat the batch on
+// the next page, so pending and processing batches all share the highest
+// value instead and are ordered among themselves by public ID.
+func liveSortValue(value func(BatchSummary) float64) func(BatchSummary) float64 {
+	return func(b BatchSummary) float64 {
+		if b.Status == "pending" || b.Status == "processing" {
+			return math.MaxFloat64
+		}
+		return value(b)
+	}
+}
+
+// BatchSummary is a compact view of a batch without its result array.
+// BatchID is internal; the public ID is serialized as batch_id.
+type BatchSummary struct {
+	BatchID         int64   `json:"-"`
+	PublicID        string  `json:"batch_id"`
+	Status          string  `json:"status"`
+	CreatedAt       string  `json:"created_at"`
+	StartedAt       string  `json:"started_at,omitempty"`
+	FinishedAt      string  `json:"finished_at,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Total           int     `json:"total"`
+	Checked         int     `json:"checked"`
+	Available       int     `json:"available"`
+	Unavailable     int     `json:"unavailable"`
+	BatchMetadata
+}
+
+type ListOptions struct {
+	Filter     BatchFilter
+	SortBy     string
+	Descending bool
+	Limit      int
+	Cursor     string
+}
+
+type BatchPage struct {
+	Batches    []BatchSummary `json:"batches"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// listCursor marks the last item of a page by its sort value and public
+// ID. Internal IDs are left out, as they would tell how many batches the
+// instance holds.
+type listCursor struct {
+	Value float64 `json:"v"`
+	ID    string  `json:"id"`
+}
+
+// Summarize builds the summary of a batch at the given moment.
+func (b *LinkBatch) Summarize(now time.Time) BatchSummary {
+	summary := BatchSummary{
+		BatchID:       b.BatchID,
+		PublicID:      b.PublicID,
+		Status:        b.Status,
+		CreatedAt:     b.CreatedAt,
+		StartedAt:     b.StartedAt,
+		FinishedAt:    b.FinishedAt,
+		Total:         len(b.URLs),
+		Checked:       len(b.Results),
+		Unavailable:   b.unavailableCount(),
+		BatchMetadata: b.BatchMetadata,
+	}
+	summary.Available = summary.Checked - summary.Unavailable
+
+	if b.StartedAt != "" {
+		end := now
+		if b.FinishedAt != "" {
+			end = parseTimestamp(b.FinishedAt)
+		}
+		summary.DurationSeconds = end.Sub(parseTimestamp(b.StartedAt)).Seconds()
+	}
+
+	return summary
+}
+
+func (b *LinkBatch) unavailableCount() int {
+	count := 0
+	for _, result := range b.Results {
+		if !result.Available {
+			count++
+		}
+	}
+	return count
+}
+
+// ListBatchSummaries returns one page of batch summaries matching opts.
+func (s *Storage) ListBatchSummaries(opts ListOptions) (*BatchPage, error) {
+	if opts.SortBy == "" {
+		opts.SortBy = "batch_id"
+	}
+	sortValue, ok := sortFields[opts.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSort, opts.SortBy)
+	}
+
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultListLimit
+	}
+	if opts.Limit > MaxListLimit {
+		opts.Limit = MaxListLimit
+	}
+
+	var after *listCursor
+	if opts.Cursor != "" {
+		cursor, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = cursor
+	}
+
+	now := time.Now()
+	s.mu.RLock()
+	var summaries []BatchSummary
+	for _, batch := range s.batches {
+		if opts.Filter.Matches(batch) {
+			summaries = append(summaries, batch.Summarize(now))
+		}
+	}
+	s.mu.RUnlock()
+
+	less := func(a, b listCursor) bool {
+		if opts.Descending {
+			a, b = b, a
+		}
+		if a.Value != b.Value {
+			return a.Value < b.Value
+		}
+		return a.ID < b.ID
+	}
+	keyOf := func(b BatchSummary) listCursor {
+		return listCursor{Value: sortValue(b), ID: b.PublicID}
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return less(keyOf(summaries[i]), keyOf(summaries[j]))
+	})
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(summaries), func(i int) bool {
+			return less(*after, keyOf(summaries[i]))
+		})
+	}
+
+	end := start + opts.Limit
+	if end > len(summaries) {
+		end = len(summaries)
+	}
+
+	page := &BatchPage{Batches: summaries[start:end]}
+	if page.Batches == nil {
+		page.Batches = []BatchSummary{}
+	}
+	if end < len(summaries) {
+		page.NextCursor = encodeCursor(keyOf(summaries[end-1]))
+	}
+
+	return page, nil
+}
+
+func encodeCursor(c listCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+func parseTimestamp(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
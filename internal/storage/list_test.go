@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"encoding/base64"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestListBatchSummariesPaging(t *testing.T) {
+	s := newTestStorage(t, Options{})
+	var want []string
+	for i := range 7 {
+		urls := make([]string, i%3+1)
+		for j := range urls {
+			urls[j] = "https://example.com/"
+		}
+		id, err := s.SaveBatch(urls, BatchMetadata{}, nil, 0, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		batch, _ := s.GetBatch(id)
+		want = append(want, batch.PublicID)
+	}
+
+	for _, sortBy := range []string{"batch_id", "created_at", "links", "failures", "duration"} {
+		for _, descending := range []bool{false, true} {
+			var got []string
+			cursor := ""
+			for pages := 0; ; pages++ {
+				if pages > len(want) {
+					t.Fatalf("sort %s: paging does not end", sortBy)
+				}
+				page, err := s.ListBatchSummaries(ListOptions{SortBy: sortBy, Descending: descending, Limit: 3, Cursor: cursor})
+				if err != nil {
+					t.Fatalf("sort %s: %v", sortBy, err)
+				}
+				for _, b := range page.Batches {
+					got = append(got, b.PublicID)
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				cursor = page.NextCursor
+
+				data, err := base64.RawURLEncoding.DecodeString(cursor)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(data), `"id":"`) {
+					t.Errorf("sort %s: cursor %s does not hold a public ID", sortBy, data)
+				}
+			}
+
+			if sortBy == "batch_id" && !descending && !slices.Equal(got, slices.Sorted(slices.Values(want))) {
+				t.Errorf("sort batch_id: got %v, want public ID order", got)
+			}
+			if !slices.Equal(slices.Sorted(slices.Values(got)), slices.Sorted(slices.Values(want))) {
+				t.Errorf("sort %s, descending %v: pages returned %v, want every batch once", sortBy, descending, got)
+			}
+		}
+	}
+}
+
+func TestListBatchSummariesErrors(t *testing.T) {
+	s := newTestStorage(t, Options{})
+	legacyCursor := base64.RawURLEncoding.EncodeToString([]byte(`{"v":3,"id":3}`))
+
+	for _, opts := range []ListOptions{
+		{SortBy: "name"},
+		{Cursor: "!!"},
+		{Cursor: legacyCursor},
+	} {
+		if _, err := s.ListBatchSummaries(opts); err == nil {
+			t.Errorf("ListBatchSummaries(%+v) succeeded", opts)
+		}
+	}
+}
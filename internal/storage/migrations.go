@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CurrentSchemaVersion is the schema version written to every persisted batch.
+// Files written before versioning was introduced are treated as version 0.
+const CurrentSchemaVersion = 4
+
+var ErrUnknownSchemaVersion = errors.New("unknown schema version")
+
+// migration upgrades a raw batch document from one schema version to the next.
+type migration func(doc map[string]any) error
+
+// migrations maps a source schema version to the step that upgrades it by one.
+var migrations = map[int]migration{
+	0: migrateV0ToV1,
+	1: migrateV1ToV2,
+	2: migrateV2ToV3,
+	3: migrateV3ToV4,
+}
+
+// migrateV0ToV1 normalizes legacy files that may store null result lists.
+func migrateV0ToV1(doc map[string]any) error {
+	if doc["results"] == nil {
+		doc["results"] = []any{}
+	}
+	if doc["urls"] == nil {
+		doc["urls"] = []any{}
+	}
+	return nil
+}
+
+// migrateV1ToV2 assigns the tenant introduced with multi-tenant access.
+// Existing batches belong to the default tenant. They also lack the public
+// ID, which indexBatchLocked assigns when the batch is loaded; the loader
+// stores it right away so the ID stays the same across restarts.
+func migrateV1ToV2(doc map[string]any) error {
+	if tenant, _ := doc["tenant"].(string); tenant == "" {
+		doc["tenant"] = DefaultTenant
+	}
+	return nil
+}
+
+// migrateV2ToV3 marks the schema that records response times. Results
+// checked before have none and keep response_time_ms unset, which the diff
+// treats as unknown rather than as an instant response.
+func migrateV2ToV3(doc map[string]any) error {
+	return nil
+}
+
+// migrateV3ToV4 drops the sources of URLs that have a result, which carries
+// them already, so sources are stored once.
+func migrateV3ToV4(doc map[string]any) error {
+	sources, _ := doc["sources"].(map[string]any)
+	results, _ := doc["results"].([]any)
+	for _, raw := range results {
+		if result, ok := raw.(map[string]any); ok {
+			url, _ := result["url"].(string)
+			delete(sources, url)
+		}
+	}
+	if len(sources) == 0 {
+		delete(doc, "sources")
+	}
+	return nil
+}
+
+// decodeBatch parses a persisted batch, upgrading it to CurrentSchemaVersion.
+// It reports whether any migration was applied.
+func decodeBatch(data []byte) (*LinkBatch, bool, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var doc map[string]any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, false, err
+	}
+
+	version, err := schemaVersionOf(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	if version > CurrentSchemaVersion {
+		return nil, false, fmt.Errorf("%w: %d (newest supported is %d)", ErrUnknownSchemaVersion, version, CurrentSchemaVersion)
+	}
+
+	migrated := version < CurrentSchemaVersion
+	for ; version < CurrentSchemaVersion; version++ {
+		step, ok := migrations[version]
+		if !ok {
+			return nil, false, fmt.Errorf("no migration from schema version %d", version)
+		}
+		if err := step(doc); err != nil {
+			return nil, false, fmt.Errorf("migration from schema version %d failed: %w", version, err)
+		}
+	}
+	doc["schema_version"] = CurrentSchemaVersion
+
+	upgraded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var batch LinkBatch
+	if err := json.Unmarshal(upgraded, &batch); err != nil {
+		return nil, false, err
+	}
+
+	return &batch, migrated, nil
+}
+
+// ignoreLegacyBatchIDs drops the error of decoding a manifest or daily
+// summary written when batch_ids listed internal IDs. Those IDs are of no
+// use outside the instance that wrote them, so they are left out.
+func ignoreLegacyBatchIDs(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && strings.HasPrefix(typeErr.Field, "batch_ids") {
+		return nil
+	}
+	return err
+}
+
+func schemaVersionOf(doc map[string]any) (int, error) {
+	raw, ok := doc["schema_version"]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+
+	number, ok := raw.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("schema_version must be a number, got %v", raw)
+	}
+
+	version, err := number.Int64()
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid schema_version %q", number)
+	}
+
+	return int(version), nil
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodeBatch(t *testing.T) {
+	tests := []struct {
+		name         string
+		doc          string
+		wantMigrated bool
+		check        func(t *testing.T, b *LinkBatch)
+	}{
+		{
+			name:         "v0 null lists",
+			doc:          `{"batch_id": 1, "urls": null, "results": null, "created_at": "2025-01-02T03:04:05Z", "status": "completed"}`,
+			wantMigrated: true,
+			check: func(t *testing.T, b *LinkBatch) {
+				if b.URLs == nil || b.Results == nil {
+					t.Errorf("urls = %v, results = %v, want empty lists", b.URLs, b.Results)
+				}
+			},
+		},
+		{
+			name:         "v1 gets the default tenant",
+			doc:          `{"schema_version": 1, "batch_id": 2, "urls": ["https://a.example"], "results": [], "created_at": "2025-01-02T03:04:05Z", "status": "pending"}`,
+			wantMigrated: true,
+			check: func(t *testing.T, b *LinkBatch) {
+				if b.Tenant != DefaultTenant {
+					t.Errorf("tenant = %q, want %q", b.Tenant, DefaultTenant)
+				}
+			},
+		},
+		{
+			name:         "v2 keeps its tenant and public ID",
+			doc:          `{"schema_version": 2, "batch_id": 3, "public_id": "01JGZ0000000000000000000AB", "tenant": "acme", "urls": [], "results": [], "status": "completed"}`,
+			wantMigrated: true,
+			check: func(t *testing.T, b *LinkBatch) {
+				if b.PublicID != "01JGZ0000000000000000000AB" || b.Tenant != "acme" {
+					t.Errorf("public ID = %q, tenant = %q, want them unchanged", b.PublicID, b.Tenant)
+				}
+			},
+		},
+		{
+			name: "v3 moves sources of checked URLs to the results",
+			doc: `{"schema_version": 3, "batch_id": 4, "public_id": "01JGZ0000000000000000000AC", "tenant": "default",
+				"urls": ["https://a.example", "https://b.example"],
+				"results": [{"url": "https://a.example", "status": 200, "available": true, "sources": [{"file": "a.md", "line": 1}]}],
+				"sources": {"https://a.example": [{"file": "a.md", "line": 1}], "https://b.example": [{"file": "b.md", "line": 2}]},
+				"status": "processing"}`,
+			wantMigrated: true,
+			check: func(t *testing.T, b *LinkBatch) {
+				if _, ok := b.Sources["https://a.example"]; ok {
+					t.Error("sources of a checked URL were kept on the batch")
+				}
+				if got := b.Sources["https://b.example"]; len(got) != 1 || got[0].File != "b.md" {
+					t.Errorf("sources of the pending URL = %v, want b.md", got)
+				}
+			},
+		},
+		{
+			name: "v3 without pending sources drops the map",
+			doc: `{"schema_version": 3, "batch_id": 5, "public_id": "01JGZ0000000000000000000AD", "tenant": "default",
+				"urls": ["https://a.example"],
+				"results": [{"url": "https://a.example", "status": 200, "available": true}],
+				"sources": {"https://a.example": [{"file": "a.md", "line": 1}]},
+				"status": "completed"}`,
+			wantMigrated: true,
+			check: func(t *testing.T, b *LinkBatch) {
+				if b.Sources != nil {
+					t.Errorf("sources = %v, want none", b.Sources)
+				}
+			},
+		},
+		{
+			name: "current version is not migrated",
+			doc:  `{"schema_version": 4, "batch_id": 6, "public_id": "01JGZ0000000000000000000AE", "tenant": "default", "urls": [], "results": [], "status": "completed"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, migrated, err := decodeBatch([]byte(tt.doc))
+			if err != nil {
+				t.Fatalf("decodeBatch: %v", err)
+			}
+			if migrated != tt.wantMigrated {
+				t.Errorf("migrated = %v, want %v", migrated, tt.wantMigrated)
+			}
+			if b.SchemaVersion != CurrentSchemaVersion {
+				t.Errorf("schema version = %d, want %d", b.SchemaVersion, CurrentSchemaVersion)
+			}
+			if tt.check != nil {
+				tt.check(t, b)
+			}
+		})
+	}
+}
+
+func TestDecodeBatchErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr error
+	}{
+		{name: "future version", doc: `{"schema_version": 99}`, wantErr: ErrUnknownSchemaVersion},
+		{name: "version is a string", doc: `{"schema_version": "2"}`},
+		{name: "negative version", doc: `{"schema_version": -1}`},
+		{name: "not JSON", doc: `batch`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := decodeBatch([]byte(tt.doc))
+			if err == nil {
+				t.Fatal("decodeBatch succeeded")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadRewritesMigratedBatches(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "batch_1.json")
+	legacy := `{"batch_id": 1, "urls": ["https://a.example"], "results": null, "created_at": "2025-01-02T03:04:05Z", "status": "completed"}`
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewStorageWithOptions(dir, Options{RewriteMigrated: true})
+	if err != nil {
+		t.Fatalf("NewStorageWithOptions: %v", err)
+	}
+	if _, err := s.GetBatch(1); err != nil {
+		t.Fatalf("GetBatch: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), fmt.Sprintf(`"schema_version": %d`, CurrentSchemaVersion)) {
+		t.Errorf("rewritten file does not carry the current schema version:\n%s", data)
+	}
+}
+
+func TestLoadKeepsAssignedPublicIDs(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{"batch_id": 1, "urls": ["https://a.example"], "results": [], "created_at": "2025-01-02T03:04:05Z", "status": "completed"}`
+	if err := os.WriteFile(filepath.Join(dir, "batch_1.json"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without RewriteMigrated, as the subcommands open the storage.
+	var publicID string
+	for i := range 3 {
+		s, err := NewStorage(dir)
+		if err != nil {
+			t.Fatalf("open %d: %v", i, err)
+		}
+		batch, err := s.GetBatch(1)
+		if err != nil {
+			t.Fatalf("open %d: GetBatch: %v", i, err)
+		}
+		if len(batch.PublicID) != 26 {
+			t.Fatalf("open %d: public ID = %q, want a ULID", i, batch.PublicID)
+		}
+		if i > 0 && batch.PublicID != publicID {
+			t.Errorf("open %d: public ID changed from %s to %s", i, publicID, batch.PublicID)
+		}
+		publicID = batch.PublicID
+
+		if _, err := s.GetTenantBatch(DefaultTenant, publicID); err != nil {
+			t.Errorf("open %d: GetTenantBatch: %v", i, err)
+		}
+	}
+}
+
+func TestLoadRefusesFutureSchema(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "batch_1.json"), []byte(`{"schema_version": 99, "batch_id": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewStorage(dir); !errors.Is(err, ErrUnknownSchemaVersion) {
+		t.Errorf("NewStorage error = %v, want ErrUnknownSchemaVersion", err)
+	}
+}
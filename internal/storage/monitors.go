@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	monitorsDir = "monitors"
+	// nextIDFile keeps the ID counter of a subdirectory such as monitors,
+	// so IDs of deleted entries are never reused.
+	nextIDFile = "next_id.json"
+)
+
+var ErrMonitorNotFound = errors.New("monitor not found")
+
+// Monitor is a saved set of URLs that is checked on a schedule. Every run
+// creates a normal batch.
+type Monitor struct {
+	ID   int64    `json:"id"`
+	URLs []string `json:"urls"`
+	// Exactly one of Cron and Interval is set.
+	Cron     string `json:"cron,omitempty"`
+	Interval string `json:"interval,omitempty"`
+	Paused   bool   `json:"paused"`
+	Priority int    `json:"priority,omitempty"`
+	BatchMetadata
+	Notify *NotifySettings `json:"notify,omitempty"`
+
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+	// NextRunAt is persisted before a run starts, so a restart never fires
+	// the same scheduled run twice.
+	NextRunAt   string `json:"next_run_at,omitempty"`
+	LastRunAt   string `json:"last_run_at,omitempty"`
+	LastBatchID int64  `json:"last_batch_id,omitempty"`
+}
+
+func (m *Monitor) snapshot() *Monitor {
+	c := *m
+	c.URLs = append([]string(nil), m.URLs...)
+	if m.Notify != nil {
+		notify := *m.Notify
+		c.Notify = &notify
+	}
+	return &c
+}
+
+// CreateMonitor assigns an ID to monitor and persists it.
+func (s *Storage) CreateMonitor(monitor *Monitor) (*Monitor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	monitor = monitor.snapshot()
+	monitor.ID = s.nextMonitorID
+	monitor.Tenant = tenantOrDefault(monitor.Tenant)
+
+	if err := s.persistMonitor(monitor); err != nil {
+		return nil, err
+	}
+	s.monitors[monitor.ID] = monitor
+	s.nextMonitorID++
+	s.persistNextMonitorID()
+
+	return monitor.snapshot(), nil
+}
+
+// UpdateMonitor applies update to the stored monitor under the storage lock
+// and persists the result. If update returns an error nothing is changed.
+func (s *Storage) UpdateMonitor(id int64, update func(m *Monitor) error) (*Monitor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.monitors[id]
+	if !exists {
+		return nil, fmt.Errorf("%w: %d", ErrMonitorNotFound, id)
+	}
+
+	monitor := current.snapshot()
+	if err := update(monitor); err != nil {
+		return nil, err
+	}
+	monitor.ID = id
+
+	if err := s.persistMonitor(monitor); err != nil {
+		return nil, err
+	}
+	s.monitors[id] = monitor
+
+	return monitor.snapshot(), nil
+}
+
+func (s *Storage) GetMonitor(id int64) (*Monitor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	monitor, exists := s.monitors[id]
+	if !exists {
+		return nil, fmt.Errorf("%w: %d", ErrMonitorNotFound, id)
+	}
+
+	return monitor.snapshot(), nil
+}
+
+// ListMonitors returns all monitors ordered by ID.
+func (s *Storage) ListMonitors() []*Monitor {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	monitors := make([]*Monitor, 0, len(s.monitors))
+	for _, monitor := range s.monitors {
+		monitors = append(monitors, monitor.snapshot())
+	}
+
+	sort.Slice(monitors, func(i, j int) bool {
+		return monitors[i].ID < monitors[j].ID
+	})
+
+	return monitors
+}
+
+// DeleteMonitor removes a monitor. Batches it already created are kept.
+func (s *Storage) DeleteMonitor(id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.monitors[id]; !exists {
+		return fmt.Errorf("%w: %d", ErrMonitorNotFound, id)
+	}
+
+	delete(s.monitors, id)
+	if err := os.Remove(s.monitorFilePath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Storage) loadMonitors() error {
+	dir := filepath.Join(s.dataDir, monitorsDir)
+	if data, err := os.ReadFile(filepath.Join(dir, nextIDFile)); err == nil {
+		var nextID int64
+		if err := json.Unmarshal(data, &nextID); err == nil && nextID > s.nextMonitorID {
+			s.nextMonitorID = nextID
+		}
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" || file.Name() == nextIDFile {
+			continue
+		}
+
+		data, err := s.readFile(filepath.Join(dir, file.Name()))
+		if isKeyError(err) {
+			return fmt.Errorf("%s: %w", file.Name(), err)
+		}
+		if err != nil {
+			continue
+		}
+
+		var monitor Monitor
+		if err := json.Unmarshal(data, &monitor); err != nil {
+			continue
+		}
+		monitor.Tenant = tenantOrDefault(monitor.Tenant)
+
+		s.monitors[monitor.ID] = &monitor
+		if monitor.ID >= s.nextMonitorID {
+			s.nextMonitorID = monitor.ID + 1
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) monitorFilePath(id int64) string {
+	return filepath.Join(s.dataDir, monitorsDir, fmt.Sprintf("monitor_%d.json", id))
+}
+
+func (s *Storage) persistMonitor(monitor *Monitor) error {
+	if err := os.MkdirAll(filepath.Join(s.dataDir, monitorsDir), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(monitor, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return s.writeFile(s.monitorFilePath(monitor.ID), data)
+}
+
+// persistNextMonitorID keeps IDs of deleted monitors from being reused.
+func (s *Storage) persistNextMonitorID() error {
+	data, err := json.Marshal(s.nextMonitorID)
+	if err != nil {
+		return err
+	}
+
+	return s.writePlain(filepath.Join(s.dataDir, monitorsDir, nextIDFile), data)
+}
@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+)
+
+const summariesDir = "summaries"
+
+// RetentionPolicy describes which finished batches the janitor may purge.
+// Zero values disable the corresponding limit.
+type RetentionPolicy struct {
+	MaxAge       time.Duration `json:"max_age"`
+	MaxBatches   int           `json:"max_batches"`
+	MaxDiskBytes int64         `json:"max_disk_bytes"`
+	// KeepLastPerTag protects the newest N batches of every tag from purging,
+	// even when another limit would remove them.
+	KeepLastPerTag int `json:"keep_last_per_tag"`
+	// Downsample folds purged batches into daily summaries instead of
+	// dropping their results entirely.
+	Downsample bool `json:"downsample"`
+}
+
+// Enabled reports whether the policy limits anything at all.
+func (p RetentionPolicy) Enabled() bool {
+	return p.MaxAge > 0 || p.MaxBatches > 0 || p.MaxDiskBytes > 0
+}
+
+type PurgedBatch struct {
+	BatchID   int64  `json:"-"`
+	PublicID  string `json:"batch_id"`
+	CreatedAt string `json:"created_at"`
+	Reason    string `json:"reason"`
+	Bytes     int64  `json:"bytes"`
+}
+
+type PurgeReport struct {
+	RanAt       string        `json:"ran_at"`
+	Purged      []PurgedBatch `json:"purged"`
+	FreedBytes  int64         `json:"freed_bytes"`
+	Downsampled int           `json:"downsampled"`
+	Errors      []string      `json:"errors,omitempty"`
+}
+
+// DailySummary keeps aggregated counts of batches purged for a single day.
+// BatchIDs are the public IDs of the batches.
+type DailySummary struct {
+	Date        string   `json:"date"`
+	Batches     int      `json:"batches"`
+	Links       int      `json:"links"`
+	Available   int      `json:"available"`
+	Unavailable int      `json:"unavailable"`
+	BatchIDs    []string `json:"batch_ids"`
+}
+
+// StartJanitor enforces the policy every interval until ctx is cancelled.
+func (s *Storage) StartJanitor(ctx context.Context, policy RetentionPolicy, interval time.Duration) {
+	if !policy.Enabled() || interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			s.runJanitor(policy)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (s *Storage) runJanitor(policy RetentionPolicy) {
+	report := s.Purge(policy, time.Now())
+
+	for _, p := range report.Purged {
+		slog.Info("Janitor purged batch", "batch_id", p.PublicID, "reason", p.Reason, "bytes", p.Bytes)
+	}
+	for _, e := range report.Errors {
+		slog.Error("Janitor error", "error", e)
+	}
+	if len(report.Purged) > 0 {
+		slog.Info("Janitor finished purge", "batches", len(report.Purged), "freed_bytes", report.FreedBytes)
+	}
+
+	if expired := s.PurgeExpiredIdempotencyKeys(time.Now()); expired > 0 {
+		slog.Info("Janitor removed expired idempotency keys", "keys", expired)
+	}
+}
+
+// LastPurge returns the report of the most recent janitor run, if any.
+func (s *Storage) LastPurge() *PurgeReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.lastPurge
+}
+
+// Purge applies the retention policy once and returns what was removed.
+// Pending and processing batches are never purged.
+func (s *Storage) Purge(policy RetentionPolicy, now time.Time) *PurgeReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := &PurgeReport{
+		RanAt:  now.Format(time.RFC3339),
+		Purged: make([]PurgedBatch, 0),
+	}
+
+	var finished []*LinkBatch
+	for _, batch := range s.batches {
+		if batch.Status != "pending" && batch.Status != "processing" {
+			finished = append(finished, batch)
+		}
+	}
+	// Oldest first by creation time: imported batches get new internal IDs
+	// that say nothing about their age.
+	sort.Slice(finished, func(i, j int) bool {
+		ti, tj := parseTimestamp(finished[i].CreatedAt), parseTimestamp(finished[j].CreatedAt)
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return finished[i].BatchID < finished[j].BatchID
+	})
+
+	protected := s.protectedByTag(finished, policy.KeepLastPerTag)
+	sizes := make(map[int64]int64, len(s.batches))
+	var totalBytes int64
+	for id := range s.batches {
+		if info, err := os.Stat(s.batchFilePath(id)); err == nil {
+			sizes[id] = info.Size()
+			totalBytes += info.Size()
+		}
+	}
+
+	remaining := len(s.batches)
+	reasons := make(map[int64]string)
+	for _, batch := range finished {
+		if protected[batch.BatchID] {
+			continue
+		}
+
+		switch {
+		case policy.MaxAge > 0 && isOlderThan(batch.CreatedAt, now.Add(-policy.MaxAge)):
+			reasons[batch.BatchID] = "max_age"
+		case policy.MaxBatches > 0 && remaining > policy.MaxBatches:
+			reasons[batch.BatchID] = "max_batches"
+		case policy.MaxDiskBytes > 0 && totalBytes > policy.MaxDiskBytes:
+			reasons[batch.BatchID] = "max_disk"
+		default:
+			continue
+		}
+
+		remaining--
+		totalBytes -= sizes[batch.BatchID]
+	}
+
+	summaries := make(map[string]*DailySummary)
+	for _, batch := range finished {
+		reason, ok := reasons[batch.BatchID]
+		if !ok {
+			continue
+		}
+
+		if err := s.deleteBatchLocked(batch.BatchID); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("batch %s: %v", batch.PublicID, err))
+			continue
+		}
+
+		// Only batches that are really gone are summarized, so a batch that
+		// failed to delete is not counted again on the next run.
+		if policy.Downsample {
+			addToSummary(summaries, batch)
+			report.Downsampled++
+		}
+
+		report.Purged = append(report.Purged, PurgedBatch{
+			BatchID:   batch.BatchID,
+			PublicID:  batch.PublicID,
+			CreatedAt: batch.CreatedAt,
+			Reason:    reason,
+			Bytes:     sizes[batch.BatchID],
+		})
+		report.FreedBytes += sizes[batch.BatchID]
+	}
+
+	for _, summary := range summaries {
+		if err := s.mergeSummary(summary); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("summary %s: %v", summary.Date, err))
+		}
+	}
+
+	s.lastPurge = report
+	return report
+}
+
+// DailySummaries returns all downsampled summaries ordered by date.
+func (s *Storage) DailySummaries() ([]DailySummary, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	files, err := os.ReadDir(filepath.Join(s.dataDir, summariesDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []DailySummary{}, nil
+		}
+		return nil, err
+	}
+
+	summaries := make([]DailySummary, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.dataDir, summariesDir, file.Name()))
+		if err != nil {
+			continue
+		}
+
+		summary, err := decodeSummary(data)
+		if err != nil {
+			continue
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Date < summaries[j].Date
+	})
+
+	return summaries, nil
+}
+
+func (s *Storage) protectedByTag(batches []*LinkBatch, keep int) map[int64]bool {
+	protected := make(map[int64]bool)
+	if keep <= 0 {
+		return protected
+	}
+
+	seen := make(map[string]int)
+	for i := len(batches) - 1; i >= 0; i-- {
+		for _, tag := range batches[i].Tags {
+			if seen[tag] < keep {
+				seen[tag]++
+				protected[batches[i].BatchID] = true
+			}
+		}
+	}
+
+	return protected
+}
+
+func (s *Storage) mergeSummary(summary *DailySummary) error {
+	dir := filepath.Join(s.dataDir, summariesDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	filePath := filepath.Join(dir, summary.Date+".json")
+	if data, err := os.ReadFile(filePath); err == nil {
+		if existing, err := decodeSummary(data); err == nil {
+			summary.Batches += existing.Batches
+			summary.Links += existing.Links
+			summary.Available += existing.Available
+			summary.Unavailable += existing.Unavailable
+			summary.BatchIDs = append(existing.BatchIDs, summary.BatchIDs...)
+		}
+	}
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return s.writePlain(filePath, data)
+}
+
+// decodeSummary parses a summary file. Files from before summaries listed
+// public IDs keep their counts but lose their internal batch IDs.
+func decodeSummary(data []byte) (DailySummary, error) {
+	var summary DailySummary
+	err := ignoreLegacyBatchIDs(json.Unmarshal(data, &summary))
+	// Internal IDs decode as empty strings.
+	summary.BatchIDs = slices.DeleteFunc(summary.BatchIDs, func(id string) bool { return id == "" })
+	if summary.BatchIDs == nil {
+		summary.BatchIDs = []string{}
+	}
+	return summary, err
+}
+
+func addToSummary(summaries map[string]*DailySummary, batch *LinkBatch) {
+	date := "unknown"
+	if created, err := time.Parse(time.RFC3339, batch.CreatedAt); err == nil {
+		date = created.Format("2006-01-02")
+	}
+
+	summary, ok := summaries[date]
+	if !ok {
+		summary = &DailySummary{Date: date, BatchIDs: make([]string, 0)}
+		summaries[date] = summary
+	}
+
+	summary.Batches++
+	summary.Links += len(batch.URLs)
+	summary.BatchIDs = append(summary.BatchIDs, batch.PublicID)
+	for _, result := range batch.Results {
+		if result.Available {
+			summary.Available++
+		} else {
+			summary.Unavailable++
+		}
+	}
+}
+
+func isOlderThan(createdAt string, cutoff time.Time) bool {
+	created, err := time.Parse(time.RFC3339, createdAt)
+	if err != nil {
+		return false
+	}
+	return created.Before(cutoff)
+}
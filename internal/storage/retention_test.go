@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+// retentionBatch describes a batch of the retention tests by its age.
+type retentionBatch struct {
+	days   int
+	tags   []string
+	status string
+}
+
+// Batches are saved out of age order, as imports leave them, so a purge
+// that went by internal ID would pick the wrong ones.
+var retentionBatches = []retentionBatch{
+	{days: 1, tags: []string{"nightly"}, status: "completed"},
+	{days: 30, tags: []string{"weekly"}, status: "completed"},
+	{days: 5, tags: []string{"nightly"}, status: "completed"},
+	{days: 40, status: "processing"},
+	{days: 20, tags: []string{"nightly"}, status: "failed"},
+}
+
+func TestPurge(t *testing.T) {
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		policy func(totalBytes int64) RetentionPolicy
+		want   []int
+		reason string
+	}{
+		{"max age", func(int64) RetentionPolicy { return RetentionPolicy{MaxAge: 10 * 24 * time.Hour} }, []int{30, 20}, "max_age"},
+		{"max batches", func(int64) RetentionPolicy { return RetentionPolicy{MaxBatches: 3} }, []int{30, 20}, "max_batches"},
+		{"max disk", func(total int64) RetentionPolicy { return RetentionPolicy{MaxDiskBytes: total - 1} }, []int{30}, "max_disk"},
+		{"keep last per tag", func(int64) RetentionPolicy {
+			return RetentionPolicy{MaxAge: 10 * 24 * time.Hour, KeepLastPerTag: 1}
+		}, []int{20}, "max_age"},
+		{"keep last per tag over the count", func(int64) RetentionPolicy {
+			return RetentionPolicy{MaxBatches: 1, KeepLastPerTag: 2}
+		}, []int{20}, "max_batches"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, days := newRetentionStorage(t, now)
+			var total int64
+			for id := range s.batches {
+				info, err := os.Stat(s.batchFilePath(id))
+				if err != nil {
+					t.Fatal(err)
+				}
+				total += info.Size()
+			}
+
+			report := s.Purge(tt.policy(total), now)
+			if len(report.Errors) > 0 {
+				t.Fatalf("purge errors: %v", report.Errors)
+			}
+			got := []int{}
+			var freed int64
+			for _, p := range report.Purged {
+				got = append(got, days[p.BatchID])
+				freed += p.Bytes
+				if p.Reason != tt.reason {
+					t.Errorf("batch of day %d purged for %s, want %s", days[p.BatchID], p.Reason, tt.reason)
+				}
+				if _, err := s.GetBatch(p.BatchID); err == nil {
+					t.Errorf("purged batch of day %d is still stored", days[p.BatchID])
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("purged batches of days %v, want %v", got, tt.want)
+			}
+			if report.FreedBytes != freed || report.Downsampled != 0 {
+				t.Errorf("report = %+v, want %d freed bytes and nothing downsampled", report, freed)
+			}
+			if s.LastPurge() != report {
+				t.Error("LastPurge does not return the report")
+			}
+		})
+	}
+}
+
+func TestPurgeDownsample(t *testing.T) {
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	s, days := newRetentionStorage(t, now)
+	policy := RetentionPolicy{MaxAge: 10 * 24 * time.Hour, Downsample: true}
+
+	report := s.Purge(policy, now)
+	if report.Downsampled != 2 {
+		t.Fatalf("downsampled %d batches, want 2", report.Downsampled)
+	}
+	publicIDs := make(map[int]string)
+	for _, p := range report.Purged {
+		publicIDs[days[p.BatchID]] = p.PublicID
+	}
+
+	summaries, err := s.DailySummaries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DailySummary{
+		{Date: "2026-01-30", Batches: 1, Links: 2, Available: 1, Unavailable: 1, BatchIDs: []string{publicIDs[30]}},
+		{Date: "2026-02-09", Batches: 1, Links: 2, Available: 1, Unavailable: 1, BatchIDs: []string{publicIDs[20]}},
+	}
+	if len(summaries) != len(want) {
+		t.Fatalf("summaries = %+v, want %+v", summaries, want)
+	}
+	for i := range want {
+		if summaries[i].Date != want[i].Date || summaries[i].Batches != want[i].Batches ||
+			summaries[i].Links != want[i].Links || summaries[i].Available != want[i].Available ||
+			summaries[i].Unavailable != want[i].Unavailable || !slices.Equal(summaries[i].BatchIDs, want[i].BatchIDs) {
+			t.Errorf("summary %d = %+v, want %+v", i, summaries[i], want[i])
+		}
+	}
+
+	// A later purge of the same day adds to its summary.
+	id, err := s.SaveBatch([]string{"https://a.example"}, BatchMetadata{}, nil, 0, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.UpdateBatch(id, nil, "completed")
+	s.batches[id].CreatedAt = now.AddDate(0, 0, -30).Format(time.RFC3339)
+	s.Purge(policy, now)
+
+	summaries, err = s.DailySummaries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summaries[0].Batches != 2 || summaries[0].Links != 3 || len(summaries[0].BatchIDs) != 2 {
+		t.Errorf("merged summary = %+v, want two batches with three links", summaries[0])
+	}
+}
+
+// newRetentionStorage saves retentionBatches and returns the age in days of
+// each batch by its internal ID.
+func newRetentionStorage(t *testing.T, now time.Time) (*Storage, map[int64]int) {
+	t.Helper()
+	s := newTestStorage(t, Options{})
+	days := make(map[int64]int)
+	for _, b := range retentionBatches {
+		urls := []string{"https://a.example", "https://b.example"}
+		id, err := s.SaveBatch(urls, BatchMetadata{Tags: b.tags}, nil, 0, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := []LinkResult{{URL: urls[0], Available: true}, {URL: urls[1]}}
+		if err := s.UpdateBatch(id, results, b.status); err != nil {
+			t.Fatal(err)
+		}
+		s.batches[id].CreatedAt = now.AddDate(0, 0, -b.days).Format(time.RFC3339)
+		days[id] = b.days
+	}
+	return s, days
+}
+
+func TestDecodeSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantIDs []string
+	}{
+		{"public IDs", `{"date": "2026-01-01", "batches": 2, "batch_ids": ["01A", "01B"]}`, []string{"01A", "01B"}},
+		{"internal IDs from older versions", `{"date": "2026-01-01", "batches": 2, "batch_ids": [1, 2]}`, []string{}},
+		{"no IDs", `{"date": "2026-01-01", "batches": 2}`, []string{}},
+	}
+
+	for _, tt := range tests {
+		summary, err := decodeSummary([]byte(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if summary.Batches != 2 || !slices.Equal(summary.BatchIDs, tt.wantIDs) {
+			t.Errorf("%s: summary = %+v, want 2 batches and IDs %v", tt.name, summary, tt.wantIDs)
+		}
+	}
+
+	if _, err := decodeSummary([]byte(`{"batches": "two"}`)); err == nil {
+		t.Error("a summary with a bad count was accepted")
+	}
+}
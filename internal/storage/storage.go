@@ -3,7 +3,10 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
 	"os"
 	"path/filepath"
 	"sync"
@@ -17,64 +20,273 @@ type LinkResult struct {
 	Available bool   `json:"available"`
 	CheckedAt string `json:"checked_at"`
 	Error     string `json:"error,omitempty"`
+	// ResponseTimeMs is zero for failed checks and results stored before
+	// response times were recorded.
+	ResponseTimeMs int64 `json:"response_time_ms,omitempty"`
+	// Sources are the places the URL was found, for batches built from
+	// documents.
+	Sources []LinkSource `json:"sources,omitempty"`
 }
 
+// LinkSource is the file and line a link was found at.
+type LinkSource struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// BatchMetadata describes who submitted a batch and why.
+type BatchMetadata struct {
+	Name   string            `json:"name,omitempty"`
+	Tags   []string          `json:"tags,omitempty"`
+	Owner  string            `json:"owner,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// APIKeyID is the key that submitted the batch or defined the monitor,
+	// and Tenant the tenant of that key. The server sets both from the
+	// request credentials.
+	APIKeyID int64  `json:"api_key_id,omitempty"`
+	Tenant   string `json:"tenant,omitempty"`
+}
+
+// LinkBatch is one submitted set of URLs and its results. BatchID is
+// sequential and only used inside the server; PublicID is the ULID that
+// identifies the batch in the API.
 type LinkBatch struct {
-	BatchID   int64        `json:"batch_id"`
-	URLs      []string     `json:"urls"`
-	Results   []LinkResult `json:"results"`
-	CreatedAt string       `json:"created_at"`
-	Status    string       `json:"status"`
-	Error     string       `json:"error,omitempty"`
+	SchemaVersion int          `json:"schema_version"`
+	BatchID       int64        `json:"batch_id"`
+	PublicID      string       `json:"public_id"`
+	URLs          []string     `json:"urls"`
+	Results       []LinkResult `json:"results"`
+	CreatedAt     string       `json:"created_at"`
+	StartedAt     string       `json:"started_at,omitempty"`
+	FinishedAt    string       `json:"finished_at,omitempty"`
+	Status        string       `json:"status"`
+	Error         string       `json:"error,omitempty"`
+	// Priority orders pending batches in the queue; higher runs first.
+	Priority int `json:"priority,omitempty"`
+	BatchMetadata
+	Notify *NotifySettings `json:"notify,omitempty"`
+	// Sources maps URLs that have no result yet to where they were found.
+	// Each result takes the sources of its URL over when it is stored.
+	Sources map[string][]LinkSource `json:"sources,omitempty"`
+}
+
+// snapshot copies the batch together with its result slice.
+func (b *LinkBatch) snapshot() *LinkBatch {
+	c := *b
+	c.Results = append([]LinkResult(nil), b.Results...)
+	c.Sources = maps.Clone(b.Sources)
+	if b.Notify != nil {
+		notify := *b.Notify
+		c.Notify = &notify
+	}
+	return &c
+}
+
+// Progress describes how far a batch has been checked.
+type Progress struct {
+	Done       int     `json:"done"`
+	Total      int     `json:"total"`
+	Percent    float64 `json:"percent"`
+	ETASeconds float64 `json:"eta_seconds,omitempty"`
+}
+
+// Progress estimates the remaining time from the average pace so far.
+func (b *LinkBatch) Progress(now time.Time) Progress {
+	var elapsed time.Duration
+	if b.Status == "processing" && b.StartedAt != "" {
+		elapsed = now.Sub(parseTimestamp(b.StartedAt))
+	}
+	return NewProgress(len(b.Results), len(b.URLs), elapsed)
+}
+
+// NewProgress builds a progress report. A zero elapsed time leaves the ETA out.
+func NewProgress(done, total int, elapsed time.Duration) Progress {
+	p := Progress{Done: done, Total: total}
+	if total == 0 {
+		return p
+	}
+	p.Percent = float64(done) * 100 / float64(total)
+
+	if elapsed > 0 && done > 0 && done < total {
+		p.ETASeconds = (elapsed.Seconds() / float64(done)) * float64(total-done)
+	}
+
+	return p
+}
+
+// PendingURLs returns the URLs that do not have a result yet, keeping
+// duplicates that were submitted more than once.
+func (b *LinkBatch) PendingURLs() []string {
+	checked := make(map[string]int, len(b.Results))
+	for _, result := range b.Results {
+		checked[result.URL]++
+	}
+
+	pending := make([]string, 0)
+	for _, u := range b.URLs {
+		if checked[u] > 0 {
+			checked[u]--
+			continue
+		}
+		pending = append(pending, u)
+	}
+	return pending
 }
 
+// OrderedResults returns the results sorted in the order their URLs were
+// submitted; results arrive in completion order while a batch runs.
+func (b *LinkBatch) OrderedResults() []LinkResult {
+	byURL := make(map[string][]LinkResult, len(b.Results))
+	for _, result := range b.Results {
+		byURL[result.URL] = append(byURL[result.URL], result)
+	}
+
+	ordered := make([]LinkResult, 0, len(b.Results))
+	for _, u := range b.URLs {
+		if results := byURL[u]; len(results) > 0 {
+			ordered = append(ordered, results[0])
+			byURL[u] = results[1:]
+		}
+	}
+	return ordered
+}
+
+// Options tunes how a Storage loads and persists its data.
+type Options struct {
+	// RewriteMigrated writes batches upgraded from an older schema version
+	// back to disk, so migrations run only once.
+	RewriteMigrated bool
+	// EncryptionKey enables AES-GCM envelope encryption of batch files.
+	// It must be 32 bytes long; nil keeps files in plaintext.
+	EncryptionKey []byte
+	// DefaultQuota applies to tenants without a quota of their own.
+	DefaultQuota TenantQuota
+}
+
+// resultFlushInterval bounds how often AppendResult rewrites a batch file.
+const resultFlushInterval = time.Second
+
 type Storage struct {
-	dataDir string
-	mu      sync.RWMutex
-	batches map[int64]*LinkBatch
-	nextID  int64
+	dataDir     string
+	opts        Options
+	key         []byte
+	mu          sync.RWMutex
+	batches     map[int64]*LinkBatch
+	publicIDs   map[string]int64
+	nextID      int64
+	lastPurge   *PurgeReport
+	lastFlushed map[int64]time.Time
+
+	monitors      map[int64]*Monitor
+	nextMonitorID int64
+
+	apiKeys       map[int64]*APIKey
+	apiKeysByHash map[string]*APIKey
+	nextAPIKeyID  int64
+
+	tenants map[string]*Tenant
+
+	idempotency idempotencyKeys
 }
 
 func NewStorage(dataDir string) (*Storage, error) {
+	return NewStorageWithOptions(dataDir, Options{})
+}
+
+func NewStorageWithOptions(dataDir string, opts Options) (*Storage, error) {
+	if opts.EncryptionKey != nil && len(opts.EncryptionKey) != encryptionKeySize {
+		return nil, ErrInvalidEncryptionKey
+	}
+
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create data directory: %w", err)
 	}
 
 	s := &Storage{
-		dataDir: dataDir,
-		batches: make(map[int64]*LinkBatch),
-		nextID:  1,
+		dataDir:     dataDir,
+		opts:        opts,
+		key:         opts.EncryptionKey,
+		batches:     make(map[int64]*LinkBatch),
+		publicIDs:   make(map[string]int64),
+		nextID:      1,
+		lastFlushed: make(map[int64]time.Time),
+
+		monitors:      make(map[int64]*Monitor),
+		nextMonitorID: 1,
+
+		apiKeys:       make(map[int64]*APIKey),
+		apiKeysByHash: make(map[string]*APIKey),
+		nextAPIKeyID:  1,
+
+		tenants: make(map[string]*Tenant),
+
+		idempotency: idempotencyKeys{records: make(map[string]*IdempotencyRecord), inFlight: make(map[string]chan struct{})},
 	}
 
 	if err := s.loadBatches(); err != nil {
 		return nil, fmt.Errorf("failed to load batches: %w", err)
 	}
 
+	if err := s.loadMonitors(); err != nil {
+		return nil, fmt.Errorf("failed to load monitors: %w", err)
+	}
+
+	if err := s.loadAPIKeys(); err != nil {
+		return nil, fmt.Errorf("failed to load API keys: %w", err)
+	}
+
+	if err := s.loadTenants(); err != nil {
+		return nil, fmt.Errorf("failed to load tenants: %w", err)
+	}
+
+	if err := s.loadIdempotencyKeys(); err != nil {
+		return nil, fmt.Errorf("failed to load idempotency keys: %w", err)
+	}
+
 	return s, nil
 }
 
-func (s *Storage) SaveBatch(urls []string) int64 {
+// SaveBatch creates a pending batch for the tenant in meta. checked holds
+// results of some of urls that are known without a request, such as the
+// relative links of documents; only the other URLs are checked. It fails
+// with ErrTooManyURLs or ErrDailyQuotaExceeded when the tenant's quota does
+// not allow another batch.
+func (s *Storage) SaveBatch(urls []string, meta BatchMetadata, notify *NotifySettings, priority int, sources map[string][]LinkSource, checked []LinkResult) (int64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	now := time.Now()
+	meta.Tenant = tenantOrDefault(meta.Tenant)
+	if err := s.checkQuotaLocked(meta.Tenant, len(urls), now); err != nil {
+		return 0, err
+	}
+
 	batch := &LinkBatch{
-		BatchID:   s.nextID,
-		URLs:      urls,
-		CreatedAt: time.Now().Format(time.RFC3339),
-		Status:    "pending",
-		Results:   make([]LinkResult, 0),
+		BatchID:       s.nextID,
+		PublicID:      newULID(now),
+		URLs:          urls,
+		CreatedAt:     now.Format(time.RFC3339),
+		Status:        "pending",
+		Results:       append(make([]LinkResult, 0, len(checked)), checked...),
+		Priority:      priority,
+		BatchMetadata: meta,
+		Notify:        notify,
+		Sources:       sources,
 	}
 
 	s.batches[s.nextID] = batch
+	s.indexBatchLocked(batch)
 	batchID := s.nextID
 	s.nextID++
 
 	s.persistBatch(batch)
 	s.persistNextID()
 
-	return batchID
+	return batchID, nil
 }
 
+// GetBatch returns a snapshot of the batch that is safe to read while the
+// batch is still being processed.
 func (s *Storage) GetBatch(batchID int64) (*LinkBatch, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -84,7 +296,34 @@ func (s *Storage) GetBatch(batchID int64) (*LinkBatch, error) {
 		return nil, fmt.Errorf("batch %d not found", batchID)
 	}
 
-	return batch, nil
+	return batch.snapshot(), nil
+}
+
+// AppendResult records the result of one more URL of a running batch,
+// moving the sources of the URL to the result. The batch file is
+// rewritten at most once per resultFlushInterval; UpdateBatch always
+// persists.
+func (s *Storage) AppendResult(batchID int64, result LinkResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch, exists := s.batches[batchID]
+	if !exists {
+		return fmt.Errorf("batch %d not found", batchID)
+	}
+
+	if sources, ok := batch.Sources[result.URL]; ok && result.Sources == nil {
+		result.Sources = sources
+		delete(batch.Sources, result.URL)
+	}
+	batch.Results = append(batch.Results, result)
+
+	if time.Since(s.lastFlushed[batchID]) < resultFlushInterval {
+		return nil
+	}
+	s.lastFlushed[batchID] = time.Now()
+
+	return s.persistBatch(batch)
 }
 
 func (s *Storage) UpdateBatch(batchID int64, results []LinkResult, status string) error {
@@ -99,23 +338,45 @@ func (s *Storage) UpdateBatch(batchID int64, results []LinkResult, status string
 	batch.Results = results
 	batch.Status = status
 
+	now := time.Now().Format(time.RFC3339)
+	if status == "processing" && batch.StartedAt == "" {
+		batch.StartedAt = now
+	}
+	if status != "pending" && status != "processing" {
+		batch.FinishedAt = now
+	}
+
 	s.persistBatch(batch)
+	s.lastFlushed[batchID] = time.Now()
 
 	return nil
 }
 
-func (s *Storage) GetBatches(batchIDs []int64) ([]*LinkBatch, error) {
+func (s *Storage) DeleteBatch(batchID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.batches[batchID]; !exists {
+		return fmt.Errorf("batch %d not found", batchID)
+	}
+
+	return s.deleteBatchLocked(batchID)
+}
+
+// GetBatches returns the batches of tenant with the given public IDs.
+// Unknown IDs and batches of other tenants are skipped.
+func (s *Storage) GetBatches(tenant string, publicIDs []string) []*LinkBatch {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	var batches []*LinkBatch
-	for _, id := range batchIDs {
-		if batch, exists := s.batches[id]; exists {
-			batches = append(batches, batch)
+	for _, publicID := range publicIDs {
+		if batch, exists := s.batchByPublicIDLocked(publicID); exists && batch.Tenant == tenant {
+			batches = append(batches, batch.snapshot())
 		}
 	}
 
-	return batches, nil
+	return batches
 }
 
 func (s *Storage) ListPendingBatches() []*LinkBatch {
@@ -132,6 +393,19 @@ func (s *Storage) ListPendingBatches() []*LinkBatch {
 	return pending
 }
 
+// CountBatchesByStatus returns how many stored batches have each status.
+func (s *Storage) CountBatchesByStatus() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, batch := range s.batches {
+		counts[batch.Status]++
+	}
+
+	return counts
+}
+
 func (s *Storage) ListAllBatches() []*LinkBatch {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -164,30 +438,70 @@ func (s *Storage) loadBatches() error {
 		}
 
 		filePath := filepath.Join(s.dataDir, file.Name())
-		data, err := os.ReadFile(filePath)
+		data, err := s.readFile(filePath)
+		if isKeyError(err) {
+			return fmt.Errorf("%s: %w", file.Name(), err)
+		}
 		if err != nil {
 			continue
 		}
 
-		var batch LinkBatch
-		if err := json.Unmarshal(data, &batch); err != nil {
+		batch, migrated, err := decodeBatch(data)
+		if errors.Is(err, ErrUnknownSchemaVersion) {
+			return fmt.Errorf("%s: %w", file.Name(), err)
+		}
+		if err != nil {
 			continue
 		}
 
-		s.batches[batch.BatchID] = &batch
+		publicID := batch.PublicID
+		s.batches[batch.BatchID] = batch
+		s.indexBatchLocked(batch)
+
+		// A newly assigned public ID is stored even without RewriteMigrated:
+		// clients keep it, so it must survive a restart.
+		if batch.PublicID != publicID {
+			if err := s.persistBatch(batch); err != nil {
+				return fmt.Errorf("failed to store the public ID of %s: %w", file.Name(), err)
+			}
+		} else if migrated && s.opts.RewriteMigrated {
+			if err := s.persistBatch(batch); err != nil {
+				return fmt.Errorf("failed to rewrite migrated %s: %w", file.Name(), err)
+			}
+		}
 	}
 
 	return nil
 }
 
+func (s *Storage) batchFilePath(batchID int64) string {
+	return filepath.Join(s.dataDir, fmt.Sprintf("batch_%d.json", batchID))
+}
+
 func (s *Storage) persistBatch(batch *LinkBatch) error {
-	filePath := filepath.Join(s.dataDir, fmt.Sprintf("batch_%d.json", batch.BatchID))
+	filePath := s.batchFilePath(batch.BatchID)
+	batch.SchemaVersion = CurrentSchemaVersion
 	data, err := json.MarshalIndent(batch, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(filePath, data, 0644)
+	return s.writeFile(filePath, data)
+}
+
+func (s *Storage) deleteBatchLocked(batchID int64) error {
+	// The file goes first: if it cannot be removed, the batch stays in
+	// memory too and the next attempt sees the same state.
+	if err := os.Remove(s.batchFilePath(batchID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if batch, exists := s.batches[batchID]; exists {
+		delete(s.publicIDs, batch.PublicID)
+	}
+	delete(s.batches, batchID)
+	delete(s.lastFlushed, batchID)
+	return nil
 }
 
 func (s *Storage) persistNextID() error {
@@ -197,9 +511,11 @@ func (s *Storage) persistNextID() error {
 		return err
 	}
 
-	return os.WriteFile(filePath, data, 0644)
+	return s.writePlain(filePath, data)
 }
 
+// WaitForCompletion waits for batches being checked to finish. Queued
+// batches stay pending on disk and are picked up again on restart.
 func (s *Storage) WaitForCompletion(ctx context.Context) {
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
@@ -210,21 +526,21 @@ func (s *Storage) WaitForCompletion(ctx context.Context) {
 			s.mu.RLock()
 			pendingCount := 0
 			for _, batch := range s.batches {
-				if batch.Status == "pending" || batch.Status == "processing" {
+				if batch.Status == "processing" {
 					pendingCount++
 				}
 			}
 			s.mu.RUnlock()
 
 			if pendingCount > 0 {
-				fmt.Printf("Timeout: %d batches still processing\n", pendingCount)
+				slog.Warn("Timed out waiting for running batches", "processing", pendingCount)
 			}
 			return
 		case <-ticker.C:
 			s.mu.RLock()
 			allDone := true
 			for _, batch := range s.batches {
-				if batch.Status == "pending" || batch.Status == "processing" {
+				if batch.Status == "processing" {
 					allDone = false
 					break
 				}
@@ -232,7 +548,7 @@ func (s *Storage) WaitForCompletion(ctx context.Context) {
 			s.mu.RUnlock()
 
 			if allDone {
-				fmt.Println("All pending batches completed")
+				slog.Info("All running batches completed")
 				return
 			}
 		}
@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+const tenantsDir = "tenants"
+
+// DefaultTenant owns batches, monitors and keys created before tenants
+// existed, and keys created without one.
+const DefaultTenant = "default"
+
+// quotaWindow is the period MaxBatchesPerDay is counted over.
+const quotaWindow = 24 * time.Hour
+
+var (
+	ErrInvalidTenant      = errors.New("tenant must be 1-63 lowercase letters, digits, '-' or '_'")
+	ErrInvalidQuota       = errors.New("quota limits must not be negative")
+	ErrTooManyURLs        = errors.New("too many URLs in one batch")
+	ErrDailyQuotaExceeded = errors.New("daily batch quota exceeded")
+)
+
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ValidTenant reports whether name can be used as a tenant name. Names end
+// up in file names, so the alphabet is restricted.
+func ValidTenant(name string) bool {
+	return tenantNamePattern.MatchString(name)
+}
+
+// TenantQuota limits what a tenant may submit. Zero means unlimited.
+type TenantQuota struct {
+	MaxURLsPerBatch  int `json:"max_urls_per_batch,omitempty"`
+	MaxBatchesPerDay int `json:"max_batches_per_day,omitempty"`
+}
+
+// Tenant is a stored quota override. Tenants without one use the default
+// quota from Options.
+type Tenant struct {
+	Name string `json:"name"`
+	TenantQuota
+	UpdatedAt string `json:"updated_at"`
+}
+
+// TenantUsage describes a tenant together with its effective quota.
+type TenantUsage struct {
+	Name  string      `json:"name"`
+	Quota TenantQuota `json:"quota"`
+	// Custom is set when the quota overrides the default.
+	Custom bool `json:"custom"`
+	// BatchesToday counts batches created in the last 24 hours.
+	BatchesToday int `json:"batches_today"`
+	Batches      int `json:"batches"`
+}
+
+func tenantOrDefault(name string) string {
+	if name == "" {
+		return DefaultTenant
+	}
+	return name
+}
+
+// SetTenantQuota stores a quota override for a tenant.
+func (s *Storage) SetTenantQuota(name string, quota TenantQuota) (*Tenant, error) {
+	if !ValidTenant(name) {
+		return nil, ErrInvalidTenant
+	}
+	if quota.MaxURLsPerBatch < 0 || quota.MaxBatchesPerDay < 0 {
+		return nil, ErrInvalidQuota
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenant := &Tenant{
+		Name:        name,
+		TenantQuota: quota,
+		UpdatedAt:   time.Now().Format(time.RFC3339),
+	}
+	if err := s.persistTenant(tenant); err != nil {
+		return nil, err
+	}
+	s.tenants[name] = tenant
+
+	copied := *tenant
+	return &copied, nil
+}
+
+// ListTenants returns every tenant that has a quota override, an API key or
+// a batch, ordered by name. A non-empty tenant limits the list to that one.
+func (s *Storage) ListTenants(tenant string) []TenantUsage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	usage := make(map[string]*TenantUsage)
+	get := func(name string) *TenantUsage {
+		u, ok := usage[name]
+		if !ok {
+			u = &TenantUsage{Name: name, Quota: s.quotaLocked(name)}
+			_, u.Custom = s.tenants[name]
+			usage[name] = u
+		}
+		return u
+	}
+
+	for name := range s.tenants {
+		get(name)
+	}
+	for _, key := range s.apiKeys {
+		get(key.Tenant)
+	}
+
+	since := time.Now().Add(-quotaWindow)
+	for _, batch := range s.batches {
+		u := get(batch.Tenant)
+		u.Batches++
+		if parseTimestamp(batch.CreatedAt).After(since) {
+			u.BatchesToday++
+		}
+	}
+
+	tenants := make([]TenantUsage, 0, len(usage))
+	for _, u := range usage {
+		if tenant == "" || u.Name == tenant {
+			tenants = append(tenants, *u)
+		}
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].Name < tenants[j].Name
+	})
+
+	return tenants
+}
+
+func (s *Storage) quotaLocked(tenant string) TenantQuota {
+	if override, ok := s.tenants[tenant]; ok {
+		return override.TenantQuota
+	}
+	return s.opts.DefaultQuota
+}
+
+// checkQuotaLocked reports whether tenant may create another batch of
+// urls URLs.
+func (s *Storage) checkQuotaLocked(tenant string, urls int, now time.Time) error {
+	quota := s.quotaLocked(tenant)
+
+	if quota.MaxURLsPerBatch > 0 && urls > quota.MaxURLsPerBatch {
+		return fmt.Errorf("%w: %d URLs, tenant %s allows %d", ErrTooManyURLs, urls, tenant, quota.MaxURLsPerBatch)
+	}
+
+	if quota.MaxBatchesPerDay > 0 {
+		since := now.Add(-quotaWindow)
+		count := 0
+		for _, batch := range s.batches {
+			if batch.Tenant == tenant && parseTimestamp(batch.CreatedAt).After(since) {
+				count++
+			}
+		}
+		if count >= quota.MaxBatchesPerDay {
+			return fmt.Errorf("%w: tenant %s allows %d batches per 24 hours", ErrDailyQuotaExceeded, tenant, quota.MaxBatchesPerDay)
+		}
+	}
+
+	return nil
+}
+
+// GetTenantBatch returns the batch with the given public ID if it belongs to
+// tenant. Batches of other tenants are reported as not found, so callers
+// cannot learn that they exist.
+func (s *Storage) GetTenantBatch(tenant, publicID string) (*LinkBatch, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	batch, ok := s.batchByPublicIDLocked(publicID)
+	if !ok || batch.Tenant != tenant {
+		return nil, fmt.Errorf("batch %s not found", publicID)
+	}
+
+	return batch.snapshot(), nil
+}
+
+// LookupBatchID returns the internal ID of the batch with the given public
+// ID, regardless of its tenant.
+func (s *Storage) LookupBatchID(publicID string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	batch, ok := s.batchByPublicIDLocked(publicID)
+	if !ok {
+		return 0, fmt.Errorf("batch %s not found", publicID)
+	}
+	return batch.BatchID, nil
+}
+
+func (s *Storage) batchByPublicIDLocked(publicID string) (*LinkBatch, bool) {
+	batchID, ok := s.publicIDs[publicID]
+	if !ok {
+		return nil, false
+	}
+	batch, ok := s.batches[batchID]
+	return batch, ok
+}
+
+// indexBatchLocked makes a batch reachable by its public ID, assigning one
+// if it has none yet.
+func (s *Storage) indexBatchLocked(batch *LinkBatch) {
+	if _, taken := s.publicIDs[batch.PublicID]; batch.PublicID == "" || taken {
+		batch.PublicID = newULID(parseTimestamp(batch.CreatedAt))
+	}
+	batch.Tenant = tenantOrDefault(batch.Tenant)
+	s.publicIDs[batch.PublicID] = batch.BatchID
+}
+
+func (s *Storage) loadTenants() error {
+	dir := filepath.Join(s.dataDir, tenantsDir)
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		data, err := s.readFile(filepath.Join(dir, file.Name()))
+		if isKeyError(err) {
+			return fmt.Errorf("%s: %w", file.Name(), err)
+		}
+		if err != nil {
+			continue
+		}
+
+		var tenant Tenant
+		if err := json.Unmarshal(data, &tenant); err != nil || !ValidTenant(tenant.Name) {
+			continue
+		}
+		s.tenants[tenant.Name] = &tenant
+	}
+
+	return nil
+}
+
+func (s *Storage) persistTenant(tenant *Tenant) error {
+	if err := os.MkdirAll(filepath.Join(s.dataDir, tenantsDir), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(tenant, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return s.writeFile(filepath.Join(s.dataDir, tenantsDir, "tenant_"+tenant.Name+".json"), data)
+}
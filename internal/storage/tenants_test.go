@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSaveBatchQuota(t *testing.T) {
+	urls := func(n int) []string {
+		list := make([]string, n)
+		for i := range list {
+			list[i] = "https://example.com/"
+		}
+		return list
+	}
+
+	tests := []struct {
+		name     string
+		defaults TenantQuota
+		override *TenantQuota
+		batches  []int
+		wantErr  error
+	}{
+		{name: "unlimited", batches: []int{100, 100, 100}},
+		{name: "too many URLs", defaults: TenantQuota{MaxURLsPerBatch: 2}, batches: []int{3}, wantErr: ErrTooManyURLs},
+		{name: "daily batches", defaults: TenantQuota{MaxBatchesPerDay: 2}, batches: []int{1, 1, 1}, wantErr: ErrDailyQuotaExceeded},
+		{name: "override raises the default", defaults: TenantQuota{MaxURLsPerBatch: 2}, override: &TenantQuota{MaxURLsPerBatch: 5}, batches: []int{5}},
+		{name: "override lowers the default", override: &TenantQuota{MaxBatchesPerDay: 1}, batches: []int{1, 1}, wantErr: ErrDailyQuotaExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStorage(t, Options{DefaultQuota: tt.defaults})
+			if tt.override != nil {
+				if _, err := s.SetTenantQuota("acme", *tt.override); err != nil {
+					t.Fatalf("SetTenantQuota: %v", err)
+				}
+			}
+			// Batches of another tenant never count against acme.
+			if _, err := s.SaveBatch(urls(1), BatchMetadata{Tenant: "other"}, nil, 0, nil, nil); err != nil {
+				t.Fatalf("SaveBatch for another tenant: %v", err)
+			}
+
+			var err error
+			for _, n := range tt.batches {
+				if _, err = s.SaveBatch(urls(n), BatchMetadata{Tenant: "acme"}, nil, 0, nil, nil); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetTenantQuotaErrors(t *testing.T) {
+	s := newTestStorage(t, Options{})
+
+	tests := []struct {
+		name    string
+		tenant  string
+		quota   TenantQuota
+		wantErr error
+	}{
+		{name: "upper case", tenant: "Acme", wantErr: ErrInvalidTenant},
+		{name: "path", tenant: "../acme", wantErr: ErrInvalidTenant},
+		{name: "empty", tenant: "", wantErr: ErrInvalidTenant},
+		{name: "negative", tenant: "acme", quota: TenantQuota{MaxURLsPerBatch: -1}, wantErr: ErrInvalidQuota},
+	}
+
+	for _, tt := range tests {
+		if _, err := s.SetTenantQuota(tt.tenant, tt.quota); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestTenantScoping(t *testing.T) {
+	s := newTestStorage(t, Options{})
+	acmeID, err := s.SaveBatch([]string{"https://a.example"}, BatchMetadata{Tenant: "acme"}, nil, 0, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SaveBatch([]string{"https://b.example"}, BatchMetadata{Tenant: "globex"}, nil, 0, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	acme, err := s.GetBatch(acmeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acmeKey, _, err := s.CreateAPIKey("acme admin", RoleAdmin, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	globexKey, _, err := s.CreateAPIKey("globex reader", RoleReader, "globex")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("batches", func(t *testing.T) {
+		if _, err := s.GetTenantBatch("acme", acme.PublicID); err != nil {
+			t.Errorf("own batch: %v", err)
+		}
+		if _, err := s.GetTenantBatch("globex", acme.PublicID); err == nil {
+			t.Error("another tenant's batch was returned")
+		}
+	})
+
+	t.Run("tenants", func(t *testing.T) {
+		if got := s.ListTenants("acme"); len(got) != 1 || got[0].Name != "acme" || got[0].Batches != 1 {
+			t.Errorf("ListTenants(acme) = %+v, want acme with one batch", got)
+		}
+		if got := s.ListTenants(""); len(got) != 2 {
+			t.Errorf("ListTenants() returned %d tenants, want 2", len(got))
+		}
+	})
+
+	t.Run("API keys", func(t *testing.T) {
+		if got := s.ListAPIKeys("acme"); len(got) != 1 || got[0].ID != acmeKey.ID {
+			t.Errorf("ListAPIKeys(acme) = %+v, want the acme key", got)
+		}
+		if got := s.ListAPIKeys(""); len(got) != 2 {
+			t.Errorf("ListAPIKeys() returned %d keys, want 2", len(got))
+		}
+		if _, err := s.GetAPIKey("acme", globexKey.ID); err == nil {
+			t.Error("GetAPIKey returned another tenant's key")
+		}
+		if _, err := s.RevokeAPIKey("acme", globexKey.ID); err == nil {
+			t.Error("RevokeAPIKey revoked another tenant's key")
+		}
+		if key, err := s.RevokeAPIKey("", globexKey.ID); err != nil || !key.Revoked() {
+			t.Errorf("RevokeAPIKey without tenant = %+v, %v, want the key revoked", key, err)
+		}
+	})
+
+	t.Run("export", func(t *testing.T) {
+		var buf bytes.Buffer
+		manifest, err := s.Export(&buf, ExportFilter{Tenant: "acme"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(manifest.BatchIDs) != 1 || manifest.BatchIDs[0] != acme.PublicID {
+			t.Errorf("exported batches %v, want [%s]", manifest.BatchIDs, acme.PublicID)
+		}
+	})
+}
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role, required string
+		want           bool
+	}{
+		{RoleReader, RoleReader, true},
+		{RoleReader, RoleSubmitter, false},
+		{RoleSubmitter, RoleReader, true},
+		{RoleAdmin, RoleSubmitter, true},
+		{RoleAdmin, RoleSuperadmin, false},
+		{RoleSuperadmin, RoleAdmin, true},
+		{"", RoleReader, false},
+		{"owner", "owner", false},
+	}
+
+	for _, tt := range tests {
+		if got := RoleAllows(tt.role, tt.required); got != tt.want {
+			t.Errorf("RoleAllows(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"crypto/rand"
+	"time"
+)
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID returns a ULID for t: 48 bits of milliseconds followed by 80
+// random bits, as 26 base32 characters. ULIDs sort by creation time but
+// cannot be guessed, which makes them safe as public batch IDs.
+func newULID(t time.Time) string {
+	var id [16]byte
+	ms := uint64(t.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		id[i] = byte(ms)
+		ms >>= 8
+	}
+	rand.Read(id[6:])
+
+	// 128 bits are encoded as 26 characters of 5 bits, the first holding
+	// only the top 3 bits.
+	var out [26]byte
+	var acc uint64
+	bits := 2
+	pos := 0
+	for _, b := range id {
+		acc = acc<<8 | uint64(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[pos] = crockford[(acc>>bits)&31]
+			pos++
+		}
+	}
+
+	return string(out[:])
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const deliveriesDir = "webhooks"
+
+// NotifySettings holds the webhook targets of a single batch.
+type NotifySettings struct {
+	URLs []string `json:"urls,omitempty"`
+	// FailureThreshold is the share of unavailable links (0..1) that
+	// triggers a notification while the batch is still running.
+	FailureThreshold float64 `json:"failure_threshold,omitempty"`
+	ThresholdFired   bool    `json:"threshold_fired,omitempty"`
+}
+
+type DeliveryAttempt struct {
+	At         string `json:"at"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WebhookDelivery is the persisted log entry of one webhook notification.
+type WebhookDelivery struct {
+	ID            string            `json:"id"`
+	BatchID       int64             `json:"batch_id"`
+	Tenant        string            `json:"tenant,omitempty"`
+	Event         string            `json:"event"`
+	URL           string            `json:"url"`
+	Payload       json.RawMessage   `json:"payload"`
+	Status        string            `json:"status"`
+	Attempts      []DeliveryAttempt `json:"attempts"`
+	CreatedAt     string            `json:"created_at"`
+	NextAttemptAt string            `json:"next_attempt_at,omitempty"`
+	ReplayOf      string            `json:"replay_of,omitempty"`
+}
+
+// MarkThresholdFired records that the failure threshold notification of a
+// batch was sent. It reports false if it had already been recorded.
+func (s *Storage) MarkThresholdFired(batchID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch, exists := s.batches[batchID]
+	if !exists {
+		return false, fmt.Errorf("batch %d not found", batchID)
+	}
+	if batch.Notify == nil {
+		batch.Notify = &NotifySettings{}
+	}
+	if batch.Notify.ThresholdFired {
+		return false, nil
+	}
+
+	batch.Notify.ThresholdFired = true
+	return true, s.persistBatch(batch)
+}
+
+func (s *Storage) SaveDelivery(delivery *WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Join(s.dataDir, deliveriesDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// Compact encoding keeps the payload byte-for-byte identical on replay.
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	return s.writeFile(s.deliveryFilePath(delivery.ID), data)
+}
+
+func (s *Storage) GetDelivery(id string) (*WebhookDelivery, error) {
+	if strings.ContainsAny(id, `/\.`) {
+		return nil, fmt.Errorf("delivery %s not found", id)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := s.readFile(s.deliveryFilePath(id))
+	if err != nil {
+		return nil, fmt.Errorf("delivery %s not found", id)
+	}
+
+	var delivery WebhookDelivery
+	if err := json.Unmarshal(data, &delivery); err != nil {
+		return nil, fmt.Errorf("failed to decode delivery %s: %w", id, err)
+	}
+
+	return &delivery, nil
+}
+
+// BelongsTo reports whether the delivery was sent for a batch of tenant.
+func (d *WebhookDelivery) BelongsTo(tenant string) bool {
+	return tenantOrDefault(d.Tenant) == tenant
+}
+
+// ListDeliveries returns the deliveries of tenant, optionally limited to one
+// batch and status. An empty tenant lists the deliveries of all tenants.
+func (s *Storage) ListDeliveries(tenant string, batchID int64, status string) ([]*WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	files, err := os.ReadDir(filepath.Join(s.dataDir, deliveriesDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*WebhookDelivery{}, nil
+		}
+		return nil, err
+	}
+
+	deliveries := make([]*WebhookDelivery, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		data, err := s.readFile(filepath.Join(s.dataDir, deliveriesDir, file.Name()))
+		if err != nil {
+			continue
+		}
+
+		var delivery WebhookDelivery
+		if err := json.Unmarshal(data, &delivery); err != nil {
+			continue
+		}
+
+		if tenant != "" && !delivery.BelongsTo(tenant) {
+			continue
+		}
+		if batchID != 0 && delivery.BatchID != batchID {
+			continue
+		}
+		if status != "" && delivery.Status != status {
+			continue
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		if deliveries[i].CreatedAt != deliveries[j].CreatedAt {
+			return deliveries[i].CreatedAt > deliveries[j].CreatedAt
+		}
+		return deliveries[i].ID > deliveries[j].ID
+	})
+
+	return deliveries, nil
+}
+
+func (s *Storage) deliveryFilePath(id string) string {
+	return filepath.Join(s.dataDir, deliveriesDir, id+".json")
+}
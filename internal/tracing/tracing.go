@@ -0,0 +1,134 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"linkChecker/internal/logging"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters accepted by Options.Exporter.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// ServiceName identifies the server in traces.
+const ServiceName = "linkchecker"
+
+// Options selects where spans go.
+type Options struct {
+	// Exporter is none, otlp, stdout or file. Empty means none.
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector: a URL, or host:port for plain
+	// HTTP. When empty the standard OTEL_EXPORTER_OTLP_* variables apply,
+	// falling back to localhost:4318.
+	Endpoint string
+	// File receives spans as JSON lines for the file exporter.
+	File string
+	// SampleRatio is the share of new traces that are recorded, 0 to 1.
+	// Traces started by an upstream service follow its decision. Zero
+	// means 1.
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider and propagator. The returned
+// function flushes buffered spans and must be called on shutdown. With the
+// none exporter tracing stays a no-op.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+
+	var (
+		exporter sdktrace.SpanExporter
+		closer   io.Closer
+		err      error
+	)
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return noop, nil
+	case ExporterOTLP:
+		var clientOpts []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			clientOpts = endpointOptions(opts.Endpoint)
+		}
+		exporter, err = otlptracehttp.New(ctx, clientOpts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		if opts.File == "" {
+			return noop, errors.New("the file trace exporter needs a file")
+		}
+		var file *os.File
+		file, err = os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return noop, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		closer = file
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return noop, fmt.Errorf("invalid trace exporter %q: use none, otlp, stdout or file", opts.Exporter)
+	}
+	if err != nil {
+		return noop, fmt.Errorf("failed to create %s trace exporter: %w", opts.Exporter, err)
+	}
+
+	ratio := opts.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			err = errors.Join(err, closer.Close())
+		}
+		return err
+	}, nil
+}
+
+// endpointOptions accept a full URL, or host:port for a collector that
+// speaks plain HTTP.
+func endpointOptions(endpoint string) []otlptracehttp.Option {
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		return []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpoint)}
+	}
+	return []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure()}
+}
+
+// WithLogIDs adds the trace ID of the span in ctx to the log attributes of
+// ctx, so log records can be matched with traces.
+func WithLogIDs(ctx context.Context) context.Context {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return ctx
+	}
+	return logging.With(ctx, "trace_id", spanContext.TraceID().String())
+}
+
+// Tracer returns the tracer of a package of the server, such as "jobs".
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer("linkChecker/internal/" + name)
+}
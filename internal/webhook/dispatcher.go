@@ -0,0 +1,397 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"linkChecker/internal/netguard"
+	"linkChecker/internal/storage"
+)
+
+// Event names sent in payloads and the X-LinkChecker-Event header.
+const (
+	EventBatchCompleted   = "batch.completed"
+	EventBatchCancelled   = "batch.cancelled"
+	EventFailureThreshold = "batch.failure_threshold"
+)
+
+const (
+	SignatureHeader = "X-LinkChecker-Signature"
+	EventHeader     = "X-LinkChecker-Event"
+	DeliveryHeader  = "X-LinkChecker-Delivery"
+	TimestampHeader = "X-LinkChecker-Timestamp"
+)
+
+// Config holds the global webhook settings.
+type Config struct {
+	// URLs receive notifications for every batch, in addition to the
+	// targets registered by the batch itself.
+	URLs []string
+	// Secret signs payloads with HMAC-SHA256. Empty disables signing.
+	Secret string
+	// FailureThreshold applies to batches that do not set their own.
+	FailureThreshold float64
+	MaxAttempts      int
+	InitialBackoff   time.Duration
+	Timeout          time.Duration
+	// Network restricts the addresses of every target. Targets registered
+	// by a batch are also kept away from private addresses.
+	Network netguard.Policy
+}
+
+// Payload is the JSON body of every webhook request.
+type Payload struct {
+	Event      string               `json:"event"`
+	OccurredAt string               `json:"occurred_at"`
+	Batch      storage.BatchSummary `json:"batch"`
+}
+
+// Dispatcher sends signed webhook notifications and retries failed
+// deliveries with exponential backoff. Every delivery is logged in storage.
+type Dispatcher struct {
+	setup   atomic.Pointer[setup]
+	storage *storage.Storage
+
+	// ctx is cancelled by Shutdown and stops every delivery.
+	ctx        context.Context
+	stop       context.CancelFunc
+	deliveries sync.WaitGroup
+}
+
+// setup is a Config with the clients built from it. Targets registered by
+// a batch come from API clients and go through guarded, which cannot reach
+// private addresses unless Network allows them; the global URLs are
+// trusted and only restricted by Network.
+type setup struct {
+	cfg     Config
+	client  *http.Client
+	guarded *http.Client
+}
+
+func NewDispatcher(cfg Config, store *storage.Storage) *Dispatcher {
+	d := &Dispatcher{storage: store}
+	d.ctx, d.stop = context.WithCancel(context.Background())
+	d.Reconfigure(cfg)
+	return d
+}
+
+// Shutdown stops retrying deliveries and waits, until ctx is done, for the
+// attempts in progress to end. Deliveries that have not succeeded stay
+// pending and are resumed by ResumePending on the next start.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.stop()
+
+	done := make(chan struct{})
+	go func() {
+		d.deliveries.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reconfigure replaces the settings of a running dispatcher. Deliveries
+// being retried pick them up with their next attempt.
+func (d *Dispatcher) Reconfigure(cfg Config) {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 2 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	guarded := cfg.Network
+	guarded.BlockPrivate = true
+	d.setup.Store(&setup{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			Transport: &http.Transport{
+				Proxy:       http.ProxyFromEnvironment,
+				DialContext: cfg.Network.Dialer(cfg.Timeout).DialContext,
+			},
+		},
+		guarded: &http.Client{
+			Timeout: cfg.Timeout,
+			// No proxy, so the policy applies to the target itself.
+			Transport: &http.Transport{DialContext: guarded.Dialer(cfg.Timeout).DialContext},
+		},
+	})
+}
+
+// Config returns the settings in effect.
+func (d *Dispatcher) Config() Config {
+	return d.setup.Load().cfg
+}
+
+// FailureThreshold returns the threshold that applies to batch, or 0 when
+// threshold notifications are disabled for it.
+func (d *Dispatcher) FailureThreshold(batch *storage.LinkBatch) float64 {
+	if batch.Notify != nil && batch.Notify.FailureThreshold > 0 {
+		return batch.Notify.FailureThreshold
+	}
+	return d.Config().FailureThreshold
+}
+
+// BatchFinished notifies about a completed or cancelled batch.
+func (d *Dispatcher) BatchFinished(batch *storage.LinkBatch) {
+	event := EventBatchCompleted
+	if batch.Status == "cancelled" {
+		event = EventBatchCancelled
+	}
+	d.notify(batch, event)
+}
+
+// FailureThresholdCrossed notifies that a running batch has too many
+// unavailable links.
+func (d *Dispatcher) FailureThresholdCrossed(batch *storage.LinkBatch) {
+	d.notify(batch, EventFailureThreshold)
+}
+
+func (d *Dispatcher) notify(batch *storage.LinkBatch, event string) {
+	targets := d.targets(batch)
+	if len(targets) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(Payload{
+		Event:      event,
+		OccurredAt: time.Now().Format(time.RFC3339),
+		Batch:      batch.Summarize(time.Now()),
+	})
+	if err != nil {
+		slog.Error("Failed to encode webhook payload", "batch_id", batch.PublicID, "error", err)
+		return
+	}
+
+	for _, target := range targets {
+		delivery := &storage.WebhookDelivery{
+			ID:        newDeliveryID(),
+			BatchID:   batch.BatchID,
+			Tenant:    batch.Tenant,
+			Event:     event,
+			URL:       target,
+			Payload:   payload,
+			Status:    "pending",
+			Attempts:  make([]storage.DeliveryAttempt, 0),
+			CreatedAt: time.Now().Format(time.RFC3339),
+		}
+		d.enqueue(delivery)
+	}
+}
+
+// Replay sends the payload of a logged delivery again as a new delivery.
+func (d *Dispatcher) Replay(id string) (*storage.WebhookDelivery, error) {
+	original, err := d.storage.GetDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &storage.WebhookDelivery{
+		ID:        newDeliveryID(),
+		BatchID:   original.BatchID,
+		Tenant:    original.Tenant,
+		Event:     original.Event,
+		URL:       original.URL,
+		Payload:   original.Payload,
+		Status:    "pending",
+		Attempts:  make([]storage.DeliveryAttempt, 0),
+		CreatedAt: time.Now().Format(time.RFC3339),
+		ReplayOf:  original.ID,
+	}
+	d.enqueue(delivery)
+
+	return delivery, nil
+}
+
+// ResumePending restarts deliveries that were still being retried when the
+// server stopped.
+func (d *Dispatcher) ResumePending() int {
+	pending, err := d.storage.ListDeliveries("", 0, "pending")
+	if err != nil {
+		slog.Error("Failed to list pending webhook deliveries", "error", err)
+		return 0
+	}
+
+	for _, delivery := range pending {
+		d.start(delivery)
+	}
+	return len(pending)
+}
+
+func (d *Dispatcher) enqueue(delivery *storage.WebhookDelivery) {
+	if err := d.storage.SaveDelivery(delivery); err != nil {
+		slog.Error("Failed to log webhook delivery", "delivery", delivery.ID, "error", err)
+	}
+	d.start(delivery)
+}
+
+func (d *Dispatcher) start(delivery *storage.WebhookDelivery) {
+	d.deliveries.Add(1)
+	go func() {
+		defer d.deliveries.Done()
+		d.deliver(delivery)
+	}()
+}
+
+// deliver sends a delivery until it succeeds or runs out of attempts. If
+// the dispatcher shuts down first, the delivery is left pending.
+func (d *Dispatcher) deliver(delivery *storage.WebhookDelivery) {
+	if delivery.NextAttemptAt != "" {
+		if next, err := time.Parse(time.RFC3339, delivery.NextAttemptAt); err == nil && !d.sleep(time.Until(next)) {
+			return
+		}
+	}
+
+	for {
+		current := d.setup.Load()
+		if len(delivery.Attempts) >= current.cfg.MaxAttempts {
+			break
+		}
+
+		attempt := d.send(current, delivery)
+		if d.ctx.Err() != nil {
+			// Interrupted by shutdown, which is not the target's fault.
+			return
+		}
+		delivery.Attempts = append(delivery.Attempts, attempt)
+
+		if attempt.Error == "" {
+			delivery.Status = "delivered"
+			delivery.NextAttemptAt = ""
+			d.save(delivery)
+			return
+		}
+
+		if len(delivery.Attempts) >= current.cfg.MaxAttempts {
+			break
+		}
+
+		backoff := current.cfg.InitialBackoff << (len(delivery.Attempts) - 1)
+		delivery.NextAttemptAt = time.Now().Add(backoff).Format(time.RFC3339)
+		d.save(delivery)
+		if !d.sleep(backoff) {
+			return
+		}
+	}
+
+	delivery.Status = "failed"
+	delivery.NextAttemptAt = ""
+	d.save(delivery)
+	slog.Warn("Webhook delivery failed", "delivery", delivery.ID, "url", delivery.URL, "attempts", len(delivery.Attempts))
+}
+
+// sleep waits for wait and reports whether the dispatcher is still running.
+func (d *Dispatcher) sleep(wait time.Duration) bool {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-d.ctx.Done():
+		return false
+	}
+}
+
+func (d *Dispatcher) send(current *setup, delivery *storage.WebhookDelivery) storage.DeliveryAttempt {
+	attempt := storage.DeliveryAttempt{At: time.Now().Format(time.RFC3339)}
+
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "LinkChecker-Webhook/1.0")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(TimestampHeader, timestamp)
+	if current.cfg.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(current.cfg.Secret, timestamp, delivery.Payload))
+	}
+
+	client := current.guarded
+	if slices.Contains(current.cfg.URLs, delivery.URL) {
+		client = current.client
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("HTTP %d: %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	return attempt
+}
+
+func (d *Dispatcher) save(delivery *storage.WebhookDelivery) {
+	if err := d.storage.SaveDelivery(delivery); err != nil {
+		slog.Error("Failed to log webhook delivery", "delivery", delivery.ID, "error", err)
+	}
+}
+
+func (d *Dispatcher) targets(batch *storage.LinkBatch) []string {
+	seen := make(map[string]bool)
+	var targets []string
+
+	add := func(urls []string) {
+		for _, u := range urls {
+			if u != "" && !seen[u] {
+				seen[u] = true
+				targets = append(targets, u)
+			}
+		}
+	}
+
+	if batch.Notify != nil {
+		add(batch.Notify.URLs)
+	}
+	add(d.Config().URLs)
+
+	return targets
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of timestamp, a dot and payload,
+// as sent in the signature header without its "sha256=" prefix. timestamp
+// is the value of the timestamp header; covering it lets receivers reject
+// old deliveries replayed by someone who captured them.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newDeliveryID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("%d-%s", time.Now().Unix(), hex.EncodeToString(b))
+}
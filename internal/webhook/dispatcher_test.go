@@ -0,0 +1,208 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"linkChecker/internal/storage"
+)
+
+// receiver is a webhook target that answers with the next status of
+// statuses, repeating the last one, and records every request.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []received
+}
+
+type received struct {
+	at     time.Time
+	header http.Header
+	body   []byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, received{at: time.Now(), header: req.Header.Clone(), body: body})
+		status := r.statuses[0]
+		if len(r.statuses) > 1 {
+			r.statuses = r.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) setStatuses(statuses ...int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statuses = statuses
+}
+
+func (r *receiver) received() []received {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]received(nil), r.requests...)
+}
+
+func TestDeliverySignedAndRetried(t *testing.T) {
+	target := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway, http.StatusOK)
+	store, batch := newTestBatch(t)
+	d := NewDispatcher(Config{URLs: []string{target.URL}, Secret: "s3cret", InitialBackoff: 20 * time.Millisecond}, store)
+	defer d.Shutdown(context.Background())
+
+	d.BatchFinished(batch)
+	delivery := waitForDelivery(t, store, func(d *storage.WebhookDelivery) bool { return d.Status != "pending" })
+
+	if delivery.Status != "delivered" || delivery.Event != EventBatchCompleted || len(delivery.Attempts) != 3 {
+		t.Fatalf("delivery = %+v, want it delivered on the third attempt", delivery)
+	}
+	for i, want := range []int{500, 502, 200} {
+		if got := delivery.Attempts[i].StatusCode; got != want {
+			t.Errorf("attempt %d got status %d, want %d", i+1, got, want)
+		}
+	}
+
+	requests := target.received()
+	if len(requests) != 3 {
+		t.Fatalf("target got %d requests, want 3", len(requests))
+	}
+	// The backoff doubles after every failed attempt.
+	for i, backoff := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond} {
+		if gap := requests[i+1].at.Sub(requests[i].at); gap < backoff {
+			t.Errorf("attempt %d came %v after the previous one, want at least %v", i+2, gap, backoff)
+		}
+	}
+
+	for i, req := range requests {
+		timestamp := req.header.Get(TimestampHeader)
+		if want := "sha256=" + Sign("s3cret", timestamp, req.body); req.header.Get(SignatureHeader) != want {
+			t.Errorf("request %d signature = %q, want %q", i+1, req.header.Get(SignatureHeader), want)
+		}
+		if req.header.Get(DeliveryHeader) != delivery.ID || req.header.Get(EventHeader) != EventBatchCompleted {
+			t.Errorf("request %d headers = %v, want delivery %s of %s", i+1, req.header, delivery.ID, EventBatchCompleted)
+		}
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(requests[0].body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != EventBatchCompleted || payload.Batch.PublicID != batch.PublicID {
+		t.Errorf("payload = %+v, want batch %s completed", payload, batch.PublicID)
+	}
+}
+
+func TestDeliveryFailsAfterMaxAttempts(t *testing.T) {
+	target := newReceiver(t, http.StatusServiceUnavailable)
+	store, batch := newTestBatch(t)
+	d := NewDispatcher(Config{URLs: []string{target.URL}, MaxAttempts: 2, InitialBackoff: time.Millisecond}, store)
+	defer d.Shutdown(context.Background())
+
+	d.BatchFinished(batch)
+	delivery := waitForDelivery(t, store, func(d *storage.WebhookDelivery) bool { return d.Status != "pending" })
+
+	if delivery.Status != "failed" || len(delivery.Attempts) != 2 || delivery.NextAttemptAt != "" {
+		t.Errorf("delivery = %+v, want it failed after 2 attempts", delivery)
+	}
+	if requests := target.received(); len(requests) != 2 || requests[0].header.Get(SignatureHeader) != "" {
+		t.Errorf("target got %d requests, want 2 without signature", len(requests))
+	}
+}
+
+func TestDeliveryResumedAfterShutdown(t *testing.T) {
+	target := newReceiver(t, http.StatusServiceUnavailable)
+	store, batch := newTestBatch(t)
+	cfg := Config{URLs: []string{target.URL}, InitialBackoff: time.Hour}
+
+	d := NewDispatcher(cfg, store)
+	d.BatchFinished(batch)
+	waitForDelivery(t, store, func(d *storage.WebhookDelivery) bool { return len(d.Attempts) == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown waited for the backoff: %v", err)
+	}
+	pending, err := store.ListDeliveries("", 0, "pending")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].NextAttemptAt == "" {
+		t.Fatalf("pending deliveries = %+v, want one waiting for its next attempt", pending)
+	}
+
+	// The server comes back after the next attempt was due.
+	pending[0].NextAttemptAt = time.Now().Add(-time.Minute).Format(time.RFC3339)
+	if err := store.SaveDelivery(pending[0]); err != nil {
+		t.Fatal(err)
+	}
+	target.setStatuses(http.StatusOK)
+
+	resumed := NewDispatcher(cfg, store)
+	defer resumed.Shutdown(context.Background())
+	if n := resumed.ResumePending(); n != 1 {
+		t.Fatalf("resumed %d deliveries, want 1", n)
+	}
+	delivery := waitForDelivery(t, store, func(d *storage.WebhookDelivery) bool { return d.Status != "pending" })
+
+	if delivery.ID != pending[0].ID || delivery.Status != "delivered" || len(delivery.Attempts) != 2 {
+		t.Errorf("delivery = %+v, want %s delivered on the second attempt", delivery, pending[0].ID)
+	}
+	if requests := target.received(); len(requests) != 2 || requests[1].header.Get(DeliveryHeader) != delivery.ID {
+		t.Errorf("target got %d requests, want the same delivery twice", len(requests))
+	}
+}
+
+// newTestBatch returns a storage holding one completed batch.
+func newTestBatch(t *testing.T) (*storage.Storage, *storage.LinkBatch) {
+	t.Helper()
+	store, err := storage.NewStorageWithOptions(t.TempDir(), storage.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := store.SaveBatch([]string{"https://a.example"}, storage.BatchMetadata{}, nil, 0, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateBatch(id, []storage.LinkResult{{URL: "https://a.example", Available: true}}, "completed"); err != nil {
+		t.Fatal(err)
+	}
+	batch, err := store.GetBatch(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, batch
+}
+
+// waitForDelivery polls the only delivery in store until done accepts it.
+func waitForDelivery(t *testing.T, store *storage.Storage, done func(*storage.WebhookDelivery) bool) *storage.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := store.ListDeliveries("", 0, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) == 1 && done(deliveries[0]) {
+			return deliveries[0]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("delivery not done in time: %+v", deliveries)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}